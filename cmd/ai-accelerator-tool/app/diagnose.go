@@ -8,46 +8,205 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
 
+	v1 "github.com/aibrix/ai-accelerator-tool/pkg/api/v1"
 	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/metrics"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+	"github.com/aibrix/ai-accelerator-tool/pkg/npd"
 	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
 )
 
+// diagnoseOptions are the options shared by the commands running a diagnosis.
+type diagnoseOptions struct {
+	cardCount     int
+	rdmaPortCount int
+	rdmaRate      int
+	// visibleDevicesOnly scopes the checks to the GPUs of the container.
+	visibleDevicesOnly bool
+}
+
+func (o *diagnoseOptions) addFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&o.cardCount, "card-count", 0, "Expected number of GPUs, "+utils.GPU_CARD_COUNT+" if 0")
+	flags.IntVar(&o.rdmaPortCount, "rdma-port-count", 0, "Expected number of active RDMA ports, 0 to skip the check")
+	flags.IntVar(&o.rdmaRate, "rdma-rate", 0, "Expected minimum RDMA link rate in Gb/s, 0 to skip the check")
+}
+
+func (o *diagnoseOptions) newController() (diagnose.Diagnoser, error) {
+	cfg := &diagnose.Config{
+		ExpectedRDMAPortCount: o.rdmaPortCount,
+		ExpectedRDMARate:      o.rdmaRate,
+	}
+	if o.visibleDevicesOnly {
+		devices, count, err := diagnose.VisibleDevicesFromEnv(os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExpectedCardCount = count
+		cfg.VisibleDevices = devices
+		// Sysfs in the pod lists the GPUs of other pods too, the checks are
+		// scoped to the GPUs its nvidia-smi lists.
+		cfg.ContainerScoped = diagnose.VisibleDevicesEnvSet(os.Getenv)
+	}
+	if cfg.ExpectedCardCount > 0 {
+		return diagnose.NewController(cfg)
+	}
+
+	// All GPUs are visible, fall back to --card-count or GPU_CARD_COUNT.
+	if o.cardCount > 0 {
+		cfg.ExpectedCardCount = o.cardCount
+		return diagnose.NewController(cfg)
+	}
+	gpuCardCountStr := os.Getenv(utils.GPU_CARD_COUNT)
+	if gpuCardCountStr == "" {
+		return nil, fmt.Errorf("%s is not set", utils.GPU_CARD_COUNT)
+	}
+	gpuCardCount, err := strconv.Atoi(gpuCardCountStr)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a number: %v", utils.GPU_CARD_COUNT, gpuCardCountStr)
+	}
+	cfg.ExpectedCardCount = gpuCardCount
+
+	return diagnose.NewController(cfg)
+}
+
+const (
+	outputJSON         = "json"
+	outputPromTextfile = "prom-textfile"
+)
+
 func NewDiagnoseCmd() *cobra.Command {
+	opts := &diagnoseOptions{}
+	var output string
+	var textfileDir string
+	var npdMode bool
+	var checkNames []string
+	var terminationLog string
+	var recordDir string
+	var replayDir string
+
 	var command = &cobra.Command{
 		Use:   "diagnose",
 		Short: "Check whether the GPU in the machine is abnormal.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			gpuCardCountStr := os.Getenv(utils.GPU_CARD_COUNT)
-			if gpuCardCountStr == "" {
-				return fmt.Errorf("%s is not set", utils.GPU_CARD_COUNT)
+			switch output {
+			case outputJSON:
+			case outputPromTextfile:
+				if textfileDir == "" {
+					return fmt.Errorf("--textfile-dir is required with --output=%s", outputPromTextfile)
+				}
+			default:
+				return fmt.Errorf("unsupported output %q, must be one of %s, %s", output, outputJSON, outputPromTextfile)
 			}
-			gpuCardCount, err := strconv.Atoi(gpuCardCountStr)
-			if err != nil {
-				return fmt.Errorf("%s is not a number: %v", utils.GPU_CARD_COUNT, gpuCardCountStr)
+
+			if recordDir != "" {
+				stop, err := utils.StartRecording(recordDir)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if err := stop(); err != nil {
+						klog.ErrorS(err, "Failed to record the diagnosis", "dir", recordDir)
+					}
+				}()
+			}
+			if replayDir != "" {
+				restore, err := utils.StartReplay(replayDir)
+				if err != nil {
+					return err
+				}
+				defer restore()
 			}
 
-			controller, err := diagnose.NewController(&diagnose.Config{
-				ExpectedCardCount: gpuCardCount,
-			})
+			var checks []diagnose.DiagnoseType
+			if npdMode {
+				var err error
+				if checks, err = npd.ParseChecks(checkNames); err != nil {
+					return err
+				}
+				// Only the exit code and stdout are read by node-problem-detector.
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+			}
+
+			controller, err := opts.newController()
 			if err != nil {
+				if opts.visibleDevicesOnly && terminationLog != "" {
+					writeTerminationMessage(terminationLog, err.Error())
+				}
+				if npdMode {
+					fmt.Println(err)
+					return &exitCodeError{code: int(npd.StatusUnknown)}
+				}
 				return err
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
-			res, err := controller.Check(ctx)
-			if err != nil {
-				return err
+			run := monitor.Diagnose(ctx, controller)
+			if opts.visibleDevicesOnly && terminationLog != "" {
+				writeTerminationMessage(terminationLog, v1.NewReport(run, nil).Summary())
+			}
+			if npdMode {
+				status, msg := npd.Evaluate(run.Results, run.Err, checks)
+				fmt.Println(msg)
+				if status != npd.StatusOK {
+					return &exitCodeError{code: int(status)}
+				}
+				return nil
+			}
+			if output == outputPromTextfile {
+				// Failed runs are written too, so that dashboards see the failure
+				// rather than stale results.
+				if err := metrics.WriteTextfile(textfileDir, run); err != nil {
+					return fmt.Errorf("write textfile failed: %s", err)
+				}
+				return run.Err
+			}
+
+			if run.Err != nil {
+				return run.Err
 			}
 			klog.InfoS("Diagnose Results")
-			utils.PrettyPrint(res)
+			utils.PrettyPrint(run.Results)
+
+			// Fail the init container, so that the pod does not start on bad GPUs.
+			if opts.visibleDevicesOnly && !v1.NewReport(run, nil).Healthy {
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: 1}
+			}
 
 			return nil
 		},
 	}
 
+	opts.addFlags(command.Flags())
+	command.Flags().StringVarP(&output, "output", "o", outputJSON, "Output format, one of json, prom-textfile")
+	command.Flags().StringVar(&textfileDir, "textfile-dir", "", "Directory of the node_exporter textfile collector, used with --output=prom-textfile")
+	command.Flags().BoolVar(&opts.visibleDevicesOnly, "preflight", false, "Run as a pre-flight check in a pod: check only the GPUs in NVIDIA_VISIBLE_DEVICES or CUDA_VISIBLE_DEVICES, write a summary to --termination-log and exit 1 if unhealthy")
+	command.Flags().StringVar(&terminationLog, "termination-log", "/dev/termination-log", "Path of the container termination message, used with --preflight, empty to disable")
+	command.Flags().BoolVar(&npdMode, "npd", false, "Run as a node-problem-detector custom plugin: print a short message and exit 0 if OK, 1 if NonOK, 2 if Unknown")
+	command.Flags().StringSliceVar(&checkNames, "check", nil, "Checks or check groups reported with --npd, all if empty")
+	command.Flags().StringVar(&recordDir, "record", "", "Record every command run by the diagnosis with its output, exit status and duration, and the host files it reads, to a bundle in this directory")
+	command.Flags().StringVar(&replayDir, "replay", "", "Serve the commands and host files recorded with --record in this directory instead of running and reading them")
+	command.MarkFlagsMutuallyExclusive("record", "replay")
+
 	return command
 }
+
+// maxTerminationMessageLength is the limit of the kubelet, longer messages are
+// truncated.
+const maxTerminationMessageLength = 4096
+
+func writeTerminationMessage(path, msg string) {
+	if len(msg) > maxTerminationMessageLength {
+		msg = msg[:maxTerminationMessageLength-3] + "..."
+	}
+	if err := os.WriteFile(path, []byte(msg), 0644); err != nil {
+		klog.ErrorS(err, "Failed to write termination message", "path", path)
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/k8s"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+// k8sOptions are the options of reporting results on the Node object.
+type k8sOptions struct {
+	nodeName   string
+	kubeconfig string
+	taint      bool
+	events     bool
+}
+
+func (o *k8sOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.nodeName, "node-name", os.Getenv("NODE_NAME"), "Name of the Kubernetes node to report conditions on, empty to disable")
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to a kubeconfig, the in-cluster config is used if empty")
+	flags.BoolVar(&o.taint, "taint", false, "Taint the node with NoSchedule while it is unhealthy")
+	flags.BoolVar(&o.events, "events", true, "Record an event on the node for every health transition")
+}
+
+// addReporter reports the results of every run and the health transitions on
+// the node, if enabled.
+func (o *k8sOptions) addReporter(m *monitor.Monitor) error {
+	if o.nodeName == "" {
+		return nil
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("build kubernetes config failed: %s", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("create kubernetes client failed: %s", err)
+	}
+	reporter, err := k8s.NewReporter(&k8s.Config{
+		Client:   client,
+		NodeName: o.nodeName,
+		Taint:    o.taint,
+	})
+	if err != nil {
+		return err
+	}
+
+	m.AddRunHandler(func(ctx context.Context, run *monitor.Run) {
+		if err := reporter.Report(ctx, run.Results, run.Err); err != nil {
+			klog.ErrorS(err, "Failed to report results on node", "node", o.nodeName)
+		}
+	})
+
+	if o.events {
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+		emitter, err := k8s.NewEventEmitter(&k8s.EventConfig{
+			Recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "ai-accelerator-tool", Host: o.nodeName}),
+			NodeName: o.nodeName,
+		})
+		if err != nil {
+			return err
+		}
+		m.AddEventHandler(func(_ context.Context, event *monitor.Event) {
+			emitter.Emit(event)
+		})
+	}
+
+	return nil
+}
@@ -2,26 +2,39 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 
 	"github.com/aibrix/ai-accelerator-tool/pkg/mock"
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock/fakesmi"
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock/scenario"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
 )
 
+// ldPreloadFile is the preload file of the dynamic linker injected by --global.
+const ldPreloadFile = "/etc/ld.so.preload"
+
 func NewMockCmd() *cobra.Command {
 	var configPath string
 	var gpuMockDir string
+	var global bool
 
 	command := &cobra.Command{
-		Use:   "mock",
+		Use:   "mock --config FILE [-- COMMAND [ARG...]]",
 		Short: "Run with GPU mock injection",
-		Long:  `Run GPU diagnosis with mock injection using a configuration file.`,
+		Long: `Run a command with GPU mock injection using a configuration file, by default the GPU diagnosis.
+The output of the command is streamed and its exit code is returned, the injection is removed afterwards.
+Only the command and its children are injected, unless --global injects every process on the host through /etc/ld.so.preload.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if configPath == "" {
 				return fmt.Errorf("--config is required")
@@ -33,18 +46,22 @@ func NewMockCmd() *cobra.Command {
 				return fmt.Errorf("failed to get absolute path for config: %v", err)
 			}
 
-			// Create context with cancellation
-			ctx, cancel := context.WithCancel(cmd.Context())
+			argv := args
+			if len(argv) == 0 {
+				argv, err = defaultMockCommand()
+				if err != nil {
+					return err
+				}
+			}
+
+			// Interrupt signals are handled, so that the mock environment is always
+			// restored, and passed on to the command by cancelling it.
+			ctx, cancel := signalContext()
 			defer cancel()
 
-			// Handle interrupt signals
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-			go func() {
-				<-sigCh
-				klog.InfoS("Received interrupt signal, cleaning up...")
-				cancel()
-			}()
+			if global && gpuMockDir == "" {
+				gpuMockDir = mock.DefaultGPUMockDir
+			}
 
 			// Create mock controller with embedded library
 			controller, err := mock.NewController(&mock.Config{
@@ -52,7 +69,8 @@ func NewMockCmd() *cobra.Command {
 				GPUMockDir: gpuMockDir,
 
 				// Setting LD preload file to /etc/ld.so.preload is a hack to make the mock work.
-				LDPreloadFile: "/etc/ld.so.preload",
+				LDPreloadFile: ldPreloadFile,
+				Global:        global,
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create mock controller: %v", err)
@@ -62,29 +80,515 @@ func NewMockCmd() *cobra.Command {
 			if err := controller.Start(); err != nil {
 				return fmt.Errorf("failed to start mock: %v", err)
 			}
-			defer controller.Stop()
-
-			errCh := make(chan error, 1)
-
-			// Wait for either completion or cancellation
-			select {
-			case err := <-errCh:
-				if err != nil {
-					return fmt.Errorf("diagnose failed: %v", err)
+			defer func() {
+				if err := controller.Stop(); err != nil {
+					klog.ErrorS(err, "Failed to stop mock")
 				}
-				klog.InfoS("Mock test completed successfully")
-			case <-ctx.Done():
+			}()
+
+			klog.InfoS("Running command with mock injection", "command", argv, "global", global)
+			code, err := runCommand(ctx, argv, controller.Env())
+			if err != nil {
+				return fmt.Errorf("run %s failed: %v", argv[0], err)
+			}
+			if ctx.Err() != nil {
 				return fmt.Errorf("mock test cancelled")
 			}
+			if code != 0 {
+				// The command has reported its own errors.
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: code}
+			}
+			klog.InfoS("Mock test completed successfully")
 
 			return nil
 		},
 	}
 
+	// Flags after the command are passed to it rather than parsed.
+	command.Flags().SetInterspersed(false)
+
 	command.Flags().StringVarP(&configPath, "config", "c", "", "Path to mock configuration file (required)")
 	command.MarkFlagRequired("config")
 
-	command.Flags().StringVarP(&gpuMockDir, "gpu-mock-dir", "d", "/opt/gpu_mock", "Directory for GPU mock files")
+	command.Flags().StringVarP(&gpuMockDir, "gpu-mock-dir", "d", "",
+		"Directory for GPU mock files, "+mock.DefaultGPUMockDir+" with --global or a temporary directory otherwise")
+	command.Flags().BoolVar(&global, "global", false,
+		"Inject every process on the host through /etc/ld.so.preload rather than only the command, requires root")
+
+	command.AddCommand(NewMockCleanupCmd())
+	command.AddCommand(NewMockValidateCmd())
+	command.AddCommand(NewMockRecordCmd())
+	command.AddCommand(NewMockStatusCmd())
+	command.AddCommand(NewMockShowCmd())
+	command.AddCommand(NewMockLogsCmd())
+	command.AddCommand(NewMockScenariosCmd())
+	command.AddCommand(NewFakeNvidiaSMICmd())
+
+	return command
+}
+
+func NewMockCleanupCmd() *cobra.Command {
+	var journalFile string
+	var force bool
+
+	command := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Restore /etc/ld.so.preload after a global mock was killed",
+		Long: `Restore /etc/ld.so.preload from the recovery journal of a global mock environment which was not stopped,
+e.g. because the tool was killed or the node rebooted, and remove its files.
+Without a journal, entries of the injection library are removed from /etc/ld.so.preload.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cleaned, err := mock.Cleanup(journalFile, ldPreloadFile, force)
+			if err != nil {
+				return fmt.Errorf("failed to clean up mock: %v", err)
+			}
+			if cleaned {
+				klog.InfoS("Mock injection cleaned up")
+			} else {
+				klog.InfoS("No mock injection found")
+			}
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&journalFile, "journal", mock.DefaultJournalFile, "Path to the recovery journal")
+	command.Flags().BoolVar(&force, "force", false, "Clean up even if the process which started the mock is still running")
+
+	return command
+}
+
+// defaultMockCommand returns the command running this tool's diagnosis with the
+// same host root.
+func defaultMockCommand() ([]string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable path: %v", err)
+	}
+
+	argv := []string{self}
+	if hostRoot != "" {
+		argv = append(argv, "--host-root", hostRoot, "--host-exec", hostExec)
+	}
+
+	return append(argv, "diagnose"), nil
+}
+
+// runCommand runs the command with the standard streams and environment of
+// this process plus the given variables, and returns its exit code. The command
+// is killed when the context is cancelled.
+func runCommand(ctx context.Context, argv []string, env []string) (int, error) {
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	// Give the command a chance to clean up on cancellation.
+	c.Cancel = func() error {
+		return c.Process.Signal(syscall.SIGTERM)
+	}
+	c.WaitDelay = 10 * time.Second
+
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Follow the shell convention for commands killed by a signal.
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+func NewMockValidateCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "validate FILE...",
+		Short: "Validate mock configuration files",
+		Long: `Validate mock configuration files, reporting unknown keys, wrong types and out of range values with their line,
+which the injection library would silently ignore.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invalid := false
+			for _, path := range args {
+				_, err := mock.LoadConfig(path)
+				if err == nil {
+					continue
+				}
+				invalid = true
+
+				var validationErrs mock.ValidationErrors
+				if !errors.As(err, &validationErrs) {
+					fmt.Printf("%s: %v\n", path, err)
+					continue
+				}
+				for _, validationErr := range validationErrs {
+					fmt.Printf("%s: %v\n", path, validationErr)
+				}
+			}
+
+			if invalid {
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: 1}
+			}
+			return nil
+		},
+	}
+
+	return command
+}
+
+func NewMockRecordCmd() *cobra.Command {
+	var output string
+	var anonymize bool
+
+	command := &cobra.Command{
+		Use:   "record",
+		Short: "Record the GPU state of this node into a mock configuration",
+		Long: `Record the state of the GPUs of this node as reported by nvidia-smi into a mock configuration,
+so that the state of a failing node can be replayed anywhere with mock --config.
+Names, UUIDs, PCI addresses, PCIe links, ECC errors, retired pages, row remapping and NVLinks are recorded,
+values which the GPU or driver does not support are left out.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := mock.Record(cmd.Context(), &mock.RecordOptions{Anonymize: anonymize})
+			if err != nil {
+				return fmt.Errorf("failed to record GPU state: %v", err)
+			}
+			data, err := mock.EncodeConfig(config)
+			if err != nil {
+				return fmt.Errorf("failed to encode mock config: %v", err)
+			}
+
+			if output == "" {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write mock config: %v", err)
+			}
+			klog.InfoS("GPU state recorded", "file", output, "gpus", len(config.GPUs.Cards))
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&output, "output", "o", "", "File to write the mock configuration to, stdout if empty")
+	command.Flags().BoolVar(&anonymize, "anonymize", false,
+		"Replace GPU UUIDs by ones derived from their index, serial numbers are never recorded")
+
+	return command
+}
+
+func NewMockStatusCmd() *cobra.Command {
+	var journalFile string
+
+	command := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether GPU mock injection is active on this node",
+		Long: `Show whether the injection library is preloaded through /etc/ld.so.preload, by which process and since when,
+the configs it reads, and the processes it is injected into through LD_PRELOAD.
+Processes whose environment cannot be read are not listed, run as root to see all.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := mock.ReadStatus(journalFile, ldPreloadFile)
+			if err != nil {
+				return err
+			}
+
+			if !status.Active() {
+				fmt.Println("Injection: inactive")
+			} else {
+				fmt.Println("Injection: active")
+			}
+			for _, lib := range status.Preloaded {
+				fmt.Printf("Preloaded: %s (%s)\n", lib, ldPreloadFile)
+			}
+			if j := status.Journal; j != nil {
+				state := "running"
+				if !status.JournalAlive {
+					state = "not running, run mock cleanup to restore " + j.LDPreloadFile
+				}
+				fmt.Printf("Started: %s by pid %d (%s)\n", j.Time.Format(time.RFC3339), j.PID, state)
+			}
+			for _, path := range status.ConfigPaths() {
+				fmt.Printf("Config: %s\n", path)
+			}
+			if len(status.Processes) > 0 {
+				fmt.Println("Processes:")
+				w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				for _, p := range status.Processes {
+					fmt.Fprintf(w, "  %d\t%s\t%s\n", p.PID, p.Command, p.ConfigPath)
+				}
+				w.Flush()
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&journalFile, "journal", mock.DefaultJournalFile, "Path to the recovery journal")
+
+	return command
+}
+
+func NewMockShowCmd() *cobra.Command {
+	var configPath string
+	var journalFile string
+
+	command := &cobra.Command{
+		Use:   "show",
+		Short: "Show the values injected into every GPU",
+		Long: `Show the values the injection library injects into every GPU, from the config of the active mock injection or --config.
+Values shown as - are not injected, the GPU reports its own value for them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				status, err := mock.ReadStatus(journalFile, ldPreloadFile)
+				if err != nil {
+					return err
+				}
+				paths := status.ConfigPaths()
+				if len(paths) == 0 {
+					return fmt.Errorf("mock injection is not active, pass --config")
+				}
+				// The library is loaded by host processes, the config path is
+				// a host path.
+				configPath = utils.HostPath(paths[0])
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to read config file: %v", err)
+			}
+			timeline, err := mock.NewTimeline(data)
+			if err != nil {
+				return fmt.Errorf("invalid config file %s: %v", configPath, err)
+			}
+			if !timeline.Static() {
+				if data, err = timeline.Render(0); err != nil {
+					return err
+				}
+			}
+			config, err := mock.ParseConfig(data)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Config: %s\n", configPath)
+			if !timeline.Static() {
+				fmt.Println("Timeline: values at the start are shown")
+			}
+			if config.GPUs != nil && config.GPUs.NVMLInitError != nil {
+				fmt.Printf("nvml_init_error: %d\n", *config.GPUs.NVMLInitError)
+			}
+
+			keys, cards := mock.GPUValues(config)
+			if len(cards) == 0 {
+				fmt.Println("No GPU values injected")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			header := []string{"KEY"}
+			for index := range cards {
+				header = append(header, fmt.Sprintf("GPU%d INJECTED", index))
+			}
+			fmt.Fprintln(w, strings.Join(header, "\t"))
+			for i, key := range keys {
+				row := []string{key}
+				for _, values := range cards {
+					value := values[i]
+					if value == "" {
+						value = "-"
+					}
+					row = append(row, value)
+				}
+				fmt.Fprintln(w, strings.Join(row, "\t"))
+			}
+			return w.Flush()
+		},
+	}
+
+	command.Flags().StringVarP(&configPath, "config", "c", "", "Path to a mock configuration file, the one of the active injection if empty")
+	command.Flags().StringVar(&journalFile, "journal", mock.DefaultJournalFile, "Path to the recovery journal")
+
+	return command
+}
+
+func NewMockLogsCmd() *cobra.Command {
+	var gpuMockDir string
+	var journalFile string
+	var lines int
+
+	command := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the log of the injection library",
+		Long: `Show the last lines of the log of the injection library, which it writes when it fails to load its config
+or the original library. The library writes it next to its config, the logs of the active mock injections are shown
+unless --gpu-mock-dir is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dirs := []string{gpuMockDir}
+			if gpuMockDir == "" {
+				status, err := mock.ReadStatus(journalFile, ldPreloadFile)
+				if err != nil {
+					return err
+				}
+				if dirs = status.LogDirs(); len(dirs) == 0 {
+					dirs = []string{mock.DefaultGPUMockDir}
+				}
+			}
+
+			for i, dir := range dirs {
+				// The library is loaded by host processes, the dir is a host
+				// path.
+				logPath := filepath.Join(dir, mock.LogName)
+				if len(dirs) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("==> %s <==\n", logPath)
+				}
+				logLines, err := mock.ReadLog(dir, lines)
+				if os.IsNotExist(err) {
+					fmt.Printf("No log at %s\n", logPath)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("failed to read log: %v", err)
+				}
+				for _, line := range logLines {
+					fmt.Println(line)
+				}
+			}
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&gpuMockDir, "gpu-mock-dir", "d", "", "Directory the injection library writes its log to, the ones of the active mock injections if empty")
+	command.Flags().StringVar(&journalFile, "journal", mock.DefaultJournalFile, "Path to the recovery journal")
+	command.Flags().IntVarP(&lines, "lines", "n", 50, "Number of last lines to show, -1 for all")
+
+	return command
+}
+
+func NewMockScenariosCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "scenarios",
+		Short: "Run the GPU diagnosis against fault scenarios",
+	}
+
+	command.AddCommand(NewMockScenariosRunCmd())
+
+	return command
+}
+
+func NewMockScenariosRunCmd() *cobra.Command {
+	var dir string
+
+	command := &cobra.Command{
+		Use:   "run [NAME...]",
+		Short: "Run fault scenarios and compare the diagnosis with their expected results",
+		Long: `Run the GPU diagnosis of every fault scenario, or only the named ones, and compare its results with the expected ones.
+A scenario is a directory with a mock configuration, gpu_mock_conf.toml, and the expected results, expected.yaml.
+The diagnosis runs against a fake nvidia-smi answering from the mock configuration and a fake sysfs, so no GPUs are needed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fsys := scenario.Builtin()
+			if dir != "" {
+				fsys = os.DirFS(dir)
+			}
+			scenarios, err := scenario.Load(fsys)
+			if err != nil {
+				return err
+			}
+			scenarios, err = selectScenarios(scenarios, args)
+			if err != nil {
+				return err
+			}
+
+			self, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to get executable path: %v", err)
+			}
+			runner := &scenario.Runner{NvidiaSMI: []string{self, "mock", "fake-nvidia-smi"}}
+
+			failed := 0
+			for _, s := range scenarios {
+				res, err := runner.Run(cmd.Context(), s)
+				if err != nil {
+					return fmt.Errorf("run scenario %s failed: %v", s.Name, err)
+				}
+				if res.Passed() {
+					fmt.Printf("PASS %s\n", s.Name)
+					continue
+				}
+				failed++
+				fmt.Printf("FAIL %s\n", s.Name)
+				for _, failure := range res.Failures {
+					fmt.Printf("    %s\n", failure)
+				}
+			}
+			fmt.Printf("%d passed, %d failed\n", len(scenarios)-failed, failed)
+
+			if failed > 0 {
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: 1}
+			}
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&dir, "dir", "", "Directory of scenarios, the built-in scenarios if empty")
+
+	return command
+}
+
+// selectScenarios returns the scenarios with the given names, all if none are
+// given.
+func selectScenarios(scenarios []*scenario.Scenario, names []string) ([]*scenario.Scenario, error) {
+	if len(names) == 0 {
+		return scenarios, nil
+	}
+
+	byName := map[string]*scenario.Scenario{}
+	for _, s := range scenarios {
+		byName[s.Name] = s
+	}
+	var selected []*scenario.Scenario
+	for _, name := range names {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+		selected = append(selected, s)
+	}
+
+	return selected, nil
+}
+
+// NewFakeNvidiaSMICmd runs the fake nvidia-smi of the scenarios.
+func NewFakeNvidiaSMICmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:                "fake-nvidia-smi [ARG...]",
+		Short:              "Answer nvidia-smi queries from the mock configuration at " + mock.EnvConfPath,
+		Hidden:             true,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if code := fakesmi.Main(args, os.Stdout, os.Stderr); code != 0 {
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: code}
+			}
+			return nil
+		},
+	}
 
 	return command
 }
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/health"
+	"github.com/aibrix/ai-accelerator-tool/pkg/metrics"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+// monitorOptions are the options shared by the commands running the diagnosis
+// periodically.
+type monitorOptions struct {
+	diagnoseOptions
+	k8sOptions
+	interval time.Duration
+	jitter   time.Duration
+	timeout  time.Duration
+	// healthFile is the path of the per GPU health file for device plugins.
+	healthFile string
+}
+
+func (o *monitorOptions) addFlags(flags *pflag.FlagSet) {
+	o.diagnoseOptions.addFlags(flags)
+	o.k8sOptions.addFlags(flags)
+	flags.DurationVar(&o.interval, "interval", 5*time.Minute, "Interval between diagnoses")
+	flags.DurationVar(&o.jitter, "jitter", 30*time.Second, "Maximum random delay added to every interval")
+	flags.DurationVar(&o.timeout, "timeout", time.Minute, "Timeout of a single diagnosis")
+	flags.StringVar(&o.healthFile, "health-file", "", "Path to publish the health of every GPU to for device plugins, e.g. "+health.DefaultPath+", empty to disable")
+}
+
+// newMonitor returns a monitor which logs health transitions and writes them
+// to stdout as JSON lines for log collectors.
+func (o *monitorOptions) newMonitor() (*monitor.Monitor, error) {
+	controller, err := o.newController()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := monitor.NewMonitor(&monitor.Config{
+		Diagnoser: controller,
+		Interval:  o.interval,
+		Jitter:    o.jitter,
+		Timeout:   o.timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	m.AddEventHandler(func(_ context.Context, event *monitor.Event) {
+		klog.InfoS("Health transition", "gpu", event.GPU, "check", event.Check,
+			"healthy", event.Healthy, "message", event.Message)
+		if err := encoder.Encode(event); err != nil {
+			klog.ErrorS(err, "Failed to write event")
+		}
+	})
+	m.AddRunHandler(func(_ context.Context, run *monitor.Run) {
+		klog.V(2).InfoS("Diagnose finished", "duration", run.Duration)
+	})
+	if err := o.addReporter(m); err != nil {
+		return nil, err
+	}
+	if o.healthFile != "" {
+		publisher, err := health.NewPublisher(o.healthFile)
+		if err != nil {
+			return nil, err
+		}
+		m.AddRunHandler(func(_ context.Context, run *monitor.Run) {
+			if err := publisher.Publish(run); err != nil {
+				klog.ErrorS(err, "Failed to publish GPU health", "path", o.healthFile)
+			}
+		})
+	}
+
+	return m, nil
+}
+
+func NewMonitorCmd() *cobra.Command {
+	opts := &monitorOptions{}
+	var metricsAddress string
+
+	var command = &cobra.Command{
+		Use:   "monitor",
+		Short: "Periodically check the GPU in the machine and report health transitions.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := opts.newMonitor()
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signalContext()
+			defer stop()
+
+			if metricsAddress != "" {
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metrics.NewHandler(metrics.NewCollector(m.Latest)))
+				serveHTTP(ctx, metricsAddress, mux)
+			}
+
+			klog.InfoS("Monitor started", "interval", opts.interval, "jitter", opts.jitter)
+			if err := m.Start(ctx); err != nil {
+				return err
+			}
+			klog.InfoS("Monitor stopped")
+
+			return nil
+		},
+	}
+
+	opts.addFlags(command.Flags())
+	command.Flags().StringVar(&metricsAddress, "metrics-address", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9400, empty to disable")
+
+	return command
+}
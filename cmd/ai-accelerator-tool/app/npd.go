@@ -0,0 +1,39 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/npd"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func NewNPDConfigCmd() *cobra.Command {
+	opts := &npd.PluginConfigOptions{}
+
+	var command = &cobra.Command{
+		Use:   "npd-config",
+		Short: "Print a node-problem-detector custom plugin config running diagnose --npd.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := json.MarshalIndent(npd.NewPluginConfig(opts), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&opts.Path, "path", "/usr/local/bin/ai-accelerator-tool", "Path of ai-accelerator-tool on the node")
+	command.Flags().StringVar(&opts.InvokeInterval, "interval", "5m", "Interval between invocations of every rule")
+	command.Flags().StringVar(&opts.Timeout, "timeout", "1m", "Timeout of every invocation")
+	command.Flags().BoolVar(&opts.PerCheck, "per-check", false, "Generate a condition per check rather than per check group")
+	command.Flags().IntVar(&opts.CardCount, "card-count", 0, "Expected number of GPUs passed to every rule, "+utils.GPU_CARD_COUNT+" of node-problem-detector if 0")
+	command.Flags().StringVar(&opts.HostRoot, "plugin-host-root", "", "--host-root of every rule, where the host file system is mounted in the node-problem-detector container")
+	command.Flags().StringVar(&opts.HostExec, "plugin-host-exec", "", "--host-exec of every rule with --plugin-host-root, chroot or nsenter")
+
+	return command
+}
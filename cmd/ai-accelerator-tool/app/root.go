@@ -1,9 +1,18 @@
 package app
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+var (
+	hostRoot string
+	hostExec string
 )
 
 var rootCmd = &cobra.Command{
@@ -11,17 +20,48 @@ var rootCmd = &cobra.Command{
 	Short: "ai-accelerator-tool is a simple but powerful AI accelerator detection tool",
 	Long: "ai-accelerator-tool is a AI accelerator detection tool that supports detection of AI accelerators from " +
 		"different manufacturers",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if hostRoot == "" {
+			return nil
+		}
+		if _, err := utils.SetHostRoot(hostRoot, utils.HostExecMode(hostExec)); err != nil {
+			return fmt.Errorf("set host root failed: %s", err)
+		}
+		return nil
+	},
+}
+
+// exitCodeError makes the process exit with the given code, for commands whose
+// exit code is part of their output.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
 }
 
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&hostRoot, "host-root", "",
+		"Path the host file system is mounted at when running in a container, e.g. /host, host files are read and host binaries are executed under it")
+	rootCmd.PersistentFlags().StringVar(&hostExec, "host-exec", string(utils.HostExecChroot),
+		"How host binaries are executed with --host-root: chroot, or nsenter which requires hostPID")
+
 	rootCmd.AddCommand(NewDiagnoseCmd())
+	rootCmd.AddCommand(NewMonitorCmd())
+	rootCmd.AddCommand(NewServeCmd())
+	rootCmd.AddCommand(NewNPDConfigCmd())
 	rootCmd.AddCommand(NewVersionCmd())
 	rootCmd.AddCommand(NewMockCmd())
 }
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/server"
+)
+
+func NewServeCmd() *cobra.Command {
+	opts := &monitorOptions{}
+	var address string
+
+	var command = &cobra.Command{
+		Use:   "serve",
+		Short: "Periodically check the GPU in the machine and serve the results over HTTP.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := opts.newMonitor()
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signalContext()
+			defer stop()
+
+			serveHTTP(ctx, address, server.NewHandler(ctx, m))
+
+			klog.InfoS("Monitor started", "interval", opts.interval, "jitter", opts.jitter)
+			if err := m.Start(ctx); err != nil {
+				return err
+			}
+			klog.InfoS("Monitor stopped")
+
+			return nil
+		},
+	}
+
+	opts.addFlags(command.Flags())
+	command.Flags().StringVar(&address, "address", ":9400", "Address to serve the HTTP API and Prometheus metrics on")
+
+	return command
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// serveHTTP serves the handler in the background until the context is
+// cancelled.
+func serveHTTP(ctx context.Context, address string, handler http.Handler) {
+	srv := &http.Server{Addr: address, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		klog.InfoS("Serving HTTP", "address", address)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.ErrorS(err, "Failed to serve HTTP")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Failed to shut down HTTP server")
+		}
+	}()
+}
@@ -30,7 +30,7 @@ inline bool exist_file(const char *path) {
 
 inline bool exist_folder(const char *path) {
   struct stat buf;
-  return stat(path, &buf) == 0 && !(buf.st_mode & S_IFDIR);
+  return stat(path, &buf) == 0 && S_ISDIR(buf.st_mode);
 }
 
 inline std::string find_nth(std::string s, std::string sep, int n) {
@@ -94,10 +94,21 @@ inline conf_t *load_conf() {
   return conf;
 }
 
+// logFile is the log next to the config of GPU_MOCK_CONF_PATH, or in the
+// default folder. F is null if neither folder exists.
 class logFile {
 public:
-  FILE *F;
+  FILE *F = nullptr;
   logFile() {
+    if (auto env_path = std::getenv(CONF_PATH_ENV); env_path != nullptr) {
+      std::string dir = env_path;
+      auto pos = dir.find_last_of('/');
+      dir = pos == std::string::npos ? "." : dir.substr(0, pos);
+      if (exist_folder(dir.c_str())) {
+        F = fopen((dir + LOG_NAME).c_str(), "a");
+        return;
+      }
+    }
     if (exist_folder(concat(CONTAINER_HOST_MOUNT_PATH, DEFAULT_FOLDER))) {
       F = fopen(
           concat(concat(CONTAINER_HOST_MOUNT_PATH, DEFAULT_FOLDER), LOG_NAME),
@@ -0,0 +1,21 @@
+package v1
+
+import "time"
+
+// DeviceHealthList is the health of every GPU, published for device plugins
+// so that only failing devices are withdrawn from allocatable resources.
+type DeviceHealthList struct {
+	APIVersion string    `json:"apiVersion"`
+	Time       time.Time `json:"time"`
+	// Error is set if the diagnosis failed, the devices are then reported
+	// unhealthy since their health is unknown.
+	Error   string         `json:"error,omitempty"`
+	Devices []DeviceHealth `json:"devices"`
+}
+
+type DeviceHealth struct {
+	UUID    string `json:"uuid"`
+	Healthy bool   `json:"healthy"`
+	// Reason lists the failed checks of an unhealthy device.
+	Reason string `json:"reason,omitempty"`
+}
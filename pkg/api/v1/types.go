@@ -0,0 +1,148 @@
+// Package v1 defines the versioned JSON schema of diagnosis results served to
+// other components. Fields may be added, but never renamed or removed.
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+const APIVersion = "v1"
+
+// Report is the outcome of a diagnosis run.
+type Report struct {
+	APIVersion      string    `json:"apiVersion"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// Healthy is true if the run completed and every check is healthy.
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+	Vendor  string `json:"vendor,omitempty"`
+	// Overall holds the node level checks.
+	Overall []CheckResult `json:"overall"`
+	GPUs    []GPU         `json:"gpus"`
+}
+
+// GPU holds the checks of a single GPU.
+type GPU struct {
+	UUID string `json:"uuid"`
+	// Index is the nvidia-smi index, nil if unknown.
+	Index   *int          `json:"index,omitempty"`
+	Healthy bool          `json:"healthy"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewReport converts a run into a Report. Only the checks accepted by filter
+// are reported, a nil filter accepts every check.
+func NewReport(run *monitor.Run, filter func(diagnose.DiagnoseType) bool) *Report {
+	report := &Report{
+		APIVersion:      APIVersion,
+		Time:            run.Time,
+		DurationSeconds: run.Duration.Seconds(),
+		Healthy:         run.Err == nil,
+		Overall:         []CheckResult{},
+		GPUs:            []GPU{},
+	}
+	if run.Err != nil {
+		report.Error = run.Err.Error()
+	}
+	if run.Snapshot != nil {
+		report.Vendor = string(run.Snapshot.Vendor)
+	}
+
+	uuids := make([]string, 0, len(run.Results))
+	for uuid := range run.Results {
+		if uuid != diagnose.GPUUUIDOverall {
+			uuids = append(uuids, string(uuid))
+		}
+	}
+	sort.Strings(uuids)
+
+	var healthy bool
+	report.Overall, healthy = newCheckResults(run.Results[diagnose.GPUUUIDOverall], filter)
+	report.Healthy = report.Healthy && healthy
+	for _, uuid := range uuids {
+		gpu := GPU{UUID: uuid}
+		gpu.Checks, gpu.Healthy = newCheckResults(run.Results[diagnose.GPUUID(uuid)], filter)
+		if run.Snapshot != nil {
+			if snapshot, ok := run.Snapshot.GPUs[diagnose.GPUUID(uuid)]; ok {
+				index := snapshot.Index
+				gpu.Index = &index
+			}
+		}
+		report.Healthy = report.Healthy && gpu.Healthy
+		report.GPUs = append(report.GPUs, gpu)
+	}
+
+	return report
+}
+
+// Summary returns a human readable summary, listing every unhealthy check.
+func (r *Report) Summary() string {
+	if r.Error != "" {
+		return fmt.Sprintf("diagnose failed: %s", r.Error)
+	}
+
+	checks := len(r.Overall)
+	var problems []string
+	for _, check := range r.Overall {
+		if !check.Healthy {
+			problems = append(problems, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+	for _, gpu := range r.GPUs {
+		checks += len(gpu.Checks)
+		for _, check := range gpu.Checks {
+			if !check.Healthy {
+				problems = append(problems, fmt.Sprintf("%s %s: %s", gpu.UUID, check.Name, check.Message))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Sprintf("unhealthy: %s", strings.Join(problems, "; "))
+	}
+	return fmt.Sprintf("healthy: %d GPUs, %d checks", len(r.GPUs), checks)
+}
+
+// GPU returns the GPU with the given UUID, or nil if it is not reported.
+func (r *Report) GPU(uuid string) *GPU {
+	for i := range r.GPUs {
+		if r.GPUs[i].UUID == uuid {
+			return &r.GPUs[i]
+		}
+	}
+	return nil
+}
+
+func newCheckResults(results []*diagnose.DiagnoseResult, filter func(diagnose.DiagnoseType) bool) ([]CheckResult, bool) {
+	checks := []CheckResult{}
+	healthy := true
+	for _, result := range results {
+		if result == nil || result.IsHealthy == nil {
+			continue
+		}
+		if filter != nil && !filter(result.Name) {
+			continue
+		}
+		checks = append(checks, CheckResult{
+			Name:    string(result.Name),
+			Healthy: *result.IsHealthy,
+			Message: result.Message,
+		})
+		healthy = healthy && *result.IsHealthy
+	}
+
+	return checks, healthy
+}
@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func TestNewReport(t *testing.T) {
+	run := &monitor.Run{
+		Time:     time.Unix(1700000000, 0),
+		Duration: time.Second,
+		Results: map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			diagnose.GPUUUIDOverall: {
+				{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true), Message: "loaded"},
+			},
+			"GPU-uuid-2": {
+				{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+			},
+			"GPU-uuid-1": {
+				{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+				{Name: diagnose.DiagnoseGPUnrecoverableErrors, IsHealthy: utils.BoolPtr(false), Message: "found ecc errors: 2"},
+			},
+		},
+		Snapshot: &diagnose.Snapshot{
+			Vendor: utils.NvidiaVendor,
+			GPUs:   map[diagnose.GPUUID]*diagnose.GPUSnapshot{"GPU-uuid-1": {Index: 0}},
+		},
+	}
+
+	got := NewReport(run, nil)
+	assert.Equal(t, APIVersion, got.APIVersion)
+	assert.Equal(t, float64(1), got.DurationSeconds)
+	assert.Equal(t, "nvidia", got.Vendor)
+	assert.False(t, got.Healthy)
+	assert.Equal(t, []CheckResult{{Name: "gpu_driver_status", Healthy: true, Message: "loaded"}}, got.Overall)
+	assert.Len(t, got.GPUs, 2)
+	assert.Equal(t, "GPU-uuid-1", got.GPUs[0].UUID)
+	assert.Equal(t, 0, *got.GPUs[0].Index)
+	assert.False(t, got.GPUs[0].Healthy)
+	assert.Nil(t, got.GPUs[1].Index)
+	assert.True(t, got.GPUs[1].Healthy)
+	assert.Nil(t, got.GPU("GPU-uuid-9"))
+
+	// Unhealthy checks which are filtered out do not affect health.
+	got = NewReport(run, func(check diagnose.DiagnoseType) bool {
+		return check == diagnose.DiagnoseGPULinkStatus
+	})
+	assert.True(t, got.Healthy)
+	assert.Empty(t, got.Overall)
+	assert.Len(t, got.GPU("GPU-uuid-1").Checks, 1)
+
+	got = NewReport(&monitor.Run{Err: fmt.Errorf("card count mismatch")}, nil)
+	assert.False(t, got.Healthy)
+	assert.Equal(t, "card count mismatch", got.Error)
+	assert.NotNil(t, got.Overall)
+	assert.NotNil(t, got.GPUs)
+}
+
+func TestReportSummary(t *testing.T) {
+	report := &Report{
+		Overall: []CheckResult{{Name: "gpu_driver_status", Healthy: true}},
+		GPUs: []GPU{
+			{UUID: "GPU-uuid-1", Checks: []CheckResult{{Name: "gpu_link_status", Healthy: true}}},
+		},
+	}
+	assert.Equal(t, "healthy: 1 GPUs, 2 checks", report.Summary())
+
+	report.GPUs[0].Checks[0] = CheckResult{Name: "gpu_link_status", Message: "Link is not OK"}
+	assert.Equal(t, "unhealthy: GPU-uuid-1 gpu_link_status: Link is not OK", report.Summary())
+
+	report.Error = "card count mismatch"
+	assert.Equal(t, "diagnose failed: card count mismatch", report.Summary())
+}
@@ -0,0 +1,400 @@
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	containerdConfigFile = "/etc/containerd/config.toml"
+	dockerDaemonFile     = "/etc/docker/daemon.json"
+
+	nvidiaRuntimeName = "nvidia"
+	nvidiaRuntimeBin  = "nvidia-container-runtime"
+)
+
+// cdiSpecDirs are the directories container runtimes load CDI specs from.
+var cdiSpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+var (
+	// cdiKindRegexp matches a CDI kind, e.g. nvidia.com/gpu.
+	cdiKindRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?/[a-zA-Z0-9]([a-zA-Z0-9_.-]*[a-zA-Z0-9])?$`)
+	// cdiDeviceNameRegexp matches a CDI device name, e.g. 0, all or GPU-<uuid>.
+	cdiDeviceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.:-]*[a-zA-Z0-9])?$`)
+)
+
+// cdiSpec is the subset of a Container Device Interface spec that is validated.
+// See https://github.com/cncf-tags/container-device-interface/blob/main/SPEC.md.
+type cdiSpec struct {
+	Version        string            `yaml:"cdiVersion"`
+	Kind           string            `yaml:"kind"`
+	Devices        []cdiDevice       `yaml:"devices"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiDevice struct {
+	Name           string            `yaml:"name"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiContainerEdits struct {
+	Env         []string        `yaml:"env"`
+	DeviceNodes []cdiDeviceNode `yaml:"deviceNodes"`
+}
+
+type cdiDeviceNode struct {
+	Path     string `yaml:"path"`
+	HostPath string `yaml:"hostPath"`
+}
+
+// dockerDaemonConfig is the subset of /etc/docker/daemon.json that is checked.
+type dockerDaemonConfig struct {
+	DefaultRuntime string `json:"default-runtime"`
+	Runtimes       map[string]struct {
+		Path string `json:"path"`
+	} `json:"runtimes"`
+}
+
+// nvidiaContainerCLIInfo is the parsed output of `nvidia-container-cli info`.
+type nvidiaContainerCLIInfo struct {
+	DriverVersion string
+	UUIDs         []GPUUID
+}
+
+// checkNVIDIAContainerRuntime validates that containers can be given access to
+// the GPUs, through the NVIDIA container toolkit configured as a runtime of
+// containerd or docker, or through CDI specs. It returns nil if there is
+// neither containerd, docker nor a CDI spec on the host, e.g. on bare metal or
+// with CRI-O, whose OCI hooks are not checked.
+func (c *controller) checkNVIDIAContainerRuntime(ctx context.Context) *DiagnoseResult {
+	specs, cdiProblems := c.checkCDISpecs()
+	if len(specs) == 0 && len(cdiProblems) == 0 && !containerRuntimeInstalled() {
+		return nil
+	}
+
+	var problems, found []string
+
+	info, err := getNVIDIAContainerCLIInfo(ctx)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("nvidia-container-cli info failed: %s", err))
+	} else {
+		found = append(found, fmt.Sprintf("nvidia-container-cli (driver %s)", info.DriverVersion))
+		if len(info.UUIDs) != c.ExpectedCardCount {
+			problems = append(problems, fmt.Sprintf("nvidia-container-cli sees %d GPUs, expected %d", len(info.UUIDs), c.ExpectedCardCount))
+		}
+	}
+
+	runtimes := 0
+	ok, err := checkContainerdNVIDIARuntime()
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("containerd: %s", err))
+	case ok:
+		runtimes++
+		found = append(found, "containerd nvidia runtime")
+	}
+
+	ok, err = checkDockerNVIDIARuntime()
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("docker: %s", err))
+	case ok:
+		runtimes++
+		found = append(found, "docker nvidia runtime")
+	}
+
+	problems = append(problems, cdiProblems...)
+	if len(specs) > 0 {
+		runtimes++
+		found = append(found, fmt.Sprintf("cdi specs %s", strings.Join(specs, ",")))
+	}
+
+	if runtimes == 0 {
+		problems = append(problems, "no nvidia runtime is configured for containerd or docker and no cdi spec is found")
+	}
+
+	if len(problems) > 0 {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUContainerRuntime,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("Container runtime is not OK: %s", strings.Join(problems, "; ")),
+		}
+	}
+
+	return &DiagnoseResult{
+		Name:      DiagnoseGPUContainerRuntime,
+		IsHealthy: utils.BoolPtr(true),
+		Message:   fmt.Sprintf("Container runtime is OK: %s", strings.Join(found, ", ")),
+	}
+}
+
+func getNVIDIAContainerCLIInfo(ctx context.Context) (*nvidiaContainerCLIInfo, error) {
+	res, err := utils.ExecCmd(ctx, "nvidia-container-cli", []string{"info"})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(res))
+	}
+
+	return parseNVIDIAContainerCLIInfo(res)
+}
+
+// parseNVIDIAContainerCLIInfo parses output such as:
+//
+//	NVRM version:   535.104.05
+//	CUDA version:   12.2
+//
+//	Device Index:   0
+//	GPU UUID:       GPU-4d9d2a5c-2b6e-7d1f-5a2b-0e7c7a1b2c3d
+//	Bus Location:   00000000:07:00.0
+func parseNVIDIAContainerCLIInfo(out string) (*nvidiaContainerCLIInfo, error) {
+	info := &nvidiaContainerCLIInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "NVRM version":
+			info.DriverVersion = value
+		case "GPU UUID":
+			info.UUIDs = append(info.UUIDs, GPUUID(value))
+		}
+	}
+	if info.DriverVersion == "" {
+		return nil, fmt.Errorf("driver version not found in output %q", strings.TrimSpace(out))
+	}
+
+	return info, nil
+}
+
+// containerRuntimeInstalled returns whether containerd or docker, the runtimes
+// whose nvidia runtime is checked, is installed on the host.
+func containerRuntimeInstalled() bool {
+	for _, file := range []string{containerdConfigFile, dockerDaemonFile} {
+		if _, err := utils.Stat(file); err == nil {
+			return true
+		}
+	}
+
+	return utils.CommandExists("containerd") || utils.CommandExists("dockerd")
+}
+
+// checkContainerdNVIDIARuntime returns whether the containerd config has a
+// runtime named nvidia or a runtime using the nvidia-container-runtime binary,
+// and that the binary exists.
+func checkContainerdNVIDIARuntime() (bool, error) {
+	data, err := utils.ReadFile(containerdConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var cfg map[string]interface{}
+	if _, err := toml.Decode(string(data), &cfg); err != nil {
+		return false, fmt.Errorf("parse %s failed: %s", containerdConfigFile, err)
+	}
+
+	// The CRI plugin name differs between config versions, e.g.
+	// plugins."io.containerd.grpc.v1.cri".containerd.runtimes in version 2 and
+	// plugins."io.containerd.cri.v1.runtime".containerd.runtimes in version 3,
+	// so every runtimes table is searched.
+	for _, runtimes := range findTOMLTables(cfg, "runtimes") {
+		for name, value := range runtimes {
+			runtime, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			binary := ""
+			if options, ok := runtime["options"].(map[string]interface{}); ok {
+				binary, _ = options["BinaryName"].(string)
+			}
+			if name != nvidiaRuntimeName && !strings.Contains(binary, nvidiaRuntimeBin) {
+				continue
+			}
+			if binary == "" {
+				binary = nvidiaRuntimeBin
+			}
+			if !runtimeBinaryExists(binary) {
+				return false, fmt.Errorf("runtime %s references missing binary %s", name, binary)
+			}
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkDockerNVIDIARuntime returns whether the docker daemon config has a
+// runtime named nvidia, and that its binary exists.
+func checkDockerNVIDIARuntime() (bool, error) {
+	data, err := utils.ReadFile(dockerDaemonFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	cfg := &dockerDaemonConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return false, fmt.Errorf("parse %s failed: %s", dockerDaemonFile, err)
+	}
+
+	runtime, ok := cfg.Runtimes[nvidiaRuntimeName]
+	if !ok {
+		return false, nil
+	}
+	if !runtimeBinaryExists(runtime.Path) {
+		return false, fmt.Errorf("runtime %s references missing binary %s", nvidiaRuntimeName, runtime.Path)
+	}
+
+	return true, nil
+}
+
+// checkCDISpecs parses every CDI spec and validates it against the schema,
+// the host device nodes and the GPU UUIDs. It returns the names of the valid
+// specs and the problems found in the others.
+func (c *controller) checkCDISpecs() ([]string, []string) {
+	uuids := map[GPUUID]bool{}
+	for _, uuid := range c.gpuIDs {
+		uuids[uuid] = true
+	}
+
+	var valid, problems []string
+	for _, dir := range cdiSpecDirs {
+		entries, err := utils.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				problems = append(problems, fmt.Sprintf("read %s failed: %s", dir, err))
+			}
+			continue
+		}
+
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if err := validateCDISpec(path, uuids); err != nil {
+				problems = append(problems, fmt.Sprintf("cdi spec %s: %s", path, err))
+				continue
+			}
+			valid = append(valid, path)
+		}
+	}
+
+	return valid, problems
+}
+
+func validateCDISpec(path string, uuids map[GPUUID]bool) error {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is a subset of YAML, so both formats are parsed the same way.
+	spec := &cdiSpec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return fmt.Errorf("parse failed: %s", err)
+	}
+
+	if spec.Version == "" {
+		return fmt.Errorf("cdiVersion is missing")
+	}
+	if !cdiKindRegexp.MatchString(spec.Kind) {
+		return fmt.Errorf("invalid kind %q", spec.Kind)
+	}
+	if len(spec.Devices) == 0 {
+		return fmt.Errorf("no devices")
+	}
+
+	var problems []string
+	problems = append(problems, checkCDIDeviceNodes(spec.ContainerEdits.DeviceNodes)...)
+	names := map[string]bool{}
+	for _, device := range spec.Devices {
+		if !cdiDeviceNameRegexp.MatchString(device.Name) {
+			problems = append(problems, fmt.Sprintf("invalid device name %q", device.Name))
+			continue
+		}
+		if names[device.Name] {
+			problems = append(problems, fmt.Sprintf("duplicate device name %q", device.Name))
+		}
+		names[device.Name] = true
+
+		if strings.HasPrefix(device.Name, "GPU-") && len(uuids) > 0 && !uuids[GPUUID(device.Name)] {
+			problems = append(problems, fmt.Sprintf("device %s references unknown gpu uuid", device.Name))
+		}
+		for _, node := range checkCDIDeviceNodes(device.ContainerEdits.DeviceNodes) {
+			problems = append(problems, fmt.Sprintf("device %s: %s", device.Name, node))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+func checkCDIDeviceNodes(nodes []cdiDeviceNode) []string {
+	var problems []string
+	for _, node := range nodes {
+		if node.Path == "" {
+			problems = append(problems, "device node without path")
+			continue
+		}
+		hostPath := node.HostPath
+		if hostPath == "" {
+			hostPath = node.Path
+		}
+		if _, err := utils.Stat(hostPath); err != nil {
+			problems = append(problems, fmt.Sprintf("device node %s does not exist", hostPath))
+		}
+	}
+
+	return problems
+}
+
+// findTOMLTables returns every table stored under the given key at any depth.
+func findTOMLTables(table map[string]interface{}, key string) []map[string]interface{} {
+	var res []map[string]interface{}
+	for k, v := range table {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if k == key {
+			res = append(res, child)
+			continue
+		}
+		res = append(res, findTOMLTables(child, key)...)
+	}
+
+	return res
+}
+
+// runtimeBinaryExists returns whether the given binary, either an absolute
+// path or a name looked up in the executable path, exists.
+func runtimeBinaryExists(binary string) bool {
+	if filepath.IsAbs(binary) {
+		_, err := utils.Stat(binary)
+		return err == nil
+	}
+
+	return utils.CommandExists(binary)
+}
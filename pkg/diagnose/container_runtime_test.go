@@ -0,0 +1,235 @@
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const testNVIDIAContainerCLIInfo = `NVRM version:   535.104.05
+CUDA version:   12.2
+
+Device Index:   0
+Device Minor:   0
+Model:          NVIDIA A100-SXM4-80GB
+GPU UUID:       GPU-uuid-1
+Bus Location:   00000000:07:00.0
+
+Device Index:   1
+Device Minor:   1
+Model:          NVIDIA A100-SXM4-80GB
+GPU UUID:       GPU-uuid-2
+Bus Location:   00000000:0F:00.0
+`
+
+const testContainerdConfig = `version = 2
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      default_runtime_name = "nvidia"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes]
+        [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]
+          runtime_type = "io.containerd.runc.v2"
+          [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia.options]
+            BinaryName = "/usr/bin/nvidia-container-runtime"
+`
+
+const testCDISpec = `cdiVersion: 0.5.0
+kind: nvidia.com/gpu
+devices:
+- name: "0"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia0
+- name: GPU-uuid-1
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia0
+containerEdits:
+  deviceNodes:
+  - path: /dev/nvidiactl
+`
+
+func writeTestFile(t *testing.T, root, path, content string) {
+	t.Helper()
+
+	fullPath := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestParseNVIDIAContainerCLIInfo(t *testing.T) {
+	got, err := parseNVIDIAContainerCLIInfo(testNVIDIAContainerCLIInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "535.104.05", got.DriverVersion)
+	assert.Equal(t, []GPUUID{"GPU-uuid-1", "GPU-uuid-2"}, got.UUIDs)
+
+	_, err = parseNVIDIAContainerCLIInfo("nvidia-container-cli: initialization error: nvml error: driver not loaded")
+	assert.Error(t, err)
+}
+
+func TestValidateCDISpec(t *testing.T) {
+	tests := []struct {
+		name            string
+		spec            string
+		wantErr         bool
+		wantErrContains string
+	}{
+		{
+			name: "valid spec",
+			spec: testCDISpec,
+		},
+		{
+			name:            "missing version",
+			spec:            "kind: nvidia.com/gpu\ndevices:\n- name: \"0\"\n",
+			wantErr:         true,
+			wantErrContains: "cdiVersion is missing",
+		},
+		{
+			name:            "invalid kind",
+			spec:            "cdiVersion: 0.5.0\nkind: gpu\ndevices:\n- name: \"0\"\n",
+			wantErr:         true,
+			wantErrContains: `invalid kind "gpu"`,
+		},
+		{
+			name: "unknown uuid and missing device node",
+			spec: `{"cdiVersion": "0.5.0", "kind": "nvidia.com/gpu", "devices": [
+				{"name": "GPU-uuid-9", "containerEdits": {"deviceNodes": [{"path": "/dev/nvidia9"}]}}]}`,
+			wantErr:         true,
+			wantErrContains: "device GPU-uuid-9 references unknown gpu uuid, device GPU-uuid-9: device node /dev/nvidia9 does not exist",
+		},
+		{
+			name:            "unparsable spec",
+			spec:            "cdiVersion: [",
+			wantErr:         true,
+			wantErrContains: "parse failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestFile(t, root, "/dev/nvidia0", "")
+			writeTestFile(t, root, "/dev/nvidiactl", "")
+			writeTestFile(t, root, "/etc/cdi/nvidia.yaml", tt.spec)
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			err := validateCDISpec("/etc/cdi/nvidia.yaml", map[GPUUID]bool{"GPU-uuid-1": true})
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErrContains)
+		})
+	}
+}
+
+func TestCheckNVIDIAContainerRuntime(t *testing.T) {
+	tests := []struct {
+		name            string
+		files           map[string]string
+		cliOutput       string
+		wantNil         bool
+		wantHealthy     bool
+		wantMsgContains []string
+	}{
+		{
+			name: "containerd runtime configured",
+			files: map[string]string{
+				containerdConfigFile:                testContainerdConfig,
+				"/usr/bin/nvidia-container-runtime": "",
+			},
+			cliOutput:       testNVIDIAContainerCLIInfo,
+			wantHealthy:     true,
+			wantMsgContains: []string{"nvidia-container-cli (driver 535.104.05)", "containerd nvidia runtime"},
+		},
+		{
+			name: "docker runtime and cdi spec",
+			files: map[string]string{
+				dockerDaemonFile:                    `{"runtimes": {"nvidia": {"path": "/usr/bin/nvidia-container-runtime"}}}`,
+				"/usr/bin/nvidia-container-runtime": "",
+				"/var/run/cdi/nvidia.yaml":          testCDISpec,
+				"/dev/nvidia0":                      "",
+				"/dev/nvidiactl":                    "",
+			},
+			cliOutput:       testNVIDIAContainerCLIInfo,
+			wantHealthy:     true,
+			wantMsgContains: []string{"docker nvidia runtime", "cdi specs /var/run/cdi/nvidia.yaml"},
+		},
+		{
+			name: "runtime binary missing",
+			files: map[string]string{
+				containerdConfigFile: testContainerdConfig,
+			},
+			cliOutput:   testNVIDIAContainerCLIInfo,
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"containerd: runtime nvidia references missing binary /usr/bin/nvidia-container-runtime",
+				"no nvidia runtime is configured",
+			},
+		},
+		{
+			name: "toolkit not installed",
+			files: map[string]string{
+				dockerDaemonFile: "{}",
+			},
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"nvidia-container-cli info failed",
+				"no nvidia runtime is configured",
+			},
+		},
+		{
+			name:      "no container runtime",
+			files:     map[string]string{},
+			cliOutput: testNVIDIAContainerCLIInfo,
+			wantNil:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for path, content := range tt.files {
+				writeTestFile(t, root, path, content)
+			}
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			commands := map[string]string{}
+			if tt.cliOutput != "" {
+				commands["nvidia-container-cli info"] = tt.cliOutput
+			}
+			mock := &mockExecCmd{commands: commands}
+			cleanup := utils.SetExecCmd(mock.exec)
+			defer cleanup()
+
+			c := &controller{
+				ExpectedCardCount: 2,
+				gpuIDs:            map[int]GPUUID{0: "GPU-uuid-1", 1: "GPU-uuid-2"},
+			}
+			got := c.checkNVIDIAContainerRuntime(context.Background())
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.NotNil(t, got)
+			assert.Equal(t, DiagnoseGPUContainerRuntime, got.Name)
+			assert.Equal(t, tt.wantHealthy, *got.IsHealthy, got.Message)
+			for _, want := range tt.wantMsgContains {
+				assert.Contains(t, got.Message, want)
+			}
+		})
+	}
+}
@@ -9,12 +9,56 @@ import (
 
 type Config struct {
 	ExpectedCardCount int
+
+	// VisibleDevices scopes the checks to the GPUs with the given nvidia-smi
+	// indices or UUIDs, e.g. from VisibleDevicesFromEnv. ExpectedCardCount
+	// defaults to their count.
+	VisibleDevices []string
+	// ContainerScoped scopes the checks to the GPUs listed by nvidia-smi, or
+	// to VisibleDevices among them, and skips the node checks. In a container
+	// sysfs lists every GPU of the node while nvidia-smi lists only the GPUs
+	// allocated to it.
+	ContainerScoped bool
+
+	// AERThresholds overrides the tolerated PCIe AER error counts, defaults to
+	// DefaultAERThresholds if nil.
+	AERThresholds *AERThresholds
+
+	// ExpectedRDMAPortCount is the number of active RDMA ports, 0 skips the
+	// check of the port count and the RDMA check entirely if there are no RDMA
+	// devices. Inactive ports fail the check only if the port count or rate
+	// is expected.
+	ExpectedRDMAPortCount int
+	// ExpectedRDMARate is the minimum link rate of every RDMA port in Gb/s, 0
+	// skips the check.
+	ExpectedRDMARate int
+	// RDMAThresholds overrides the tolerated RDMA port error counts, defaults
+	// to DefaultRDMAThresholds if nil.
+	RDMAThresholds *RDMAThresholds
 }
 
 type controller struct {
-	ExpectedCardCount int
+	ExpectedCardCount     int
+	AERThresholds         AERThresholds
+	ExpectedRDMAPortCount int
+	ExpectedRDMARate      int
+	RDMAThresholds        RDMAThresholds
+
+	visibleDevices []string
+	// scoped is whether the checks are scoped to the GPUs of the container.
+	scoped bool
 
-	gpuIDs map[int]GPUUID
+	vendor       utils.VendorType
+	gpuIDs       map[int]GPUUID
+	gpuBusIDs    map[int]string
+	gpuSnapshots map[int]*GPUSnapshot
+	// visibleIndexes and visibleBusIDs are the resolved VisibleDevices, nil
+	// if all GPUs are checked.
+	visibleIndexes []int
+	visibleBusIDs  map[string]bool
+	// knownGPUIDs are the UUIDs of the GPUs by bus id listed by nvidia-smi in
+	// any run, to name the GPUs which fell off the bus since.
+	knownGPUIDs map[string]GPUUID
 }
 
 func NewController(cfg *Config) (Diagnoser, error) {
@@ -22,13 +66,40 @@ func NewController(cfg *Config) (Diagnoser, error) {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
-	if cfg.ExpectedCardCount <= 0 {
-		return nil, fmt.Errorf("expected card count must be positive, got %d", cfg.ExpectedCardCount)
+	expectedCardCount := cfg.ExpectedCardCount
+	if expectedCardCount == 0 {
+		expectedCardCount = len(cfg.VisibleDevices)
+	}
+	if expectedCardCount <= 0 {
+		return nil, fmt.Errorf("expected card count must be positive, got %d", expectedCardCount)
+	}
+	if len(cfg.VisibleDevices) > 0 && expectedCardCount != len(cfg.VisibleDevices) {
+		return nil, fmt.Errorf("expected card count %d does not match %d visible devices", expectedCardCount, len(cfg.VisibleDevices))
+	}
+
+	if cfg.ExpectedRDMAPortCount < 0 {
+		return nil, fmt.Errorf("expected rdma port count must not be negative, got %d", cfg.ExpectedRDMAPortCount)
+	}
+
+	aerThresholds := DefaultAERThresholds
+	if cfg.AERThresholds != nil {
+		aerThresholds = *cfg.AERThresholds
+	}
+	rdmaThresholds := DefaultRDMAThresholds
+	if cfg.RDMAThresholds != nil {
+		rdmaThresholds = *cfg.RDMAThresholds
 	}
 
 	return &controller{
-		ExpectedCardCount: cfg.ExpectedCardCount,
-		gpuIDs:            make(map[int]GPUUID),
+		ExpectedCardCount:     expectedCardCount,
+		visibleDevices:        cfg.VisibleDevices,
+		scoped:                cfg.ContainerScoped || len(cfg.VisibleDevices) > 0,
+		AERThresholds:         aerThresholds,
+		ExpectedRDMAPortCount: cfg.ExpectedRDMAPortCount,
+		ExpectedRDMARate:      cfg.ExpectedRDMARate,
+		RDMAThresholds:        rdmaThresholds,
+		gpuIDs:                make(map[int]GPUUID),
+		gpuBusIDs:             make(map[int]string),
 	}, nil
 }
 
@@ -38,6 +109,7 @@ func (c *controller) Check(ctx context.Context) (map[GPUUID][]*DiagnoseResult, e
 		return nil, err
 	}
 
+	c.vendor = env.Vendor
 	switch env.Vendor {
 	case utils.NvidiaVendor:
 		return c.checkNVIDIA(ctx)
@@ -116,8 +116,7 @@ func TestCheck(t *testing.T) {
 			mockPipeCmds: map[string]string{
 				"nvidia-smi -L | wc -l": "2",
 			},
-			wantErr:         true,
-			wantErrContains: "GPU card count mismatch: got 2, expected 4",
+			wantErr: false,
 		},
 		{
 			name:              "unsupported vendor",
@@ -173,6 +172,14 @@ func TestCheck(t *testing.T) {
 				assert.Contains(t, results, GPUUID("GPU-uuid-1"))
 				assert.Contains(t, results, GPUUID("GPU-uuid-2"))
 			}
+
+			// A card count mismatch is reported as unhealthy, not as an error.
+			if tt.name == "card count mismatch" {
+				cardCountResult := results[GPUUUIDOverall][1]
+				assert.Equal(t, DiagnoseGPUCardCount, cardCountResult.Name)
+				assert.False(t, *cardCountResult.IsHealthy)
+				assert.Equal(t, "GPU Card Count: 2, Expected: 4", cardCountResult.Message)
+			}
 		})
 	}
 }
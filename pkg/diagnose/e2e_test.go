@@ -0,0 +1,194 @@
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock"
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock/fakesmi"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// TestMain runs the test binary as the fake nvidia-smi when it is invoked
+// through the nvidia-smi link of the end-to-end tests.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "nvidia-smi" {
+		os.Exit(fakesmi.Main(os.Args[1:], os.Stdout, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+const e2eHealthyConfig = `version = "0.1.0"
+[gpus]
+card_count = 2
+[gpus.0]
+pci = "3b:00"
+uuid = "GPU-0"
+[gpus.1]
+pci = "86:00"
+uuid = "GPU-1"
+`
+
+// setupFakeNVIDIA runs the diagnosis against the fake nvidia-smi with the given
+// mock config, and a fake sysfs and procfs with GPUs at the given bus ids.
+func setupFakeNVIDIA(t *testing.T, config string, busIDs ...string) {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get test executable: %v", err)
+	}
+	bin := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(bin, "nvidia-smi")); err != nil {
+		t.Fatalf("failed to link nvidia-smi: %v", err)
+	}
+	lspci := "#!/bin/sh\necho '3b:00.0 3D controller: NVIDIA Corporation Device 20b2'\n"
+	if err := os.WriteFile(filepath.Join(bin, "lspci"), []byte(lspci), 0755); err != nil {
+		t.Fatalf("failed to write lspci: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	confPath := filepath.Join(t.TempDir(), "gpu_mock_conf.toml")
+	if err := os.WriteFile(confPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write mock config: %v", err)
+	}
+	t.Setenv(mock.EnvConfPath, confPath)
+
+	root := t.TempDir()
+	t.Cleanup(utils.SetFSRoot(root))
+	for _, busID := range busIDs {
+		newFakeNVIDIADevice(t, root, busID, "0x030200")
+		if err := os.MkdirAll(filepath.Join(root, procNVIDIAGPUsDir, busID), 0755); err != nil {
+			t.Fatalf("failed to create driver gpu dir: %v", err)
+		}
+	}
+}
+
+// findResult returns the result of the given check, nil if it did not run.
+func findResult(results []*DiagnoseResult, name DiagnoseType) *DiagnoseResult {
+	for _, res := range results {
+		if res.Name == name {
+			return res
+		}
+	}
+	return nil
+}
+
+func TestCheckNVIDIAEndToEnd(t *testing.T) {
+	// Results of these checks only depend on nvidia-smi and the bus.
+	checked := map[DiagnoseType]bool{
+		DiagnoseGPUDriverStatus:       true,
+		DiagnoseGPUCardCount:          true,
+		DiagnoseGPUBusPresence:        true,
+		DiagnoseGPULinkStatus:         true,
+		DiagnoseGPUnrecoverableErrors: true,
+		DiagnoseGPURecoverableErrors:  true,
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		busIDs []string
+		// wantUnhealthy maps the unhealthy checks of every GPU to a part of
+		// their message, all other checks must be healthy.
+		wantUnhealthy map[GPUUID]map[DiagnoseType]string
+		// wantChecked are the GPUs whose checks must have run.
+		wantChecked []GPUUID
+	}{
+		{
+			name:   "healthy",
+			config: e2eHealthyConfig,
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+		},
+		{
+			name:   "link width x8",
+			config: e2eHealthyConfig + "link_width_current = 8\n",
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+			wantUnhealthy: map[GPUUID]map[DiagnoseType]string{
+				"GPU-1": {DiagnoseGPULinkStatus: "max: 16, current: 8"},
+			},
+		},
+		{
+			name:   "double bit retired page",
+			config: e2eHealthyConfig + "retired_page_dbe = 1\n",
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+			wantUnhealthy: map[GPUUID]map[DiagnoseType]string{
+				"GPU-1": {DiagnoseGPUnrecoverableErrors: "found retired page: 0x0000000200001000, Double Bit ECC"},
+			},
+		},
+		{
+			name:   "uncorrectable and correctable ecc errors",
+			config: e2eHealthyConfig + "dram_ue = 2\ndram_ce = 3\n",
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+			wantUnhealthy: map[GPUUID]map[DiagnoseType]string{
+				"GPU-1": {
+					DiagnoseGPUnrecoverableErrors: "found ecc errors: 2",
+					DiagnoseGPURecoverableErrors:  "found ecc errors: 3",
+				},
+			},
+		},
+		{
+			name:   "nvml init fails",
+			config: "version = \"0.1.0\"\n[gpus]\nnvml_init_error = 9\n",
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+			wantUnhealthy: map[GPUUID]map[DiagnoseType]string{
+				GPUUUIDOverall: {DiagnoseGPUDriverStatus: "couldn't communicate with the NVIDIA driver"},
+			},
+		},
+		{
+			name:   "gpu missing from nvidia-smi",
+			config: "version = \"0.1.0\"\n[gpus]\ncard_count = 1\n[gpus.0]\npci = \"3b:00\"\nuuid = \"GPU-0\"\n",
+			busIDs: []string{"0000:3b:00.0", "0000:86:00.0"},
+			wantUnhealthy: map[GPUUID]map[DiagnoseType]string{
+				GPUUUIDOverall: {
+					DiagnoseGPUCardCount:   "GPU Card Count: 1, Expected: 2",
+					DiagnoseGPUBusPresence: "GPU fallen off the bus: 0000:86:00.0 is on pci but missing from nvidia-smi",
+				},
+				"0000:86:00.0": {DiagnoseGPUBusPresence: "is on pci but missing from nvidia-smi"},
+			},
+			wantChecked: []GPUUID{"GPU-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupFakeNVIDIA(t, tt.config, tt.busIDs...)
+
+			c, err := NewController(&Config{ExpectedCardCount: 2})
+			assert.NoError(t, err)
+			results, err := c.Check(context.Background())
+			assert.NoError(t, err)
+			for _, gpuID := range tt.wantChecked {
+				assert.NotNil(t, findResult(results[gpuID], DiagnoseGPULinkStatus), "%s not checked", gpuID)
+			}
+
+			found := 0
+			for gpuID, gpuResults := range results {
+				for _, res := range gpuResults {
+					if !checked[res.Name] {
+						continue
+					}
+					if msg, ok := tt.wantUnhealthy[gpuID][res.Name]; ok {
+						found++
+						assert.False(t, *res.IsHealthy, "%s of %s should be unhealthy", res.Name, gpuID)
+						assert.Contains(t, res.Message, msg)
+					} else {
+						assert.True(t, *res.IsHealthy, "%s of %s should be healthy: %s", res.Name, gpuID, res.Message)
+					}
+				}
+			}
+			want := 0
+			for _, unhealthy := range tt.wantUnhealthy {
+				want += len(unhealthy)
+			}
+			assert.Equal(t, want, found, "unhealthy checks not found")
+			if tt.wantUnhealthy == nil {
+				assert.Len(t, results, 3)
+			}
+		})
+	}
+}
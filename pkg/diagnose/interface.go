@@ -6,12 +6,33 @@ type DiagnoseType string
 
 const (
 	DiagnoseGPUDriverStatus       DiagnoseType = "gpu_driver_status"
+	DiagnoseGPUKernelModules      DiagnoseType = "gpu_kernel_modules"
+	DiagnoseGPUDeviceNodes        DiagnoseType = "gpu_device_nodes"
 	DiagnoseGPUCardCount          DiagnoseType = "gpu_card_count"
+	DiagnoseGPUBusPresence        DiagnoseType = "gpu_bus_presence"
 	DiagnoseGPULinkStatus         DiagnoseType = "gpu_link_status"
 	DiagnoseGPUnrecoverableErrors DiagnoseType = "gpu_vram_unrecoverable_errors"
 	DiagnoseGPURecoverableErrors  DiagnoseType = "gpu_vram_recoverable_errors"
+	DiagnoseGPUPCIeAERErrors      DiagnoseType = "gpu_pcie_aer_errors"
+	DiagnoseGPUContainerRuntime   DiagnoseType = "gpu_container_runtime"
+	DiagnoseRDMADeviceStatus      DiagnoseType = "rdma_device_status"
 )
 
+// AllDiagnoseTypes lists every check, in the order they are run.
+var AllDiagnoseTypes = []DiagnoseType{
+	DiagnoseGPUDriverStatus,
+	DiagnoseGPUKernelModules,
+	DiagnoseGPUDeviceNodes,
+	DiagnoseGPUCardCount,
+	DiagnoseGPUBusPresence,
+	DiagnoseGPULinkStatus,
+	DiagnoseGPUnrecoverableErrors,
+	DiagnoseGPURecoverableErrors,
+	DiagnoseGPUPCIeAERErrors,
+	DiagnoseGPUContainerRuntime,
+	DiagnoseRDMADeviceStatus,
+}
+
 type GPUUID string
 
 const (
@@ -11,6 +11,10 @@ import (
 
 func (c *controller) checkNVIDIA(ctx context.Context) (map[GPUUID][]*DiagnoseResult, error) {
 	results := map[GPUUID][]*DiagnoseResult{}
+	// The controller may be reused for periodic runs, GPUs may have changed since.
+	c.gpuIDs = map[int]GPUUID{}
+	c.gpuBusIDs = map[int]string{}
+	c.gpuSnapshots = map[int]*GPUSnapshot{}
 
 	// 1. Check driver status
 	resGPUDriver, err := c.checkNVIDIAGPUDriverStatus(ctx)
@@ -19,29 +23,68 @@ func (c *controller) checkNVIDIA(ctx context.Context) (map[GPUUID][]*DiagnoseRes
 	}
 	results[GPUUUIDOverall] = []*DiagnoseResult{resGPUDriver}
 	if !*resGPUDriver.IsHealthy {
+		// Explain why the driver is unhealthy.
+		results[GPUUUIDOverall] = append(results[GPUUUIDOverall], c.checkNVIDIAHostStatus()...)
 		return results, nil
 	}
 
-	// 2. Get GPU count
+	// 2. Get GPU count, only the visible devices count if the checks are scoped.
 	gpuCardCount, err := c.getNVIDIAGPUCardCount(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("getNVIDIAGPUCardCount() failed: %s", err)
 	}
+	c.visibleIndexes = nil
+	c.visibleBusIDs = nil
+	var missingDevices []string
+	if c.scoped {
+		missingDevices, err = c.resolveVisibleDevices(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("resolveVisibleDevices() failed: %s", err)
+		}
+		gpuCardCount = len(c.visibleIndexes)
+	}
 
-	// 3. Check card count BEFORE getting UUIDs
-	resCard, err := c.checkNVIDIACardCount(gpuCardCount)
+	// 3. Cross-reference PCI, driver and nvidia-smi, since the card count above
+	// only reflects what nvidia-smi can see.
+	resBus, busGPUResults, err := c.checkNVIDIAGPUBusPresence(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("checkNVIDIACardCount() failed: %s", err)
+		return nil, fmt.Errorf("checkNVIDIAGPUBusPresence() failed: %s", err)
+	}
+
+	// 4. Check card count BEFORE getting UUIDs
+	resCard := c.checkNVIDIACardCount(gpuCardCount)
+	if len(missingDevices) > 0 {
+		resCard.Message += fmt.Sprintf(", visible devices not found: %s", strings.Join(missingDevices, ", "))
+		for _, device := range missingDevices {
+			if strings.HasPrefix(device, "GPU-") {
+				results[GPUUID(device)] = append(results[GPUUID(device)], &DiagnoseResult{
+					Name:      DiagnoseGPUCardCount,
+					IsHealthy: utils.BoolPtr(false),
+					Message:   fmt.Sprintf("visible device %s not found", device),
+				})
+			}
+		}
 	}
-	results[GPUUUIDOverall] = append(results[GPUUUIDOverall], resCard)
-	if !*resCard.IsHealthy {
-		return results, nil
+	results[GPUUUIDOverall] = append(results[GPUUUIDOverall], resCard, resBus)
+	results[GPUUUIDOverall] = append(results[GPUUUIDOverall], c.checkNVIDIAHostStatus()...)
+	for gpuID, res := range busGPUResults {
+		results[gpuID] = append(results[gpuID], res)
 	}
 
-	// 4. Only get GPU UUIDs if card count is correct
-	c.gpuIDs, err = c.getNVIDIAGPUsID(ctx, gpuCardCount)
-	if err != nil {
-		return nil, fmt.Errorf("getNVIDIAGPUsID() failed: %s", err)
+	// 5. Get GPU UUIDs, visible devices are already resolved to UUIDs. If the
+	// card count is wrong the indices may not be contiguous, so the GPUs
+	// nvidia-smi lists are checked.
+	switch {
+	case c.visibleIndexes != nil:
+	case *resCard.IsHealthy:
+		c.gpuIDs, err = c.getNVIDIAGPUsID(ctx, gpuCardCount)
+		if err != nil {
+			return nil, fmt.Errorf("getNVIDIAGPUsID() failed: %s", err)
+		}
+	default:
+		for index, busID := range c.gpuBusIDs {
+			c.gpuIDs[index] = c.knownGPUIDs[busID]
+		}
 	}
 
 	// CHECK: GPU Link Status.
@@ -56,6 +99,27 @@ func (c *controller) checkNVIDIA(ctx context.Context) (map[GPUUID][]*DiagnoseRes
 		return nil, fmt.Errorf("checkNVIDIACard failed: %s", err)
 	}
 
+	// CHECK: GPU PCIe AER Errors.
+	err = c.checkNVIDIAGPUsPCIeAER(ctx, results)
+	if err != nil {
+		return nil, fmt.Errorf("checkNVIDIAGPUsPCIeAER failed: %s", err)
+	}
+
+	// The container runtime and RDMA devices are checked for the node, not
+	// from a pod scoped to its GPUs, which sees neither the runtime config nor
+	// the devices of other pods.
+	if !c.scoped {
+		// CHECK: Container Runtime GPU Enablement.
+		if resRuntime := c.checkNVIDIAContainerRuntime(ctx); resRuntime != nil {
+			results[GPUUUIDOverall] = append(results[GPUUUIDOverall], resRuntime)
+		}
+
+		// CHECK: RDMA Device Status.
+		if resRDMA := c.checkRDMADevices(ctx); resRDMA != nil {
+			results[GPUUUIDOverall] = append(results[GPUUUIDOverall], resRDMA)
+		}
+	}
+
 	// CHECK: GPU Other Status.
 
 	return results, nil
@@ -63,19 +127,21 @@ func (c *controller) checkNVIDIA(ctx context.Context) (map[GPUUID][]*DiagnoseRes
 
 func (c *controller) checkNVIDIAGPUDriverStatus(ctx context.Context) (*DiagnoseResult, error) {
 	res, err := utils.ExecCmd(ctx, "nvidia-smi", []string{"-L"})
-	if err != nil {
+	// nvidia-smi exits with non-zero code if it fails to communicate with the
+	// driver, the message explains why.
+	if strings.Contains(res, "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver") {
 		return &DiagnoseResult{
 			Name:      DiagnoseGPUDriverStatus,
 			IsHealthy: utils.BoolPtr(false),
-			Message:   fmt.Sprintf("checkNVIDIAGPUDriverStatus() failed: %s", err),
+			Message:   res,
 		}, nil
 	}
 
-	if strings.Contains(res, "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver") {
+	if err != nil {
 		return &DiagnoseResult{
 			Name:      DiagnoseGPUDriverStatus,
 			IsHealthy: utils.BoolPtr(false),
-			Message:   res,
+			Message:   fmt.Sprintf("checkNVIDIAGPUDriverStatus() failed: %s", err),
 		}, nil
 	}
 
@@ -86,24 +152,24 @@ func (c *controller) checkNVIDIAGPUDriverStatus(ctx context.Context) (*DiagnoseR
 	}, nil
 }
 
-func (c *controller) checkNVIDIACardCount(cardCount int) (*DiagnoseResult, error) {
+func (c *controller) checkNVIDIACardCount(cardCount int) *DiagnoseResult {
 	if c.ExpectedCardCount != cardCount {
 		return &DiagnoseResult{
 			Name:      DiagnoseGPUCardCount,
 			IsHealthy: utils.BoolPtr(false),
 			Message:   fmt.Sprintf("GPU Card Count: %d, Expected: %d", cardCount, c.ExpectedCardCount),
-		}, fmt.Errorf("GPU card count mismatch: got %d, expected %d", cardCount, c.ExpectedCardCount)
+		}
 	}
 
 	return &DiagnoseResult{
 		Name:      DiagnoseGPUCardCount,
 		IsHealthy: utils.BoolPtr(true),
 		Message:   fmt.Sprintf("GPU Card Count: %d", cardCount),
-	}, nil
+	}
 }
 
 func (c *controller) checkNVIDIAGPUsLinkStatus(ctx context.Context, results map[GPUUID][]*DiagnoseResult) error {
-	for i := 0; i < c.ExpectedCardCount; i++ {
+	for _, i := range c.gpuIndexes() {
 		gpuID := c.gpuIDs[i]
 		msg := ""
 
@@ -123,7 +189,7 @@ func (c *controller) checkNVIDIAGPUsLinkStatus(ctx context.Context, results map[
 }
 
 func (c *controller) checkNVIDIAVRAMStatus(ctx context.Context, results map[GPUUID][]*DiagnoseResult) error {
-	for i := 0; i < c.ExpectedCardCount; i++ {
+	for _, i := range c.gpuIndexes() {
 		gpuID := c.gpuIDs[i]
 		msg := ""
 
@@ -167,6 +233,10 @@ func (c *controller) checkNVIDIAGPULinkStatus(ctx context.Context, cardIdx int)
 	}
 	curLinkWidth = strings.TrimSpace(curLinkWidth)
 
+	gpu := c.gpuSnapshot(cardIdx)
+	gpu.LinkWidthMax = parseNVIDIASMIInt(maxLinkWidth)
+	gpu.LinkWidthCurrent = parseNVIDIASMIInt(curLinkWidth)
+
 	if maxLinkWidth != curLinkWidth {
 		return fmt.Errorf("link width is not ok, max: %s, current: %s", maxLinkWidth, curLinkWidth)
 	}
@@ -216,16 +286,12 @@ func (c *controller) getNVIDIAGPUsID(ctx context.Context, cardCount int) (map[in
 
 func (c *controller) checkNVIDIAVRAMUnrecoverableErrors(ctx context.Context, cardIdx int) error {
 	// Check VRAM Page Retirement.
-	resRetirement, err := utils.ExecPipeCmd(ctx, []string{"nvidia-smi -i " + strconv.Itoa(cardIdx) + " --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader", "grep -i 'Double Bit ECC'"})
+	retiredPages, err := getNVIDIARetiredPages(ctx, cardIdx, "Double Bit ECC")
 	if err != nil {
 		return fmt.Errorf("get retired pages failed: %s", err)
 	}
-	retiredPages := strings.Split(strings.TrimSpace(resRetirement), "\n")
-	for _, page := range retiredPages {
-		page = strings.TrimSpace(page)
-		if !strings.Contains(page, "N/A") {
-			return fmt.Errorf("found retired page: %s", page)
-		}
+	if len(retiredPages) > 0 {
+		return fmt.Errorf("found retired page: %s", retiredPages[0])
 	}
 
 	// Check ECC Errors.
@@ -241,6 +307,7 @@ func (c *controller) checkNVIDIAVRAMUnrecoverableErrors(ctx context.Context, car
 		return fmt.Errorf("get ecc errors failed: %s", err)
 	}
 	counts := strings.TrimSpace(eccCounts)
+	c.gpuSnapshot(cardIdx).ECCUncorrected = parseNVIDIASMIUint(counts)
 	if strings.Contains(counts, "N/A") || counts == "0" {
 		return nil
 	}
@@ -250,18 +317,12 @@ func (c *controller) checkNVIDIAVRAMUnrecoverableErrors(ctx context.Context, car
 
 func (c *controller) checkNVIDIAVRAMRecoverableErrors(ctx context.Context, cardIdx int) error {
 	// Check VRAM Page Retirement.
-	resRetirement, err := utils.ExecPipeCmd(ctx, []string{
-		"nvidia-smi -i " + strconv.Itoa(cardIdx) + " --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader",
-		"grep -i 'Single Bit ECC'"})
+	retiredPages, err := getNVIDIARetiredPages(ctx, cardIdx, "Single Bit ECC")
 	if err != nil {
 		return fmt.Errorf("get retired pages failed: %s", err)
 	}
-	retiredPages := strings.Split(strings.TrimSpace(resRetirement), "\n")
-	for _, page := range retiredPages {
-		page = strings.TrimSpace(page)
-		if !strings.Contains(page, "N/A") {
-			return fmt.Errorf("found retired page: %s", page)
-		}
+	if len(retiredPages) > 0 {
+		return fmt.Errorf("found retired page: %s", retiredPages[0])
 	}
 
 	// Check ECC Errors.
@@ -279,9 +340,36 @@ func (c *controller) checkNVIDIAVRAMRecoverableErrors(ctx context.Context, cardI
 		return fmt.Errorf("get ecc errors failed: %s", err)
 	}
 	counts := strings.TrimSpace(eccCounts)
+	c.gpuSnapshot(cardIdx).ECCCorrected = parseNVIDIASMIUint(counts)
 	if strings.Contains(counts, "N/A") || counts == "0" {
 		return nil
 	}
 
 	return fmt.Errorf("found ecc errors: %s", counts)
 }
+
+// getNVIDIARetiredPages returns the pages of the GPU retired for the given
+// cause, skipping N/A if page retirement is not supported. The rows are
+// filtered here rather than by a grep pipe, whose exit status would hide a
+// failure of nvidia-smi.
+func getNVIDIARetiredPages(ctx context.Context, cardIdx int, cause string) ([]string, error) {
+	res, err := utils.ExecCmd(ctx, "nvidia-smi", []string{"-i", strconv.Itoa(cardIdx),
+		"--query-retired-pages=retired_pages.address,retired_pages.cause", "--format=csv,noheader"})
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	for _, page := range strings.Split(strings.TrimSpace(res), "\n") {
+		page = strings.TrimSpace(page)
+		if page == "" || strings.Contains(page, "N/A") {
+			continue
+		}
+		if _, pageCause, ok := strings.Cut(page, ","); !ok || !strings.EqualFold(strings.TrimSpace(pageCause), cause) {
+			continue
+		}
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,303 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	procNVIDIAGPUsDir = "/proc/driver/nvidia/gpus"
+
+	pciVendorNVIDIA = "0x10de"
+)
+
+// nvidiaGPUClasses are the PCI class prefixes of NVIDIA GPUs, VGA compatible
+// controllers and 3D controllers. NVSwitches and audio functions are skipped.
+var nvidiaGPUClasses = []string{"0x0300", "0x0302"}
+
+// smiBusIDRegexp matches a PCI address as printed by nvidia-smi, which may use
+// an 8 digit domain, e.g. 00000000:3B:00.0.
+var smiBusIDRegexp = regexp.MustCompile(`[0-9A-Fa-f]{4,8}:[0-9A-Fa-f]{2}:[0-9A-Fa-f]{2}\.[0-7]`)
+
+// nvidiaSMIGPU is a GPU as listed by nvidia-smi.
+type nvidiaSMIGPU struct {
+	Index int
+	BusID string
+	UUID  GPUUID
+}
+
+// checkNVIDIAGPUBusPresence cross-references the GPUs enumerated on the PCI
+// bus, the GPUs known to the driver and the GPUs listed by nvidia-smi, and
+// names every bus id that is missing from one of the views. The affected GPUs
+// are returned with their own unhealthy result, by UUID if it is known, by bus
+// id otherwise.
+func (c *controller) checkNVIDIAGPUBusPresence(ctx context.Context) (*DiagnoseResult, map[GPUUID]*DiagnoseResult, error) {
+	pciGPUs, err := listPCINVIDIAGPUs()
+	if err != nil {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUBusPresence,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkNVIDIAGPUBusPresence() failed: list pci devices failed: %s", err),
+		}, nil, nil
+	}
+
+	driverGPUs, err := listDriverNVIDIAGPUs()
+	if err != nil {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUBusPresence,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkNVIDIAGPUBusPresence() failed: list driver gpus failed: %s", err),
+		}, nil, nil
+	}
+
+	smiGPUs, unknownErrorGPUs, err := listNVIDIASMIGPUs(ctx)
+	if err != nil {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUBusPresence,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkNVIDIAGPUBusPresence() failed: list nvidia-smi gpus failed: %s", err),
+		}, nil, nil
+	}
+
+	// Other containers' GPUs are on pci but not visible to nvidia-smi.
+	pciGPUs = c.filterInScope(pciGPUs)
+	driverGPUs = c.filterInScope(driverGPUs)
+	unknownErrorGPUs = c.filterInScope(unknownErrorGPUs)
+
+	smiBusIDs := map[string]bool{}
+	for _, gpu := range smiGPUs {
+		if !c.inScope(gpu.BusID) {
+			continue
+		}
+		smiBusIDs[gpu.BusID] = true
+		if c.gpuBusIDs == nil {
+			c.gpuBusIDs = make(map[int]string)
+		}
+		c.gpuBusIDs[gpu.Index] = gpu.BusID
+		if c.knownGPUIDs == nil {
+			c.knownGPUIDs = make(map[string]GPUUID)
+		}
+		c.knownGPUIDs[gpu.BusID] = gpu.UUID
+	}
+
+	var problems []string
+	gpuProblems := map[string][]string{}
+	addProblem := func(busID, problem string) {
+		problems = append(problems, fmt.Sprintf("%s %s", busID, problem))
+		gpuProblems[busID] = append(gpuProblems[busID], problem)
+	}
+	for _, busID := range sortedKeys(pciGPUs) {
+		if !driverGPUs[busID] {
+			addProblem(busID, "is on pci but unknown to the driver")
+		}
+	}
+	for _, busID := range sortedKeys(driverGPUs) {
+		if !pciGPUs[busID] {
+			addProblem(busID, "is known to the driver but missing from pci")
+		}
+	}
+	for _, busID := range sortedKeys(unknownErrorGPUs) {
+		addProblem(busID, "reports Unknown Error in nvidia-smi")
+	}
+	for _, busID := range sortedKeys(pciGPUs) {
+		if !smiBusIDs[busID] && !unknownErrorGPUs[busID] {
+			addProblem(busID, "is on pci but missing from nvidia-smi")
+		}
+	}
+	for _, busID := range sortedKeys(smiBusIDs) {
+		if !pciGPUs[busID] {
+			addProblem(busID, "is listed by nvidia-smi but missing from pci")
+		}
+	}
+
+	if len(problems) > 0 {
+		gpuResults := map[GPUUID]*DiagnoseResult{}
+		for busID, busProblems := range gpuProblems {
+			gpuResults[c.busGPUID(busID)] = &DiagnoseResult{
+				Name:      DiagnoseGPUBusPresence,
+				IsHealthy: utils.BoolPtr(false),
+				Message:   fmt.Sprintf("GPU %s fallen off the bus: %s", busID, strings.Join(busProblems, "; ")),
+			}
+		}
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUBusPresence,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("GPU fallen off the bus: %s", strings.Join(problems, "; ")),
+		}, gpuResults, nil
+	}
+
+	return &DiagnoseResult{
+		Name:      DiagnoseGPUBusPresence,
+		IsHealthy: utils.BoolPtr(true),
+		Message:   fmt.Sprintf("GPUs present on pci, driver and nvidia-smi: %d", len(pciGPUs)),
+	}, nil, nil
+}
+
+// busGPUID returns the UUID of the GPU at the given bus id, as listed by
+// nvidia-smi in this or an earlier run, or as reported by the driver. The bus
+// id itself is returned if neither knows the GPU.
+func (c *controller) busGPUID(busID string) GPUUID {
+	if uuid, ok := c.knownGPUIDs[busID]; ok {
+		return uuid
+	}
+	if uuid := readDriverGPUUUID(busID); uuid != "" {
+		return uuid
+	}
+	return GPUUID(busID)
+}
+
+// readDriverGPUUUID returns the UUID of the GPU from the driver, empty if the
+// driver does not know the GPU or could not read its UUID, e.g.
+//
+//	GPU UUID: 	 GPU-a1b2c3d4-...
+func readDriverGPUUUID(busID string) GPUUID {
+	info, err := utils.ReadFile(filepath.Join(procNVIDIAGPUsDir, busID, "information"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(info), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "GPU UUID" {
+			continue
+		}
+		// The driver prints question marks if the GPU is inaccessible.
+		value = strings.TrimSpace(value)
+		if value == "" || strings.Contains(value, "?") {
+			return ""
+		}
+		return GPUUID(value)
+	}
+	return ""
+}
+
+// listPCINVIDIAGPUs returns the bus ids of all NVIDIA GPUs enumerated on PCI.
+func listPCINVIDIAGPUs() (map[string]bool, error) {
+	entries, err := utils.ReadDir(sysfsPCIDevicesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]bool{}
+	for _, entry := range entries {
+		devDir := filepath.Join(sysfsPCIDevicesDir, entry.Name())
+		vendor, err := utils.ReadFile(filepath.Join(devDir, "vendor"))
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(vendor)) != pciVendorNVIDIA {
+			continue
+		}
+
+		class, err := utils.ReadFile(filepath.Join(devDir, "class"))
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range nvidiaGPUClasses {
+			if strings.HasPrefix(strings.TrimSpace(string(class)), prefix) {
+				res[entry.Name()] = true
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// listDriverNVIDIAGPUs returns the bus ids of all GPUs the driver has probed.
+func listDriverNVIDIAGPUs() (map[string]bool, error) {
+	entries, err := utils.ReadDir(procNVIDIAGPUsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+
+	res := map[string]bool{}
+	for _, entry := range entries {
+		busID, err := normalizePCIBusID(entry.Name())
+		if err != nil {
+			continue
+		}
+		res[busID] = true
+	}
+
+	return res, nil
+}
+
+// listNVIDIASMIGPUs returns the GPUs listed by nvidia-smi and the bus ids of
+// GPUs for which nvidia-smi reports Unknown Error.
+func listNVIDIASMIGPUs(ctx context.Context) ([]*nvidiaSMIGPU, map[string]bool, error) {
+	// nvidia-smi exits with non-zero code if any GPU is inaccessible, but still
+	// lists the healthy ones, so the output is parsed regardless of the error.
+	res, execErr := utils.ExecCmd(ctx, "nvidia-smi", []string{"--query-gpu=index,pci.bus_id,uuid", "--format=csv,noheader"})
+
+	var gpus []*nvidiaSMIGPU
+	unknownErrors := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(res), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.Contains(line, "Unknown Error") {
+			if match := smiBusIDRegexp.FindString(line); match != "" {
+				if busID, err := normalizePCIBusID(match); err == nil {
+					unknownErrors[busID] = true
+				}
+			}
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			continue
+		}
+		busID, err := normalizePCIBusID(fields[1])
+		if err != nil {
+			continue
+		}
+		gpus = append(gpus, &nvidiaSMIGPU{
+			Index: index,
+			BusID: busID,
+			UUID:  GPUUID(strings.TrimSpace(fields[2])),
+		})
+	}
+
+	if execErr != nil && len(gpus) == 0 && len(unknownErrors) == 0 {
+		return nil, nil, execErr
+	}
+
+	return gpus, unknownErrors, nil
+}
+
+func (c *controller) filterInScope(busIDs map[string]bool) map[string]bool {
+	res := map[string]bool{}
+	for busID := range busIDs {
+		if c.inScope(busID) {
+			res[busID] = true
+		}
+	}
+	return res
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,160 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeNVIDIADevice creates a PCI device with NVIDIA vendor id and the given
+// class directly under the root complex.
+func newFakeNVIDIADevice(t *testing.T, root, busID, class string) {
+	t.Helper()
+
+	devDir := newFakePCIDevice(t, root, busID)
+	files := map[string]string{
+		"vendor": pciVendorNVIDIA + "\n",
+		"class":  class + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(devDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestCheckNVIDIAGPUBusPresence(t *testing.T) {
+	tests := []struct {
+		name            string
+		pciGPUs         []string
+		driverGPUs      []string
+		smiOutput       string
+		wantHealthy     bool
+		wantMsgContains []string
+		// wantGPUs are the affected GPUs with a part of their message.
+		wantGPUs   map[GPUUID]string
+		wantBusIDs map[int]string
+	}{
+		{
+			name:        "all views agree",
+			pciGPUs:     []string{"0000:3b:00.0", "0000:5e:00.0"},
+			driverGPUs:  []string{"0000:3b:00.0", "0000:5e:00.0"},
+			smiOutput:   "0, 00000000:3B:00.0, GPU-uuid-1\n1, 00000000:5E:00.0, GPU-uuid-2",
+			wantHealthy: true,
+			wantBusIDs:  map[int]string{0: "0000:3b:00.0", 1: "0000:5e:00.0"},
+		},
+		{
+			name:        "gpu reports unknown error",
+			pciGPUs:     []string{"0000:3b:00.0", "0000:5e:00.0"},
+			driverGPUs:  []string{"0000:3b:00.0", "0000:5e:00.0"},
+			smiOutput:   "Unable to determine the device handle for GPU0000:5E:00.0: Unknown Error\n0, 00000000:3B:00.0, GPU-uuid-1",
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"0000:5e:00.0 reports Unknown Error in nvidia-smi",
+			},
+			wantGPUs: map[GPUUID]string{
+				"GPU-uuid-2": "GPU 0000:5e:00.0 fallen off the bus: reports Unknown Error in nvidia-smi",
+			},
+			wantBusIDs: map[int]string{0: "0000:3b:00.0"},
+		},
+		{
+			name:        "gpu missing from pci and nvidia-smi",
+			pciGPUs:     []string{"0000:3b:00.0"},
+			driverGPUs:  []string{"0000:3b:00.0", "0000:5e:00.0"},
+			smiOutput:   "0, 00000000:3B:00.0, GPU-uuid-1",
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"0000:5e:00.0 is known to the driver but missing from pci",
+			},
+			wantGPUs: map[GPUUID]string{
+				"GPU-uuid-2": "is known to the driver but missing from pci",
+			},
+		},
+		{
+			name:        "gpu not bound to driver",
+			pciGPUs:     []string{"0000:3b:00.0", "0000:5e:00.0"},
+			driverGPUs:  []string{"0000:3b:00.0"},
+			smiOutput:   "0, 00000000:3B:00.0, GPU-uuid-1",
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"0000:5e:00.0 is on pci but unknown to the driver",
+				"0000:5e:00.0 is on pci but missing from nvidia-smi",
+			},
+			wantGPUs: map[GPUUID]string{
+				"0000:5e:00.0": "is on pci but unknown to the driver; is on pci but missing from nvidia-smi",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, busID := range tt.pciGPUs {
+				newFakeNVIDIADevice(t, root, busID, "0x030200")
+			}
+			// NVSwitches share the vendor id but must not be counted as GPUs.
+			newFakeNVIDIADevice(t, root, "0000:07:00.0", "0x068000")
+			for i, busID := range tt.driverGPUs {
+				dir := filepath.Join(root, procNVIDIAGPUsDir, busID)
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("failed to create driver gpu dir: %v", err)
+				}
+				info := fmt.Sprintf("Model: \t\t NVIDIA A100-SXM4-80GB\nGPU UUID: \t GPU-uuid-%d\n", i+1)
+				if err := os.WriteFile(filepath.Join(dir, "information"), []byte(info), 0644); err != nil {
+					t.Fatalf("failed to write driver gpu information: %v", err)
+				}
+			}
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			mock := &mockExecCmd{commands: map[string]string{
+				"nvidia-smi --query-gpu=index,pci.bus_id,uuid --format=csv,noheader": tt.smiOutput,
+			}}
+			cleanup := utils.SetExecCmd(mock.exec)
+			defer cleanup()
+
+			c := &controller{}
+			got, gpus, err := c.checkNVIDIAGPUBusPresence(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, DiagnoseGPUBusPresence, got.Name)
+			assert.Equal(t, tt.wantHealthy, *got.IsHealthy, got.Message)
+			for _, want := range tt.wantMsgContains {
+				assert.Contains(t, got.Message, want)
+			}
+			assert.Len(t, gpus, len(tt.wantGPUs))
+			for gpuID, want := range tt.wantGPUs {
+				if assert.Contains(t, gpus, gpuID) {
+					assert.Equal(t, DiagnoseGPUBusPresence, gpus[gpuID].Name)
+					assert.False(t, *gpus[gpuID].IsHealthy)
+					assert.Contains(t, gpus[gpuID].Message, want)
+				}
+			}
+			if tt.wantBusIDs != nil {
+				assert.Equal(t, tt.wantBusIDs, c.gpuBusIDs)
+			}
+		})
+	}
+}
+
+func TestCheckNVIDIAGPUBusPresenceNVIDIASMIFailed(t *testing.T) {
+	root := t.TempDir()
+	newFakeNVIDIADevice(t, root, "0000:3b:00.0", "0x030200")
+	cleanupFS := utils.SetFSRoot(root)
+	defer cleanupFS()
+
+	mock := &mockExecCmd{commands: map[string]string{}}
+	cleanup := utils.SetExecCmd(mock.exec)
+	defer cleanup()
+
+	c := &controller{}
+	got, gpus, err := c.checkNVIDIAGPUBusPresence(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, gpus)
+	assert.False(t, *got.IsHealthy)
+	assert.Contains(t, got.Message, "list nvidia-smi gpus failed")
+}
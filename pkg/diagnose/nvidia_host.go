@@ -0,0 +1,204 @@
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	procModulesFile   = "/proc/modules"
+	devNodesDir       = "/dev"
+	devNVIDIACapsDir  = "/dev/nvidia-caps"
+	devNodeModeNeeded = 0666
+	devCapModeNeeded  = 0400
+)
+
+// nvidiaRequiredModules must be loaded for CUDA workloads to run.
+var nvidiaRequiredModules = []string{"nvidia", "nvidia_uvm"}
+
+// nvidiaOptionalModules are only needed by some workloads, nvidia_modeset for
+// display and nvidia_peermem for GPUDirect RDMA, and are reported without
+// failing the check.
+var nvidiaOptionalModules = []string{"nvidia_modeset", "nvidia_peermem"}
+
+// nvidiaConflictingModules must not be loaded alongside the NVIDIA driver.
+var nvidiaConflictingModules = []string{"nouveau"}
+
+// nvidiaControlDevNodes are the device nodes shared by all GPUs.
+var nvidiaControlDevNodes = []string{"nvidiactl", "nvidia-uvm", "nvidia-uvm-tools"}
+
+// nvidiaGPUDevNodeRegexp matches the per-GPU device nodes, e.g. nvidia0.
+var nvidiaGPUDevNodeRegexp = regexp.MustCompile(`^nvidia[0-9]+$`)
+
+// checkNVIDIAHostStatus runs the host-level checks of the driver stack, which
+// explain why the driver may be unhealthy.
+func (c *controller) checkNVIDIAHostStatus() []*DiagnoseResult {
+	return []*DiagnoseResult{
+		c.checkNVIDIAKernelModules(),
+		c.checkNVIDIADeviceNodes(),
+	}
+}
+
+func (c *controller) checkNVIDIAKernelModules() *DiagnoseResult {
+	modules, err := readKernelModules()
+	if err != nil {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUKernelModules,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkNVIDIAKernelModules() failed: %s", err),
+		}
+	}
+
+	var problems []string
+	for _, name := range nvidiaRequiredModules {
+		state, ok := modules[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("module %s is not loaded", name))
+		case state != "Live":
+			problems = append(problems, fmt.Sprintf("module %s is %s", name, state))
+		}
+	}
+	for _, name := range nvidiaConflictingModules {
+		if _, ok := modules[name]; ok {
+			problems = append(problems, fmt.Sprintf("conflicting module %s is loaded", name))
+		}
+	}
+
+	var notes []string
+	for _, name := range nvidiaOptionalModules {
+		if _, ok := modules[name]; !ok {
+			notes = append(notes, fmt.Sprintf("optional module %s is not loaded", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUKernelModules,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("Kernel modules are not OK: %s", strings.Join(append(problems, notes...), "; ")),
+		}
+	}
+
+	msg := "Kernel modules are loaded"
+	if len(notes) > 0 {
+		msg = fmt.Sprintf("%s, %s", msg, strings.Join(notes, "; "))
+	}
+	return &DiagnoseResult{
+		Name:      DiagnoseGPUKernelModules,
+		IsHealthy: utils.BoolPtr(true),
+		Message:   msg,
+	}
+}
+
+func (c *controller) checkNVIDIADeviceNodes() *DiagnoseResult {
+	var problems []string
+
+	for _, name := range nvidiaControlDevNodes {
+		if problem := checkDevNode(filepath.Join(devNodesDir, name), devNodeModeNeeded); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	entries, err := utils.ReadDir(devNodesDir)
+	if err != nil {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUDeviceNodes,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkNVIDIADeviceNodes() failed: %s", err),
+		}
+	}
+	gpuNodes := 0
+	for _, entry := range entries {
+		if !nvidiaGPUDevNodeRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		gpuNodes++
+		if problem := checkDevNode(filepath.Join(devNodesDir, entry.Name()), devNodeModeNeeded); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if gpuNodes < c.ExpectedCardCount {
+		problems = append(problems, fmt.Sprintf("found %d %s/nvidia[0-9]+ nodes, expected %d", gpuNodes, devNodesDir, c.ExpectedCardCount))
+	}
+
+	capsNote := ""
+	caps, err := utils.ReadDir(devNVIDIACapsDir)
+	switch {
+	case os.IsNotExist(err):
+		capsNote = fmt.Sprintf("%s is not present, it is only needed for MIG", devNVIDIACapsDir)
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("read %s failed: %s", devNVIDIACapsDir, err))
+	default:
+		for _, entry := range caps {
+			if problem := checkDevNode(filepath.Join(devNVIDIACapsDir, entry.Name()), devCapModeNeeded); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &DiagnoseResult{
+			Name:      DiagnoseGPUDeviceNodes,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("Device nodes are not OK: %s", strings.Join(problems, "; ")),
+		}
+	}
+
+	msg := fmt.Sprintf("Device nodes are present: %d GPU nodes", gpuNodes)
+	if capsNote != "" {
+		msg = fmt.Sprintf("%s, %s", msg, capsNote)
+	}
+	return &DiagnoseResult{
+		Name:      DiagnoseGPUDeviceNodes,
+		IsHealthy: utils.BoolPtr(true),
+		Message:   msg,
+	}
+}
+
+// readKernelModules returns the state of every loaded kernel module, e.g.
+// Live, Loading or Unloading.
+func readKernelModules() (map[string]string, error) {
+	data, err := utils.ReadFile(procModulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Format: <name> <size> <refcount> <deps> <state> <offset> [taints]
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		res[fields[0]] = fields[4]
+	}
+
+	return res, nil
+}
+
+// checkDevNode returns a description of the problem with the given device
+// node, or an empty string if it is a character device with at least the
+// given permissions.
+func checkDevNode(path string, perm os.FileMode) string {
+	info, err := utils.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Sprintf("%s is missing", path)
+		}
+		return fmt.Sprintf("stat %s failed: %s", path, err)
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Sprintf("%s is not a character device", path)
+	}
+	if info.Mode().Perm()&perm != perm {
+		return fmt.Sprintf("%s has mode %04o, expected at least %04o", path, info.Mode().Perm(), perm)
+	}
+
+	return ""
+}
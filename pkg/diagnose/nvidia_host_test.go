@@ -0,0 +1,156 @@
+package diagnose
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNVIDIAKernelModules(t *testing.T) {
+	tests := []struct {
+		name            string
+		modules         string
+		wantHealthy     bool
+		wantMsgContains []string
+	}{
+		{
+			name: "all modules loaded",
+			modules: "nvidia_uvm 1527808 0 - Live 0x0000000000000000 (POE)\n" +
+				"nvidia_peermem 16384 0 - Live 0x0000000000000000 (OE)\n" +
+				"nvidia_modeset 1306624 0 - Live 0x0000000000000000 (POE)\n" +
+				"nvidia 56717312 2 nvidia_uvm,nvidia_peermem,nvidia_modeset, Live 0x0000000000000000 (POE)\n",
+			wantHealthy:     true,
+			wantMsgContains: []string{"Kernel modules are loaded"},
+		},
+		{
+			name: "optional modules missing",
+			modules: "nvidia_uvm 1527808 0 - Live 0x0000000000000000 (POE)\n" +
+				"nvidia 56717312 2 nvidia_uvm, Live 0x0000000000000000 (POE)\n",
+			wantHealthy:     true,
+			wantMsgContains: []string{"optional module nvidia_peermem is not loaded"},
+		},
+		{
+			name:            "uvm missing",
+			modules:         "nvidia 56717312 2 - Live 0x0000000000000000 (POE)\n",
+			wantHealthy:     false,
+			wantMsgContains: []string{"module nvidia_uvm is not loaded"},
+		},
+		{
+			name: "nouveau conflict",
+			modules: "nouveau 2433024 0 - Live 0x0000000000000000\n" +
+				"nvidia_uvm 1527808 0 - Live 0x0000000000000000 (POE)\n" +
+				"nvidia 56717312 2 nvidia_uvm, Loading 0x0000000000000000 (POE)\n",
+			wantHealthy:     false,
+			wantMsgContains: []string{"conflicting module nouveau is loaded", "module nvidia is Loading"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "proc"), 0755); err != nil {
+				t.Fatalf("failed to create proc dir: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(root, procModulesFile), []byte(tt.modules), 0644); err != nil {
+				t.Fatalf("failed to write modules: %v", err)
+			}
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			c := &controller{}
+			got := c.checkNVIDIAKernelModules()
+			assert.Equal(t, DiagnoseGPUKernelModules, got.Name)
+			assert.Equal(t, tt.wantHealthy, *got.IsHealthy, got.Message)
+			for _, want := range tt.wantMsgContains {
+				assert.Contains(t, got.Message, want)
+			}
+		})
+	}
+}
+
+func TestCheckNVIDIADeviceNodes(t *testing.T) {
+	tests := []struct {
+		name            string
+		charDevices     map[string]os.FileMode
+		regularFiles    []string
+		wantHealthy     bool
+		wantMsgContains []string
+	}{
+		{
+			name: "all nodes present",
+			charDevices: map[string]os.FileMode{
+				"dev/nvidiactl":               0666,
+				"dev/nvidia-uvm":              0666,
+				"dev/nvidia-uvm-tools":        0666,
+				"dev/nvidia0":                 0666,
+				"dev/nvidia1":                 0666,
+				"dev/nvidia-caps/nvidia-cap1": 0400,
+			},
+			wantHealthy: true,
+		},
+		{
+			name: "wrong permissions and missing gpu node",
+			charDevices: map[string]os.FileMode{
+				"dev/nvidiactl":        0666,
+				"dev/nvidia-uvm":       0666,
+				"dev/nvidia-uvm-tools": 0666,
+				"dev/nvidia0":          0600,
+			},
+			wantHealthy: false,
+			wantMsgContains: []string{
+				"/dev/nvidia0 has mode 0600, expected at least 0666",
+				"found 1 /dev/nvidia[0-9]+ nodes, expected 2",
+			},
+		},
+		{
+			name:         "nodes missing or not character devices",
+			regularFiles: []string{"dev/nvidiactl", "dev/nvidia0", "dev/nvidia1"},
+			wantHealthy:  false,
+			wantMsgContains: []string{
+				"/dev/nvidiactl is not a character device",
+				"/dev/nvidia-uvm is missing",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "dev"), 0755); err != nil {
+				t.Fatalf("failed to create dev dir: %v", err)
+			}
+			for name, mode := range tt.charDevices {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("failed to create dir: %v", err)
+				}
+				if err := syscall.Mknod(path, syscall.S_IFCHR|uint32(mode), 0); err != nil {
+					t.Skipf("creating character devices is not permitted: %v", err)
+				}
+				// Mknod is subject to umask.
+				if err := os.Chmod(path, mode); err != nil {
+					t.Fatalf("failed to chmod %s: %v", name, err)
+				}
+			}
+			for _, name := range tt.regularFiles {
+				if err := os.WriteFile(filepath.Join(root, name), nil, 0666); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			c := &controller{ExpectedCardCount: 2}
+			got := c.checkNVIDIADeviceNodes()
+			assert.Equal(t, DiagnoseGPUDeviceNodes, got.Name)
+			assert.Equal(t, tt.wantHealthy, *got.IsHealthy, got.Message)
+			for _, want := range tt.wantMsgContains {
+				assert.Contains(t, got.Message, want)
+			}
+		})
+	}
+}
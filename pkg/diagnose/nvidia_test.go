@@ -42,23 +42,21 @@ func TestCheckNVIDIACardCount(t *testing.T) {
 		expectedCardCount int
 		actualCardCount   int
 		wantHealthy       bool
-		wantErr           bool
-		wantErrContains   string
+		wantMessage       string
 	}{
 		{
 			name:              "matching card count",
 			expectedCardCount: 4,
 			actualCardCount:   4,
 			wantHealthy:       true,
-			wantErr:           false,
+			wantMessage:       "GPU Card Count: 4",
 		},
 		{
 			name:              "mismatched card count",
 			expectedCardCount: 4,
 			actualCardCount:   3,
 			wantHealthy:       false,
-			wantErr:           true,
-			wantErrContains:   "GPU card count mismatch: got 3, expected 4",
+			wantMessage:       "GPU Card Count: 3, Expected: 4",
 		},
 	}
 
@@ -67,19 +65,11 @@ func TestCheckNVIDIACardCount(t *testing.T) {
 			c := &controller{
 				ExpectedCardCount: tt.expectedCardCount,
 			}
-			result, err := c.checkNVIDIACardCount(tt.actualCardCount)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-				if tt.wantErrContains != "" {
-					assert.Contains(t, err.Error(), tt.wantErrContains)
-				}
-			} else {
-				assert.NoError(t, err)
-			}
+			result := c.checkNVIDIACardCount(tt.actualCardCount)
 
 			assert.Equal(t, tt.wantHealthy, *result.IsHealthy)
 			assert.Equal(t, DiagnoseGPUCardCount, result.Name)
+			assert.Equal(t, tt.wantMessage, result.Message)
 		})
 	}
 }
@@ -131,20 +121,17 @@ func TestCheckNVIDIAGPULinkStatus(t *testing.T) {
 
 func TestCheckNVIDIAVRAMUnrecoverableErrors(t *testing.T) {
 	tests := []struct {
-		name         string
-		mockCmds     map[string]string
-		mockPipeCmds map[string]string
-		wantErr      bool
-		cardIdx      int
+		name     string
+		mockCmds map[string]string
+		wantErr  bool
+		cardIdx  int
 	}{
 		{
 			name: "no errors with ECC enabled",
 			mockCmds: map[string]string{
-				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                      "Enabled",
-				"nvidia-smi -i 0 --query-gpu=ecc.errors.uncorrected.volatile.total --format=csv,noheader": "0",
-			},
-			mockPipeCmds: map[string]string{
-				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader | grep -i 'Double Bit ECC'": "N/A",
+				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                                    "Enabled",
+				"nvidia-smi -i 0 --query-gpu=ecc.errors.uncorrected.volatile.total --format=csv,noheader":               "0",
+				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader": "N/A, N/A",
 			},
 			cardIdx: 0,
 			wantErr: false,
@@ -163,13 +150,10 @@ func TestCheckNVIDIAVRAMUnrecoverableErrors(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &mockExecCmd{
-				commands:     tt.mockCmds,
-				pipeCommands: tt.mockPipeCmds,
+				commands: tt.mockCmds,
 			}
 			cleanup := utils.SetExecCmd(mock.exec)
-			cleanupPipe := utils.SetExecPipeCmd(mock.execPipe)
 			defer cleanup()
-			defer cleanupPipe()
 
 			c := &controller{}
 			err := c.checkNVIDIAVRAMUnrecoverableErrors(context.Background(), tt.cardIdx)
@@ -185,20 +169,17 @@ func TestCheckNVIDIAVRAMUnrecoverableErrors(t *testing.T) {
 
 func TestCheckNVIDIAVRAMRecoverableErrors(t *testing.T) {
 	tests := []struct {
-		name         string
-		mockCmds     map[string]string
-		mockPipeCmds map[string]string
-		wantErr      bool
-		cardIdx      int
+		name     string
+		mockCmds map[string]string
+		wantErr  bool
+		cardIdx  int
 	}{
 		{
 			name: "no recoverable errors",
 			mockCmds: map[string]string{
-				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                    "Enabled",
-				"nvidia-smi -i 0 --query-gpu=ecc.errors.corrected.volatile.total --format=csv,noheader": "0",
-			},
-			mockPipeCmds: map[string]string{
-				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader | grep -i 'Single Bit ECC'": "N/A",
+				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                                    "Enabled",
+				"nvidia-smi -i 0 --query-gpu=ecc.errors.corrected.volatile.total --format=csv,noheader":                 "0",
+				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader": "N/A, N/A",
 			},
 			cardIdx: 0,
 			wantErr: false,
@@ -206,11 +187,9 @@ func TestCheckNVIDIAVRAMRecoverableErrors(t *testing.T) {
 		{
 			name: "recoverable errors present",
 			mockCmds: map[string]string{
-				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                    "Enabled",
-				"nvidia-smi -i 0 --query-gpu=ecc.errors.corrected.volatile.total --format=csv,noheader": "5",
-			},
-			mockPipeCmds: map[string]string{
-				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader | grep -i 'Single Bit ECC'": "N/A",
+				"nvidia-smi -i 0 --query-gpu=ecc.mode.current --format=csv,noheader":                                    "Enabled",
+				"nvidia-smi -i 0 --query-gpu=ecc.errors.corrected.volatile.total --format=csv,noheader":                 "5",
+				"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader": "N/A, N/A",
 			},
 			cardIdx: 0,
 			wantErr: true,
@@ -220,13 +199,10 @@ func TestCheckNVIDIAVRAMRecoverableErrors(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &mockExecCmd{
-				commands:     tt.mockCmds,
-				pipeCommands: tt.mockPipeCmds,
+				commands: tt.mockCmds,
 			}
 			cleanup := utils.SetExecCmd(mock.exec)
-			cleanupPipe := utils.SetExecPipeCmd(mock.execPipe)
 			defer cleanup()
-			defer cleanupPipe()
 
 			c := &controller{}
 			err := c.checkNVIDIAVRAMRecoverableErrors(context.Background(), tt.cardIdx)
@@ -303,6 +279,7 @@ func TestCheckNVIDIAGPUDriverStatus(t *testing.T) {
 	tests := []struct {
 		name     string
 		mockCmds map[string]string
+		mockErr  error
 		want     *DiagnoseResult
 		wantErr  bool
 	}{
@@ -330,6 +307,19 @@ func TestCheckNVIDIAGPUDriverStatus(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "driver not loaded with non-zero exit code",
+			mockCmds: map[string]string{
+				"nvidia-smi -L": "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver",
+			},
+			mockErr: &utils.ExitError{Code: 9, Message: "exit status 9"},
+			want: &DiagnoseResult{
+				Name:      DiagnoseGPUDriverStatus,
+				IsHealthy: utils.BoolPtr(false),
+				Message:   "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver",
+			},
+			wantErr: false,
+		},
 		{
 			name:     "command execution error",
 			mockCmds: map[string]string{
@@ -349,6 +339,7 @@ func TestCheckNVIDIAGPUDriverStatus(t *testing.T) {
 			// Setup mock
 			mock := &utils.MockExecCmd{
 				Commands: tt.mockCmds,
+				Err:      tt.mockErr,
 			}
 			cleanup := utils.SetExecCmd(mock.Exec)
 			defer cleanup()
@@ -375,3 +366,84 @@ func TestCheckNVIDIAGPUDriverStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNVIDIARetiredPages(t *testing.T) {
+	const cmd = "nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader"
+
+	tests := []struct {
+		name     string
+		mockCmds map[string]string
+		mockErr  error
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "no page retired",
+			mockCmds: map[string]string{cmd: ""},
+		},
+		{
+			name:     "no page retired for the cause",
+			mockCmds: map[string]string{cmd: "0x000000000000a000, Single Bit ECC\n"},
+		},
+		{
+			name:     "page retirement not supported",
+			mockCmds: map[string]string{cmd: "N/A, N/A\n"},
+		},
+		{
+			name:     "retired pages",
+			mockCmds: map[string]string{cmd: "0x000000000000a000, Double Bit ECC\n0x000000000000c000, Single Bit ECC\n0x000000000000b000, double bit ecc\n"},
+			want:     []string{"0x000000000000a000, Double Bit ECC", "0x000000000000b000, double bit ecc"},
+		},
+		{
+			name:     "nvidia-smi fails",
+			mockCmds: map[string]string{cmd: "Unable to determine the device handle for GPU0000:3B:00.0: Unknown Error"},
+			mockErr:  &utils.ExitError{Code: 15, Message: "exit status 15"},
+			wantErr:  true,
+		},
+		{
+			name:    "command not found",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecCmd{
+				commands: tt.mockCmds,
+				err:      tt.mockErr,
+			}
+			cleanup := utils.SetExecCmd(mock.exec)
+			defer cleanup()
+
+			got, err := getNVIDIARetiredPages(context.Background(), 0, "Double Bit ECC")
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckNVIDIAVRAMStatusRetiredPagesFail(t *testing.T) {
+	mock := &mockExecCmd{
+		commands: map[string]string{
+			"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader": "Unable to determine the device handle for GPU0000:3B:00.0: Unknown Error",
+		},
+		err: &utils.ExitError{Code: 15, Message: "exit status 15"},
+	}
+	cleanup := utils.SetExecCmd(mock.exec)
+	defer cleanup()
+
+	c := &controller{ExpectedCardCount: 1, gpuIDs: map[int]GPUUID{0: "GPU-uuid-1"}}
+	results := map[GPUUID][]*DiagnoseResult{}
+	assert.NoError(t, c.checkNVIDIAVRAMStatus(context.Background(), results))
+
+	assert.Len(t, results["GPU-uuid-1"], 2)
+	for _, result := range results["GPU-uuid-1"] {
+		assert.False(t, *result.IsHealthy, result.Name)
+		assert.Contains(t, result.Message, "get retired pages failed: exit status 15")
+	}
+}
@@ -0,0 +1,249 @@
+package diagnose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// AERThresholds defines the maximum tolerated PCIe Advanced Error Reporting
+// counts of every component in a GPU's PCIe path. A component is reported once
+// any of its counters exceeds the corresponding threshold.
+type AERThresholds struct {
+	Correctable uint64
+	NonFatal    uint64
+	Fatal       uint64
+}
+
+// DefaultAERThresholds tolerates a low rate of correctable errors, which are
+// retried transparently by the link layer, but no non-fatal or fatal ones.
+var DefaultAERThresholds = AERThresholds{
+	Correctable: 100,
+	NonFatal:    0,
+	Fatal:       0,
+}
+
+const sysfsPCIDevicesDir = "/sys/bus/pci/devices"
+
+// pciAddressRegexp matches a PCI address in sysfs form, e.g. 0000:3b:00.0.
+var pciAddressRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// aerCounters holds the TOTAL_ERR_* values of a device's aer_dev_* files.
+type aerCounters struct {
+	Correctable uint64
+	NonFatal    uint64
+	Fatal       uint64
+}
+
+// pcieComponent is a device in the PCIe path between a GPU and its root port.
+type pcieComponent struct {
+	Kind    string
+	Address string
+}
+
+func (c *controller) checkNVIDIAGPUsPCIeAER(ctx context.Context, results map[GPUUID][]*DiagnoseResult) error {
+	for _, i := range c.gpuIndexes() {
+		gpuID := c.gpuIDs[i]
+		msg := ""
+
+		err := c.checkNVIDIAGPUPCIeAER(ctx, i)
+		if err != nil {
+			msg = fmt.Sprintf("PCIe AER is not OK: %s", err)
+		}
+
+		results[gpuID] = append(results[gpuID], &DiagnoseResult{
+			Name:      DiagnoseGPUPCIeAERErrors,
+			IsHealthy: utils.BoolPtr(err == nil),
+			Message:   msg,
+		})
+	}
+
+	return nil
+}
+
+func (c *controller) checkNVIDIAGPUPCIeAER(ctx context.Context, cardIdx int) error {
+	busID, err := c.getNVIDIAGPUBusID(ctx, cardIdx)
+	if err != nil {
+		return err
+	}
+
+	path, err := getPCIeUpstreamPath(busID)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, component := range path {
+		counters, err := readAERCounters(filepath.Join(sysfsPCIDevicesDir, component.Address))
+		if err != nil {
+			return fmt.Errorf("read aer counters of %s %s failed: %s", component.Kind, component.Address, err)
+		}
+		if counters == nil {
+			// AER is not supported or not enabled on this component.
+			continue
+		}
+		if component.Kind == "gpu" {
+			gpu := c.gpuSnapshot(cardIdx)
+			gpu.PCIeAERCorrected = &counters.Correctable
+			gpu.PCIeAERNonFatal = &counters.NonFatal
+			gpu.PCIeAERFatal = &counters.Fatal
+		}
+
+		if counters.Correctable > c.AERThresholds.Correctable {
+			problems = append(problems, fmt.Sprintf("%s %s correctable=%d (threshold %d)",
+				component.Kind, component.Address, counters.Correctable, c.AERThresholds.Correctable))
+		}
+		if counters.NonFatal > c.AERThresholds.NonFatal {
+			problems = append(problems, fmt.Sprintf("%s %s nonfatal=%d (threshold %d)",
+				component.Kind, component.Address, counters.NonFatal, c.AERThresholds.NonFatal))
+		}
+		if counters.Fatal > c.AERThresholds.Fatal {
+			problems = append(problems, fmt.Sprintf("%s %s fatal=%d (threshold %d)",
+				component.Kind, component.Address, counters.Fatal, c.AERThresholds.Fatal))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("aer errors over threshold: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// getNVIDIAGPUBusID returns the PCI address of the GPU in sysfs form.
+func (c *controller) getNVIDIAGPUBusID(ctx context.Context, cardIdx int) (string, error) {
+	if busID, ok := c.gpuBusIDs[cardIdx]; ok {
+		return busID, nil
+	}
+
+	res, err := utils.ExecCmd(ctx, "nvidia-smi", []string{"-i", strconv.Itoa(cardIdx), "--query-gpu=pci.bus_id", "--format=csv,noheader"})
+	if err != nil {
+		return "", fmt.Errorf("get pci bus id failed: %s", err)
+	}
+	busID, err := normalizePCIBusID(res)
+	if err != nil {
+		return "", err
+	}
+
+	if c.gpuBusIDs == nil {
+		c.gpuBusIDs = make(map[int]string)
+	}
+	c.gpuBusIDs[cardIdx] = busID
+
+	return busID, nil
+}
+
+// normalizePCIBusID converts a bus id reported by nvidia-smi, e.g.
+// 00000000:3B:00.0, into the form used by sysfs, e.g. 0000:3b:00.0.
+func normalizePCIBusID(busID string) (string, error) {
+	busID = strings.ToLower(strings.TrimSpace(busID))
+	parts := strings.SplitN(busID, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid pci bus id %q", busID)
+	}
+	domain := strings.Repeat("0", 4) + parts[0]
+	normalized := domain[len(domain)-4:] + ":" + parts[1]
+	if !pciAddressRegexp.MatchString(normalized) {
+		return "", fmt.Errorf("invalid pci bus id %q", busID)
+	}
+
+	return normalized, nil
+}
+
+// getPCIeUpstreamPath returns the device with the given address followed by
+// all of its upstream bridges and switch ports, ending with the root port.
+func getPCIeUpstreamPath(busID string) ([]pcieComponent, error) {
+	devPath, err := utils.EvalSymlinks(filepath.Join(sysfsPCIDevicesDir, busID))
+	if err != nil {
+		return nil, fmt.Errorf("resolve pci device %s failed: %s", busID, err)
+	}
+
+	var addresses []string
+	for dir := devPath; pciAddressRegexp.MatchString(filepath.Base(dir)); dir = filepath.Dir(dir) {
+		addresses = append(addresses, filepath.Base(dir))
+	}
+
+	var path []pcieComponent
+	for i, address := range addresses {
+		kind := "switch port"
+		switch {
+		case i == 0:
+			kind = "gpu"
+		case i == len(addresses)-1:
+			kind = "root port"
+		}
+		path = append(path, pcieComponent{Kind: kind, Address: address})
+	}
+
+	return path, nil
+}
+
+// readAERCounters reads the AER counters of the device in the given sysfs
+// directory, it returns nil counters if the device does not expose AER.
+func readAERCounters(devDir string) (*aerCounters, error) {
+	counters := &aerCounters{}
+	files := []struct {
+		name  string
+		total string
+		value *uint64
+	}{
+		{"aer_dev_correctable", "TOTAL_ERR_COR", &counters.Correctable},
+		{"aer_dev_nonfatal", "TOTAL_ERR_NONFATAL", &counters.NonFatal},
+		{"aer_dev_fatal", "TOTAL_ERR_FATAL", &counters.Fatal},
+	}
+
+	found := false
+	for _, f := range files {
+		data, err := utils.ReadFile(filepath.Join(devDir, f.name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+
+		value, err := parseAERTotal(data, f.total)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s failed: %s", f.name, err)
+		}
+		*f.value = value
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return counters, nil
+}
+
+// parseAERTotal returns the value of the given TOTAL_ERR_* line of an
+// aer_dev_* file. Older kernels do not report totals, in which case the sum of
+// all individual counters is returned.
+func parseAERTotal(data []byte, total string) (uint64, error) {
+	var sum uint64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid counter %q: %s", scanner.Text(), err)
+		}
+		if fields[0] == total {
+			return value, nil
+		}
+		sum += value
+	}
+
+	return sum, scanner.Err()
+}
@@ -0,0 +1,220 @@
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakePCIDevice creates a device under <root>/sys/devices along the given
+// hierarchy of PCI addresses and links it into <root>/sys/bus/pci/devices like
+// the kernel does. It returns the device directory.
+func newFakePCIDevice(t *testing.T, root string, hierarchy ...string) string {
+	t.Helper()
+
+	rel := filepath.Join(append([]string{"devices", "pci0000:00"}, hierarchy...)...)
+	devDir := filepath.Join(root, "sys", rel)
+	if err := os.MkdirAll(devDir, 0755); err != nil {
+		t.Fatalf("failed to create device dir: %v", err)
+	}
+
+	busDir := filepath.Join(root, sysfsPCIDevicesDir)
+	if err := os.MkdirAll(busDir, 0755); err != nil {
+		t.Fatalf("failed to create bus dir: %v", err)
+	}
+	link := filepath.Join(busDir, hierarchy[len(hierarchy)-1])
+	if _, err := os.Lstat(link); err == nil {
+		return devDir
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "..", rel), link); err != nil {
+		t.Fatalf("failed to create device link: %v", err)
+	}
+
+	return devDir
+}
+
+// writeFakeAERCounters writes aer_dev_* files with the given totals.
+func writeFakeAERCounters(t *testing.T, devDir string, correctable, nonFatal, fatal string) {
+	t.Helper()
+
+	files := map[string]string{
+		"aer_dev_correctable": "RxErr 0\nBadTLP 0\nTOTAL_ERR_COR " + correctable + "\n",
+		"aer_dev_nonfatal":    "Undefined 0\nDLP 0\nTOTAL_ERR_NONFATAL " + nonFatal + "\n",
+		"aer_dev_fatal":       "Undefined 0\nDLP 0\nTOTAL_ERR_FATAL " + fatal + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(devDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestNormalizePCIBusID(t *testing.T) {
+	tests := []struct {
+		name    string
+		busID   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "nvidia-smi format",
+			busID: "00000000:3B:00.0\n",
+			want:  "0000:3b:00.0",
+		},
+		{
+			name:  "sysfs format",
+			busID: "0000:3b:00.0",
+			want:  "0000:3b:00.0",
+		},
+		{
+			name:    "invalid bus id",
+			busID:   "N/A",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePCIBusID(tt.busID)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseAERTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		total   string
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name:  "total line",
+			data:  "RxErr 3\nBadTLP 2\nTOTAL_ERR_COR 5\n",
+			total: "TOTAL_ERR_COR",
+			want:  5,
+		},
+		{
+			name:  "no total line",
+			data:  "RxErr 3\nBadTLP 2\n",
+			total: "TOTAL_ERR_COR",
+			want:  5,
+		},
+		{
+			name:    "invalid counter",
+			data:    "RxErr x\n",
+			total:   "TOTAL_ERR_COR",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAERTotal([]byte(tt.data), tt.total)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckNVIDIAGPUPCIeAER(t *testing.T) {
+	tests := []struct {
+		name            string
+		rootPort        []string
+		switchPort      []string
+		gpu             []string
+		wantErr         bool
+		wantErrContains []string
+	}{
+		{
+			name:       "no errors",
+			rootPort:   []string{"0", "0", "0"},
+			switchPort: []string{"0", "0", "0"},
+			gpu:        []string{"3", "0", "0"},
+			wantErr:    false,
+		},
+		{
+			name:            "switch port accumulating correctable errors",
+			rootPort:        []string{"0", "0", "0"},
+			switchPort:      []string{"150", "0", "0"},
+			gpu:             []string{"0", "0", "0"},
+			wantErr:         true,
+			wantErrContains: []string{"switch port 0000:3c:08.0 correctable=150 (threshold 100)"},
+		},
+		{
+			name:            "gpu and root port errors",
+			rootPort:        []string{"0", "2", "0"},
+			switchPort:      []string{"0", "0", "0"},
+			gpu:             []string{"0", "0", "1"},
+			wantErr:         true,
+			wantErrContains: []string{"root port 0000:3a:00.0 nonfatal=2", "gpu 0000:3d:00.0 fatal=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			rootPort := newFakePCIDevice(t, root, "0000:3a:00.0")
+			newFakePCIDevice(t, root, "0000:3a:00.0", "0000:3b:00.0")
+			switchPort := newFakePCIDevice(t, root, "0000:3a:00.0", "0000:3b:00.0", "0000:3c:08.0")
+			gpu := newFakePCIDevice(t, root, "0000:3a:00.0", "0000:3b:00.0", "0000:3c:08.0", "0000:3d:00.0")
+			writeFakeAERCounters(t, rootPort, tt.rootPort[0], tt.rootPort[1], tt.rootPort[2])
+			writeFakeAERCounters(t, switchPort, tt.switchPort[0], tt.switchPort[1], tt.switchPort[2])
+			writeFakeAERCounters(t, gpu, tt.gpu[0], tt.gpu[1], tt.gpu[2])
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			mock := &mockExecCmd{commands: map[string]string{
+				"nvidia-smi -i 0 --query-gpu=pci.bus_id --format=csv,noheader": "00000000:3D:00.0",
+			}}
+			cleanup := utils.SetExecCmd(mock.exec)
+			defer cleanup()
+
+			c := &controller{AERThresholds: DefaultAERThresholds}
+			err := c.checkNVIDIAGPUPCIeAER(context.Background(), 0)
+
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			for _, want := range tt.wantErrContains {
+				assert.True(t, strings.Contains(err.Error(), want), "error %q should contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestGetPCIeUpstreamPath(t *testing.T) {
+	root := t.TempDir()
+	newFakePCIDevice(t, root, "0000:3a:00.0", "0000:3b:00.0", "0000:3c:08.0", "0000:3d:00.0")
+	cleanupFS := utils.SetFSRoot(root)
+	defer cleanupFS()
+
+	got, err := getPCIeUpstreamPath("0000:3d:00.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []pcieComponent{
+		{Kind: "gpu", Address: "0000:3d:00.0"},
+		{Kind: "switch port", Address: "0000:3c:08.0"},
+		{Kind: "switch port", Address: "0000:3b:00.0"},
+		{Kind: "root port", Address: "0000:3a:00.0"},
+	}, got)
+
+	_, err = getPCIeUpstreamPath("0000:ff:00.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const sysfsInfinibandDir = "/sys/class/infiniband"
+
+// RDMAThresholds defines the maximum tolerated error counters of an RDMA port.
+type RDMAThresholds struct {
+	SymbolErrors uint64
+	LinkDowned   uint64
+	RcvErrors    uint64
+}
+
+// DefaultRDMAThresholds tolerates a few symbol and receive errors, which occur
+// on healthy links at a low rate, but no link down events.
+var DefaultRDMAThresholds = RDMAThresholds{
+	SymbolErrors: 10,
+	LinkDowned:   0,
+	RcvErrors:    10,
+}
+
+// rdmaPort is the state of a port of an RDMA device, as read from sysfs.
+type rdmaPort struct {
+	Device       string
+	Port         string
+	State        string
+	PhysState    string
+	RateGbps     float64
+	SymbolErrors uint64
+	LinkDowned   uint64
+	RcvErrors    uint64
+}
+
+// gpuAffinity is the GPU closest to an RDMA device in the PCIe topology.
+type gpuAffinity struct {
+	GPUIndex int
+	// SharedSwitch is true if the device and the GPU are behind the same PCIe
+	// switch, which is required for efficient GPUDirect RDMA.
+	SharedSwitch bool
+	Hops         int
+}
+
+// checkRDMADevices checks the port state, link rate and error counters of
+// every RDMA device and maps each device to its nearest GPU. It returns nil if
+// there are no RDMA devices and none are expected.
+func (c *controller) checkRDMADevices(ctx context.Context) *DiagnoseResult {
+	entries, err := utils.ReadDir(sysfsInfinibandDir)
+	if err != nil && !os.IsNotExist(err) {
+		return &DiagnoseResult{
+			Name:      DiagnoseRDMADeviceStatus,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("checkRDMADevices() failed: %s", err),
+		}
+	}
+	if len(entries) == 0 && c.ExpectedRDMAPortCount == 0 {
+		return nil
+	}
+
+	gpuPaths := c.getNVIDIAGPUPCIePaths(ctx)
+	peermem := false
+	if modules, err := readKernelModules(); err == nil {
+		_, peermem = modules["nvidia_peermem"]
+	}
+
+	// Inactive ports are problems only if the ports are expected, they may be
+	// unused otherwise.
+	expected := c.ExpectedRDMAPortCount > 0 || c.ExpectedRDMARate > 0
+	var problems, inactive, summaries []string
+	activePorts := 0
+	for _, entry := range entries {
+		device := entry.Name()
+		ports, err := readRDMAPorts(device)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", device, err))
+			continue
+		}
+
+		for _, port := range ports {
+			name := fmt.Sprintf("%s/%s", port.Device, port.Port)
+			if port.State != "ACTIVE" || port.PhysState != "LinkUp" {
+				if expected {
+					problems = append(problems, fmt.Sprintf("%s is %s/%s", name, port.State, port.PhysState))
+				} else {
+					inactive = append(inactive, fmt.Sprintf("%s is %s/%s", name, port.State, port.PhysState))
+				}
+				continue
+			}
+			activePorts++
+
+			if c.ExpectedRDMARate > 0 && port.RateGbps < float64(c.ExpectedRDMARate) {
+				problems = append(problems, fmt.Sprintf("%s rate is %g Gb/s, expected %d Gb/s", name, port.RateGbps, c.ExpectedRDMARate))
+			}
+			if port.SymbolErrors > c.RDMAThresholds.SymbolErrors {
+				problems = append(problems, fmt.Sprintf("%s symbol_error=%d (threshold %d)", name, port.SymbolErrors, c.RDMAThresholds.SymbolErrors))
+			}
+			if port.LinkDowned > c.RDMAThresholds.LinkDowned {
+				problems = append(problems, fmt.Sprintf("%s link_downed=%d (threshold %d)", name, port.LinkDowned, c.RDMAThresholds.LinkDowned))
+			}
+			if port.RcvErrors > c.RDMAThresholds.RcvErrors {
+				problems = append(problems, fmt.Sprintf("%s port_rcv_errors=%d (threshold %d)", name, port.RcvErrors, c.RDMAThresholds.RcvErrors))
+			}
+		}
+
+		summaries = append(summaries, describeRDMAAffinity(device, gpuPaths, peermem))
+	}
+
+	if c.ExpectedRDMAPortCount > 0 && activePorts != c.ExpectedRDMAPortCount {
+		problems = append(problems, fmt.Sprintf("found %d active ports, expected %d", activePorts, c.ExpectedRDMAPortCount))
+	}
+
+	if len(problems) > 0 {
+		return &DiagnoseResult{
+			Name:      DiagnoseRDMADeviceStatus,
+			IsHealthy: utils.BoolPtr(false),
+			Message:   fmt.Sprintf("RDMA devices are not OK: %s; %s", strings.Join(problems, "; "), strings.Join(summaries, "; ")),
+		}
+	}
+
+	message := fmt.Sprintf("RDMA devices are OK, %d active ports", activePorts)
+	if len(inactive) > 0 {
+		message += fmt.Sprintf(", inactive ports: %s", strings.Join(inactive, ", "))
+	}
+	return &DiagnoseResult{
+		Name:      DiagnoseRDMADeviceStatus,
+		IsHealthy: utils.BoolPtr(true),
+		Message:   fmt.Sprintf("%s: %s", message, strings.Join(summaries, "; ")),
+	}
+}
+
+// readRDMAPorts reads the state of every port of the given RDMA device.
+func readRDMAPorts(device string) ([]*rdmaPort, error) {
+	portsDir := filepath.Join(sysfsInfinibandDir, device, "ports")
+	entries, err := utils.ReadDir(portsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []*rdmaPort
+	for _, entry := range entries {
+		portDir := filepath.Join(portsDir, entry.Name())
+		port := &rdmaPort{Device: device, Port: entry.Name()}
+
+		state, err := readSysfsString(filepath.Join(portDir, "state"))
+		if err != nil {
+			return nil, err
+		}
+		port.State = parseRDMAState(state)
+
+		physState, err := readSysfsString(filepath.Join(portDir, "phys_state"))
+		if err != nil {
+			return nil, err
+		}
+		port.PhysState = parseRDMAState(physState)
+
+		rate, err := readSysfsString(filepath.Join(portDir, "rate"))
+		if err != nil {
+			return nil, err
+		}
+		port.RateGbps, err = parseRDMARate(rate)
+		if err != nil {
+			return nil, err
+		}
+
+		counters := []struct {
+			name  string
+			value *uint64
+		}{
+			{"symbol_error", &port.SymbolErrors},
+			{"link_downed", &port.LinkDowned},
+			{"port_rcv_errors", &port.RcvErrors},
+		}
+		for _, counter := range counters {
+			value, err := readSysfsString(filepath.Join(portDir, "counters", counter.name))
+			if err != nil {
+				if os.IsNotExist(err) {
+					// RoCE ports of some devices do not expose IB counters.
+					continue
+				}
+				return nil, err
+			}
+			*counter.value, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s counter %q: %s", counter.name, value, err)
+			}
+		}
+
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+// getNVIDIAGPUPCIePaths returns the sysfs path of every GPU, GPUs whose bus id
+// cannot be resolved are skipped.
+func (c *controller) getNVIDIAGPUPCIePaths(ctx context.Context) map[int]string {
+	res := map[int]string{}
+	for _, i := range c.gpuIndexes() {
+		busID, err := c.getNVIDIAGPUBusID(ctx, i)
+		if err != nil {
+			continue
+		}
+		path, err := utils.EvalSymlinks(filepath.Join(sysfsPCIDevicesDir, busID))
+		if err != nil {
+			continue
+		}
+		res[i] = path
+	}
+
+	return res
+}
+
+func describeRDMAAffinity(device string, gpuPaths map[int]string, peermem bool) string {
+	devPath, err := utils.EvalSymlinks(filepath.Join(sysfsInfinibandDir, device, "device"))
+	if err != nil {
+		return fmt.Sprintf("%s: pci device unknown", device)
+	}
+
+	affinity := findNearestGPU(devPath, gpuPaths)
+	if affinity == nil {
+		return fmt.Sprintf("%s (%s): no gpu found", device, filepath.Base(devPath))
+	}
+
+	readiness := "GPUDirect RDMA ready"
+	switch {
+	case !affinity.SharedSwitch:
+		readiness = "GPUDirect RDMA not ready: no gpu behind the same pcie switch"
+	case !peermem:
+		readiness = "GPUDirect RDMA not ready: nvidia_peermem is not loaded"
+	}
+
+	return fmt.Sprintf("%s (%s): nearest gpu %d, %d hops, %s",
+		device, filepath.Base(devPath), affinity.GPUIndex, affinity.Hops, readiness)
+}
+
+// findNearestGPU returns the GPU with the fewest PCIe hops to the device at
+// the given sysfs path.
+func findNearestGPU(devPath string, gpuPaths map[int]string) *gpuAffinity {
+	indexes := make([]int, 0, len(gpuPaths))
+	for idx := range gpuPaths {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	devParts := strings.Split(filepath.Clean(devPath), string(filepath.Separator))
+	var nearest *gpuAffinity
+	for _, idx := range indexes {
+		gpuParts := strings.Split(filepath.Clean(gpuPaths[idx]), string(filepath.Separator))
+
+		common := 0
+		for common < len(devParts) && common < len(gpuParts) && devParts[common] == gpuParts[common] {
+			common++
+		}
+		hops := len(devParts) - common + len(gpuParts) - common
+		// The common ancestor is a PCIe switch port if it has a PCI address and
+		// so does its parent. It is a root port if its parent is the root
+		// complex, e.g. pci0000:00, where peer to peer traffic crosses the CPU.
+		sharedSwitch := common > 1 && pciAddressRegexp.MatchString(devParts[common-1]) &&
+			pciAddressRegexp.MatchString(devParts[common-2])
+
+		if nearest == nil || hops < nearest.Hops {
+			nearest = &gpuAffinity{GPUIndex: idx, SharedSwitch: sharedSwitch, Hops: hops}
+		}
+	}
+
+	return nearest
+}
+
+// parseRDMAState parses a state such as "4: ACTIVE" or "5: LinkUp".
+func parseRDMAState(state string) string {
+	if _, name, ok := strings.Cut(state, ":"); ok {
+		return strings.TrimSpace(name)
+	}
+	return state
+}
+
+// parseRDMARate parses a rate such as "200 Gb/sec (4X HDR)" into Gb/s.
+func parseRDMARate(rate string) (float64, error) {
+	fields := strings.Fields(rate)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %s", rate, err)
+	}
+
+	return value, nil
+}
+
+func readSysfsString(path string) (string, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,198 @@
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeRDMADevice creates an RDMA device with a single port, linked to the
+// PCI device along the given hierarchy.
+func newFakeRDMADevice(t *testing.T, root, device string, port map[string]string, hierarchy ...string) {
+	t.Helper()
+
+	newFakePCIDevice(t, root, hierarchy...)
+	devDir := filepath.Join(root, sysfsInfinibandDir, device)
+	portDir := filepath.Join(devDir, "ports", "1")
+	if err := os.MkdirAll(filepath.Join(portDir, "counters"), 0755); err != nil {
+		t.Fatalf("failed to create port dir: %v", err)
+	}
+	target := filepath.Join(append([]string{"..", "..", "..", "devices", "pci0000:00"}, hierarchy...)...)
+	if err := os.Symlink(target, filepath.Join(devDir, "device")); err != nil {
+		t.Fatalf("failed to create device link: %v", err)
+	}
+	for name, content := range port {
+		if err := os.WriteFile(filepath.Join(portDir, name), []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func healthyRDMAPort() map[string]string {
+	return map[string]string{
+		"state":                    "4: ACTIVE",
+		"phys_state":               "5: LinkUp",
+		"rate":                     "200 Gb/sec (4X HDR)",
+		"counters/symbol_error":    "0",
+		"counters/link_downed":     "0",
+		"counters/port_rcv_errors": "0",
+	}
+}
+
+func TestParseRDMARate(t *testing.T) {
+	got, err := parseRDMARate("200 Gb/sec (4X HDR)")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(200), got)
+
+	got, err = parseRDMARate("2.5 Gb/sec (1X SDR)")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, got)
+
+	_, err = parseRDMARate("")
+	assert.Error(t, err)
+}
+
+func TestCheckRDMADevices(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports map[string]map[string]string
+		// hierarchies override the PCIe hierarchies of the devices.
+		hierarchies     map[string][]string
+		expectedPorts   int
+		expectedRate    int
+		wantNil         bool
+		wantHealthy     bool
+		wantMsgContains []string
+	}{
+		{
+			name:    "no rdma devices",
+			ports:   map[string]map[string]string{},
+			wantNil: true,
+		},
+		{
+			name:          "no rdma devices but expected",
+			ports:         map[string]map[string]string{},
+			expectedPorts: 2,
+			wantHealthy:   false,
+			wantMsgContains: []string{
+				"found 0 active ports, expected 2",
+			},
+		},
+		{
+			name: "healthy devices",
+			ports: map[string]map[string]string{
+				"mlx5_0": healthyRDMAPort(),
+				"mlx5_1": healthyRDMAPort(),
+			},
+			expectedPorts: 2,
+			expectedRate:  200,
+			wantHealthy:   true,
+			wantMsgContains: []string{
+				"mlx5_0 (0000:3e:00.0): nearest gpu 0, 4 hops, GPUDirect RDMA ready",
+				"mlx5_1 (0000:81:00.0): nearest gpu 0, 6 hops, GPUDirect RDMA not ready: no gpu behind the same pcie switch",
+			},
+		},
+		{
+			name: "degraded devices",
+			ports: map[string]map[string]string{
+				"mlx5_0": func() map[string]string {
+					port := healthyRDMAPort()
+					port["rate"] = "100 Gb/sec (4X EDR)"
+					port["counters/symbol_error"] = "65535"
+					port["counters/link_downed"] = "3"
+					return port
+				}(),
+				"mlx5_1": func() map[string]string {
+					port := healthyRDMAPort()
+					port["state"] = "1: DOWN"
+					port["phys_state"] = "3: Disabled"
+					return port
+				}(),
+			},
+			expectedPorts: 2,
+			expectedRate:  200,
+			wantHealthy:   false,
+			wantMsgContains: []string{
+				"mlx5_0/1 rate is 100 Gb/s, expected 200 Gb/s",
+				"mlx5_0/1 symbol_error=65535 (threshold 10)",
+				"mlx5_0/1 link_downed=3 (threshold 0)",
+				"mlx5_1/1 is DOWN/Disabled",
+				"found 1 active ports, expected 2",
+			},
+		},
+		{
+			name: "inactive ports without expectations",
+			ports: map[string]map[string]string{
+				"mlx5_0": healthyRDMAPort(),
+				"mlx5_1": func() map[string]string {
+					port := healthyRDMAPort()
+					port["state"] = "1: DOWN"
+					port["phys_state"] = "3: Disabled"
+					return port
+				}(),
+			},
+			wantHealthy: true,
+			wantMsgContains: []string{
+				"RDMA devices are OK, 1 active ports, inactive ports: mlx5_1/1 is DOWN/Disabled",
+			},
+		},
+		{
+			name: "device behind the root port of the gpu",
+			ports: map[string]map[string]string{
+				"mlx5_0": healthyRDMAPort(),
+			},
+			hierarchies: map[string][]string{
+				"mlx5_0": {"0000:3a:00.0", "0000:3f:00.0"},
+			},
+			wantHealthy: true,
+			wantMsgContains: []string{
+				"mlx5_0 (0000:3f:00.0): nearest gpu 0, 4 hops, GPUDirect RDMA not ready: no gpu behind the same pcie switch",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			newFakePCIDevice(t, root, "0000:3a:00.0", "0000:3b:00.0", "0000:3c:08.0", "0000:3d:00.0")
+			hierarchies := map[string][]string{
+				"mlx5_0": {"0000:3a:00.0", "0000:3b:00.0", "0000:3c:10.0", "0000:3e:00.0"},
+				"mlx5_1": {"0000:80:00.0", "0000:81:00.0"},
+			}
+			for device, hierarchy := range tt.hierarchies {
+				hierarchies[device] = hierarchy
+			}
+			for device, port := range tt.ports {
+				newFakeRDMADevice(t, root, device, port, hierarchies[device]...)
+			}
+			writeTestFile(t, root, procModulesFile, "nvidia_peermem 16384 0 - Live 0x0000000000000000 (OE)\n")
+			cleanupFS := utils.SetFSRoot(root)
+			defer cleanupFS()
+
+			c := &controller{
+				ExpectedCardCount:     1,
+				ExpectedRDMAPortCount: tt.expectedPorts,
+				ExpectedRDMARate:      tt.expectedRate,
+				RDMAThresholds:        DefaultRDMAThresholds,
+				gpuIDs:                map[int]GPUUID{0: "GPU-uuid-1"},
+				gpuBusIDs:             map[int]string{0: "0000:3d:00.0"},
+			}
+			got := c.checkRDMADevices(context.Background())
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NotNil(t, got)
+			assert.Equal(t, DiagnoseRDMADeviceStatus, got.Name)
+			assert.Equal(t, tt.wantHealthy, *got.IsHealthy, got.Message)
+			for _, want := range tt.wantMsgContains {
+				assert.Contains(t, got.Message, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package diagnose
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// Snapshot is the raw device state collected during the latest Check, such as
+// counters and link widths, which the DiagnoseResults only summarize.
+type Snapshot struct {
+	Vendor utils.VendorType
+	GPUs   map[GPUUID]*GPUSnapshot
+}
+
+// GPUSnapshot is the raw state of a single GPU. Values which were not
+// collected, e.g. because an earlier check failed, are nil.
+type GPUSnapshot struct {
+	Index            int
+	LinkWidthCurrent *int
+	LinkWidthMax     *int
+	ECCCorrected     *uint64
+	ECCUncorrected   *uint64
+	PCIeAERCorrected *uint64
+	PCIeAERNonFatal  *uint64
+	PCIeAERFatal     *uint64
+}
+
+// Snapshotter is implemented by Diagnosers which expose the device state
+// collected during the latest Check.
+type Snapshotter interface {
+	// Snapshot returns the device state of the latest Check, or nil if no
+	// Check has run yet.
+	Snapshot() *Snapshot
+}
+
+func (c *controller) Snapshot() *Snapshot {
+	if c.vendor == "" {
+		return nil
+	}
+
+	snapshot := &Snapshot{
+		Vendor: c.vendor,
+		GPUs:   make(map[GPUUID]*GPUSnapshot, len(c.gpuSnapshots)),
+	}
+	for idx, gpu := range c.gpuSnapshots {
+		uuid, ok := c.gpuIDs[idx]
+		if !ok {
+			continue
+		}
+		copied := *gpu
+		snapshot.GPUs[uuid] = &copied
+	}
+
+	return snapshot
+}
+
+// gpuSnapshot returns the snapshot of the GPU at the given index, creating it
+// if needed.
+func (c *controller) gpuSnapshot(cardIdx int) *GPUSnapshot {
+	if c.gpuSnapshots == nil {
+		c.gpuSnapshots = map[int]*GPUSnapshot{}
+	}
+	gpu, ok := c.gpuSnapshots[cardIdx]
+	if !ok {
+		gpu = &GPUSnapshot{Index: cardIdx}
+		c.gpuSnapshots[cardIdx] = gpu
+	}
+
+	return gpu
+}
+
+// parseNVIDIASMIInt parses a numeric nvidia-smi value, returning nil for
+// values such as "[N/A]" or "[Not Supported]".
+func parseNVIDIASMIInt(value string) *int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func parseNVIDIASMIUint(value string) *uint64 {
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,36 @@
+package diagnose
+
+import (
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNVIDIASMIInt(t *testing.T) {
+	assert.Equal(t, 16, *parseNVIDIASMIInt(" 16\n"))
+	assert.Nil(t, parseNVIDIASMIInt("[N/A]"))
+	assert.Equal(t, uint64(3), *parseNVIDIASMIUint("3"))
+	assert.Nil(t, parseNVIDIASMIUint("[Not Supported]"))
+}
+
+func TestSnapshot(t *testing.T) {
+	c := &controller{}
+	assert.Nil(t, c.Snapshot())
+
+	c.vendor = utils.NvidiaVendor
+	c.gpuIDs = map[int]GPUUID{0: "GPU-uuid-1"}
+	c.gpuSnapshot(0).LinkWidthMax = parseNVIDIASMIInt("16")
+	// GPUs without a known UUID are skipped.
+	c.gpuSnapshot(1).LinkWidthMax = parseNVIDIASMIInt("16")
+
+	got := c.Snapshot()
+	assert.Equal(t, utils.NvidiaVendor, got.Vendor)
+	assert.Len(t, got.GPUs, 1)
+	assert.Equal(t, 0, got.GPUs["GPU-uuid-1"].Index)
+	assert.Equal(t, 16, *got.GPUs["GPU-uuid-1"].LinkWidthMax)
+
+	// The snapshot is not affected by later runs.
+	c.gpuSnapshot(0).LinkWidthMax = parseNVIDIASMIInt("8")
+	assert.Equal(t, 16, *got.GPUs["GPU-uuid-1"].LinkWidthMax)
+}
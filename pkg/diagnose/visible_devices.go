@@ -0,0 +1,130 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	envNVIDIAVisibleDevices = "NVIDIA_VISIBLE_DEVICES"
+	envCUDAVisibleDevices   = "CUDA_VISIBLE_DEVICES"
+)
+
+// VisibleDevicesFromEnv returns the GPUs allocated to the current container,
+// as indices or UUIDs, and their count. The count is 0 if all GPUs are
+// visible.
+//
+// CUDA_VISIBLE_DEVICES takes precedence, its indices are matched against the
+// nvidia-smi indices. Indices in NVIDIA_VISIBLE_DEVICES are host indices,
+// which are renumbered inside the container, so only its UUIDs are returned
+// while its indices only determine the count.
+func VisibleDevicesFromEnv(getenv func(string) string) ([]string, int, error) {
+	if devices := splitVisibleDevices(getenv(envCUDAVisibleDevices)); len(devices) > 0 {
+		return devices, len(devices), nil
+	}
+
+	value := strings.TrimSpace(getenv(envNVIDIAVisibleDevices))
+	switch value {
+	case "", "all":
+		return nil, 0, nil
+	case "none", "void":
+		return nil, 0, fmt.Errorf("%s is %q, no GPU is visible", envNVIDIAVisibleDevices, value)
+	}
+
+	devices := splitVisibleDevices(value)
+	for _, device := range devices {
+		if !strings.HasPrefix(device, "GPU-") {
+			return nil, len(devices), nil
+		}
+	}
+
+	return devices, len(devices), nil
+}
+
+func splitVisibleDevices(value string) []string {
+	var devices []string
+	for _, device := range strings.Split(value, ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// VisibleDevicesEnvSet returns whether NVIDIA_VISIBLE_DEVICES or
+// CUDA_VISIBLE_DEVICES is set, i.e. the process runs in a container with GPUs
+// allocated to it.
+func VisibleDevicesEnvSet(getenv func(string) string) bool {
+	return strings.TrimSpace(getenv(envNVIDIAVisibleDevices)) != "" ||
+		strings.TrimSpace(getenv(envCUDAVisibleDevices)) != ""
+}
+
+// resolveVisibleDevices maps the visible devices to the GPUs listed by
+// nvidia-smi, scoping the checks to them, and returns the devices which were
+// not found. Without visible devices, the checks are scoped to every GPU
+// nvidia-smi lists.
+func (c *controller) resolveVisibleDevices(ctx context.Context) ([]string, error) {
+	gpus, _, err := listNVIDIASMIGPUs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.visibleIndexes = []int{}
+	c.visibleBusIDs = map[string]bool{}
+	if len(c.visibleDevices) == 0 {
+		for _, gpu := range gpus {
+			c.visibleIndexes = append(c.visibleIndexes, gpu.Index)
+			c.gpuIDs[gpu.Index] = gpu.UUID
+			c.gpuBusIDs[gpu.Index] = gpu.BusID
+			c.visibleBusIDs[gpu.BusID] = true
+		}
+		sort.Ints(c.visibleIndexes)
+		return nil, nil
+	}
+
+	var missing []string
+	for _, device := range c.visibleDevices {
+		found := false
+		for _, gpu := range gpus {
+			if device != strconv.Itoa(gpu.Index) && device != string(gpu.UUID) {
+				continue
+			}
+			if _, ok := c.gpuIDs[gpu.Index]; !ok {
+				c.visibleIndexes = append(c.visibleIndexes, gpu.Index)
+			}
+			c.gpuIDs[gpu.Index] = gpu.UUID
+			c.gpuBusIDs[gpu.Index] = gpu.BusID
+			c.visibleBusIDs[gpu.BusID] = true
+			found = true
+			break
+		}
+		if !found {
+			missing = append(missing, device)
+		}
+	}
+	sort.Ints(c.visibleIndexes)
+
+	return missing, nil
+}
+
+// gpuIndexes returns the nvidia-smi indices of the GPUs to check.
+func (c *controller) gpuIndexes() []int {
+	if c.visibleIndexes != nil {
+		return c.visibleIndexes
+	}
+
+	indexes := make([]int, 0, len(c.gpuIDs))
+	for i := range c.gpuIDs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// inScope returns whether the GPU at the given bus id is checked.
+func (c *controller) inScope(busID string) bool {
+	return c.visibleBusIDs == nil || c.visibleBusIDs[busID]
+}
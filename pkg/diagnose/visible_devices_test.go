@@ -0,0 +1,226 @@
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisibleDevicesFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantDevices []string
+		wantCount   int
+		wantSet     bool
+		wantErr     string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:    "all visible",
+			env:     map[string]string{envNVIDIAVisibleDevices: "all"},
+			wantSet: true,
+		},
+		{
+			name:    "none visible",
+			env:     map[string]string{envNVIDIAVisibleDevices: "void"},
+			wantSet: true,
+			wantErr: `NVIDIA_VISIBLE_DEVICES is "void", no GPU is visible`,
+		},
+		{
+			name:        "nvidia uuids",
+			env:         map[string]string{envNVIDIAVisibleDevices: "GPU-uuid-1, GPU-uuid-2"},
+			wantDevices: []string{"GPU-uuid-1", "GPU-uuid-2"},
+			wantCount:   2,
+			wantSet:     true,
+		},
+		{
+			name:      "nvidia host indices only count",
+			env:       map[string]string{envNVIDIAVisibleDevices: "4,5,6"},
+			wantCount: 3,
+			wantSet:   true,
+		},
+		{
+			name: "cuda takes precedence",
+			env: map[string]string{
+				envNVIDIAVisibleDevices: "all",
+				envCUDAVisibleDevices:   "1,GPU-uuid-3",
+			},
+			wantDevices: []string{"1", "GPU-uuid-3"},
+			wantCount:   2,
+			wantSet:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			assert.Equal(t, tt.wantSet, VisibleDevicesEnvSet(getenv))
+			devices, count, err := VisibleDevicesFromEnv(getenv)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDevices, devices)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+}
+
+func TestNewControllerVisibleDevices(t *testing.T) {
+	diagnoser, err := NewController(&Config{VisibleDevices: []string{"0", "1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, diagnoser.(*controller).ExpectedCardCount)
+
+	_, err = NewController(&Config{ExpectedCardCount: 4, VisibleDevices: []string{"0", "1"}})
+	assert.EqualError(t, err, "expected card count 4 does not match 2 visible devices")
+}
+
+func TestCheckNVIDIAVisibleDevices(t *testing.T) {
+	smiGPUs := "0, 00000000:07:00.0, GPU-uuid-1\n" +
+		"1, 00000000:0F:00.0, GPU-uuid-2\n" +
+		"2, 00000000:47:00.0, GPU-uuid-3\n" +
+		"3, 00000000:4E:00.0, GPU-uuid-4\n"
+	commands := map[string]string{
+		"nvidia-smi -L": "GPU 0: NVIDIA A100",
+		"nvidia-smi --query-gpu=index,pci.bus_id,uuid --format=csv,noheader": smiGPUs,
+	}
+	for _, idx := range []string{"1", "2"} {
+		commands["nvidia-smi -i "+idx+" --query-gpu=pcie.link.width.max --format=csv,noheader"] = "16"
+		commands["nvidia-smi -i "+idx+" --query-gpu=pcie.link.width.current --format=csv,noheader"] = "16"
+	}
+
+	tests := []struct {
+		name           string
+		visibleDevices []string
+		wantGPUs       []GPUUID
+		// wantCardCount is a part of the message of the card count, which is
+		// unhealthy if set.
+		wantCardCount string
+	}{
+		{
+			name:           "indices and uuids",
+			visibleDevices: []string{"GPU-uuid-3", "1"},
+			wantGPUs:       []GPUUID{"GPU-uuid-2", "GPU-uuid-3"},
+		},
+		{
+			name:           "visible device not found",
+			visibleDevices: []string{"GPU-uuid-3", "GPU-uuid-9"},
+			wantGPUs:       []GPUUID{"GPU-uuid-3", "GPU-uuid-9"},
+			wantCardCount:  "GPU Card Count: 1, Expected: 2, visible devices not found: GPU-uuid-9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanupFS := utils.SetFSRoot(t.TempDir())
+			defer cleanupFS()
+			mock := &mockExecCmd{
+				commands:     commands,
+				pipeCommands: map[string]string{"nvidia-smi -L | wc -l": "4"},
+			}
+			cleanup := utils.SetExecCmd(mock.exec)
+			cleanupPipe := utils.SetExecPipeCmd(mock.execPipe)
+			defer cleanup()
+			defer cleanupPipe()
+
+			diagnoser, err := NewController(&Config{VisibleDevices: tt.visibleDevices})
+			assert.NoError(t, err)
+			c := diagnoser.(*controller)
+			results, err := c.checkNVIDIA(context.Background())
+			assert.NoError(t, err)
+			var gpus []GPUUID
+			for uuid := range results {
+				if uuid != GPUUUIDOverall {
+					gpus = append(gpus, uuid)
+				}
+			}
+			assert.ElementsMatch(t, tt.wantGPUs, gpus)
+			// Node checks are not run in the scope of the visible devices.
+			for _, result := range results[GPUUUIDOverall] {
+				assert.NotContains(t, []DiagnoseType{DiagnoseGPUContainerRuntime, DiagnoseRDMADeviceStatus}, result.Name)
+			}
+			assert.Equal(t, DiagnoseGPUCardCount, results[GPUUUIDOverall][1].Name)
+			assert.Equal(t, tt.wantCardCount == "", *results[GPUUUIDOverall][1].IsHealthy, results[GPUUUIDOverall][1].Message)
+			assert.Contains(t, results[GPUUUIDOverall][1].Message, tt.wantCardCount)
+			for _, result := range results["GPU-uuid-3"] {
+				if result.Name == DiagnoseGPULinkStatus {
+					assert.True(t, *result.IsHealthy, result.Message)
+				}
+			}
+			if tt.wantCardCount != "" {
+				missing := results["GPU-uuid-9"]
+				assert.Len(t, missing, 1)
+				assert.Equal(t, DiagnoseGPUCardCount, missing[0].Name)
+				assert.False(t, *missing[0].IsHealthy)
+			}
+			for _, result := range results["GPU-uuid-2"] {
+				if result.Name == DiagnoseGPULinkStatus {
+					assert.True(t, *result.IsHealthy, result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckNVIDIAContainerScoped(t *testing.T) {
+	// NVIDIA_VISIBLE_DEVICES=4,5 only gives the count, nvidia-smi and the
+	// driver in the container list the two allocated GPUs renumbered, while
+	// sysfs lists every GPU of the node.
+	_, count, err := VisibleDevicesFromEnv(func(key string) string {
+		return map[string]string{envNVIDIAVisibleDevices: "4,5"}[key]
+	})
+	assert.NoError(t, err)
+
+	root := t.TempDir()
+	for _, busID := range []string{"0000:07:00.0", "0000:0f:00.0", "0000:47:00.0", "0000:4e:00.0"} {
+		newFakeNVIDIADevice(t, root, busID, "0x030200")
+	}
+	for _, busID := range []string{"0000:47:00.0", "0000:4e:00.0"} {
+		if err := os.MkdirAll(filepath.Join(root, procNVIDIAGPUsDir, busID), 0755); err != nil {
+			t.Fatalf("failed to create driver gpu dir: %v", err)
+		}
+	}
+	cleanupFS := utils.SetFSRoot(root)
+	defer cleanupFS()
+
+	commands := map[string]string{
+		"nvidia-smi -L": "GPU 0: NVIDIA A100",
+		"nvidia-smi --query-gpu=index,pci.bus_id,uuid --format=csv,noheader": "0, 00000000:47:00.0, GPU-uuid-5\n" +
+			"1, 00000000:4E:00.0, GPU-uuid-6\n",
+	}
+	mock := &mockExecCmd{
+		commands:     commands,
+		pipeCommands: map[string]string{"nvidia-smi -L | wc -l": "2"},
+	}
+	cleanup := utils.SetExecCmd(mock.exec)
+	cleanupPipe := utils.SetExecPipeCmd(mock.execPipe)
+	defer cleanup()
+	defer cleanupPipe()
+
+	diagnoser, err := NewController(&Config{ExpectedCardCount: count, ContainerScoped: true})
+	assert.NoError(t, err)
+	results, err := diagnoser.(*controller).checkNVIDIA(context.Background())
+	assert.NoError(t, err)
+
+	var gpus []GPUUID
+	for uuid := range results {
+		if uuid != GPUUUIDOverall {
+			gpus = append(gpus, uuid)
+		}
+	}
+	assert.ElementsMatch(t, []GPUUID{"GPU-uuid-5", "GPU-uuid-6"}, gpus)
+	for _, result := range results[GPUUUIDOverall] {
+		assert.NotContains(t, []DiagnoseType{DiagnoseGPUContainerRuntime, DiagnoseRDMADeviceStatus}, result.Name)
+		if result.Name == DiagnoseGPUCardCount || result.Name == DiagnoseGPUBusPresence {
+			assert.True(t, *result.IsHealthy, result.Message)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/aibrix/ai-accelerator-tool/pkg/api/v1"
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+// DefaultPath is the well-known path of the health file.
+const DefaultPath = "/var/run/ai-accelerator-tool/gpu-health.json"
+
+// nodeChecks break every GPU of the node when they fail, other node level
+// checks such as the container runtime do not affect the devices themselves.
+var nodeChecks = map[diagnose.DiagnoseType]bool{
+	diagnose.DiagnoseGPUDriverStatus:  true,
+	diagnose.DiagnoseGPUKernelModules: true,
+	diagnose.DiagnoseGPUDeviceNodes:   true,
+}
+
+// Publisher writes the per GPU health of every run to a JSON file.
+type Publisher struct {
+	path string
+
+	mu sync.Mutex
+	// known are the GPUs of the latest run with per GPU results, which are
+	// still reported when a node check or the diagnosis fails and none are
+	// available.
+	known map[diagnose.GPUUID]bool
+}
+
+func NewPublisher(path string) (*Publisher, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	return &Publisher{
+		path:  path,
+		known: make(map[diagnose.GPUUID]bool),
+	}, nil
+}
+
+// Publish writes the health of the run. A failed run is published with its
+// error and every known GPU unhealthy, since their health is unknown and
+// consumers must not keep relying on the previous state.
+func (p *Publisher) Publish(run *monitor.Run) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := p.newDeviceHealthList(run)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(p.path, data)
+}
+
+func (p *Publisher) newDeviceHealthList(run *monitor.Run) *v1.DeviceHealthList {
+	var nodeProblems []string
+	if run.Err != nil {
+		nodeProblems = append(nodeProblems, fmt.Sprintf("diagnosis failed: %s", run.Err))
+	}
+	for _, result := range run.Results[diagnose.GPUUUIDOverall] {
+		if result != nil && result.IsHealthy != nil && !*result.IsHealthy && nodeChecks[result.Name] {
+			nodeProblems = append(nodeProblems, string(result.Name))
+		}
+	}
+
+	current := map[diagnose.GPUUID]bool{}
+	for uuid := range run.Results {
+		if uuid != diagnose.GPUUUIDOverall {
+			current[uuid] = true
+		}
+	}
+	if len(current) > 0 {
+		p.known = current
+	}
+	uuids := make([]string, 0, len(p.known))
+	for uuid := range p.known {
+		uuids = append(uuids, string(uuid))
+	}
+	sort.Strings(uuids)
+
+	list := &v1.DeviceHealthList{
+		APIVersion: v1.APIVersion,
+		Time:       run.Time,
+		Devices:    []v1.DeviceHealth{},
+	}
+	if run.Err != nil {
+		list.Error = run.Err.Error()
+	}
+	for _, uuid := range uuids {
+		problems := append([]string(nil), nodeProblems...)
+		for _, result := range run.Results[diagnose.GPUUID(uuid)] {
+			if result != nil && result.IsHealthy != nil && !*result.IsHealthy {
+				problems = append(problems, fmt.Sprintf("%s: %s", result.Name, result.Message))
+			}
+		}
+		list.Devices = append(list.Devices, v1.DeviceHealth{
+			UUID:    uuid,
+			Healthy: len(problems) == 0,
+			Reason:  strings.Join(problems, "; "),
+		})
+	}
+
+	return list
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and renames
+// it, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
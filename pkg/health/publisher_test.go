@@ -0,0 +1,104 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/aibrix/ai-accelerator-tool/pkg/api/v1"
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func readHealthFile(t *testing.T, path string) *v1.DeviceHealthList {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	list := &v1.DeviceHealthList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+	return list
+}
+
+func TestPublish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "gpu-health.json")
+	publisher, err := NewPublisher(path)
+	assert.NoError(t, err)
+
+	// A bad GPU does not affect the others.
+	err = publisher.Publish(&monitor.Run{
+		Time: time.Unix(1700000000, 0).UTC(),
+		Results: map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			diagnose.GPUUUIDOverall: {
+				{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+				{Name: diagnose.DiagnoseGPUContainerRuntime, IsHealthy: utils.BoolPtr(false)},
+			},
+			"GPU-uuid-1": {
+				{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+			},
+			"GPU-uuid-2": {
+				{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+				{Name: diagnose.DiagnoseGPUnrecoverableErrors, IsHealthy: utils.BoolPtr(false), Message: "found ecc errors: 2"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.DeviceHealthList{
+		APIVersion: v1.APIVersion,
+		Time:       time.Unix(1700000000, 0).UTC(),
+		Devices: []v1.DeviceHealth{
+			{UUID: "GPU-uuid-1", Healthy: true},
+			{UUID: "GPU-uuid-2", Healthy: false, Reason: "gpu_vram_unrecoverable_errors: found ecc errors: 2"},
+		},
+	}, readHealthFile(t, path))
+
+	// A failed run marks every known GPU unhealthy.
+	err = publisher.Publish(&monitor.Run{Time: time.Unix(1700000060, 0).UTC(), Err: fmt.Errorf("context deadline exceeded")})
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.DeviceHealthList{
+		APIVersion: v1.APIVersion,
+		Time:       time.Unix(1700000060, 0).UTC(),
+		Error:      "context deadline exceeded",
+		Devices: []v1.DeviceHealth{
+			{UUID: "GPU-uuid-1", Healthy: false, Reason: "diagnosis failed: context deadline exceeded"},
+			{UUID: "GPU-uuid-2", Healthy: false, Reason: "diagnosis failed: context deadline exceeded"},
+		},
+	}, readHealthFile(t, path))
+
+	// A driver failure marks every known GPU unhealthy.
+	err = publisher.Publish(&monitor.Run{
+		Time: time.Unix(1700000120, 0).UTC(),
+		Results: map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			diagnose.GPUUUIDOverall: {
+				{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(false)},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	got := readHealthFile(t, path)
+	assert.Len(t, got.Devices, 2)
+	for _, device := range got.Devices {
+		assert.False(t, device.Healthy)
+		assert.Equal(t, "gpu_driver_status", device.Reason)
+	}
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestNewPublisher(t *testing.T) {
+	_, err := NewPublisher("")
+	assert.EqualError(t, err, "path is required")
+}
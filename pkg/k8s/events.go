@@ -0,0 +1,166 @@
+package k8s
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+const (
+	// DefaultEventDedupWindow suppresses identical events of a flapping check.
+	DefaultEventDedupWindow = 10 * time.Minute
+	// DefaultEventQPS and DefaultEventBurst bound the events of a node, e.g.
+	// when every GPU fails at once.
+	DefaultEventQPS   = 1.0 / 30
+	DefaultEventBurst = 20
+)
+
+// eventReason is the reason of the events of a check when it becomes
+// unhealthy and when it recovers.
+type eventReason struct {
+	Unhealthy string
+	Recovered string
+}
+
+var eventReasons = map[diagnose.DiagnoseType]eventReason{
+	diagnose.DiagnoseGPUDriverStatus:       {"GPUDriverFailure", "GPUDriverRecovered"},
+	diagnose.DiagnoseGPUKernelModules:      {"GPUKernelModuleMissing", "GPUKernelModuleRecovered"},
+	diagnose.DiagnoseGPUDeviceNodes:        {"GPUDeviceNodeMissing", "GPUDeviceNodeRecovered"},
+	diagnose.DiagnoseGPUCardCount:          {"GPUCountMismatch", "GPUCountRecovered"},
+	diagnose.DiagnoseGPUBusPresence:        {"GPUFallenOffBus", "GPUBusPresenceRecovered"},
+	diagnose.DiagnoseGPULinkStatus:         {"GPULinkDegraded", "GPULinkRecovered"},
+	diagnose.DiagnoseGPUnrecoverableErrors: {"GPUUncorrectableECCError", "GPUUncorrectableECCRecovered"},
+	diagnose.DiagnoseGPURecoverableErrors:  {"GPUCorrectableECCError", "GPUCorrectableECCRecovered"},
+	diagnose.DiagnoseGPUPCIeAERErrors:      {"GPUPCIeAERError", "GPUPCIeAERRecovered"},
+	diagnose.DiagnoseGPUContainerRuntime:   {"GPUContainerRuntimeMisconfigured", "GPUContainerRuntimeRecovered"},
+	diagnose.DiagnoseRDMADeviceStatus:      {"RDMADeviceDegraded", "RDMADeviceRecovered"},
+	monitor.CheckDiagnosis:                 {"GPUDiagnosisFailed", "GPUDiagnosisRecovered"},
+}
+
+// EventReason returns the reason of an event of the check.
+func EventReason(check diagnose.DiagnoseType, healthy bool) string {
+	reason, ok := eventReasons[check]
+	if !ok {
+		base := string(ProblemConditionType(check))
+		reason = eventReason{Unhealthy: base, Recovered: base + "Recovered"}
+	}
+	if healthy {
+		return reason.Recovered
+	}
+	return reason.Unhealthy
+}
+
+type EventConfig struct {
+	Recorder record.EventRecorder
+	NodeName string
+	// DedupWindow defaults to DefaultEventDedupWindow if 0.
+	DedupWindow time.Duration
+	// QPS and Burst default to DefaultEventQPS and DefaultEventBurst if 0.
+	QPS   float32
+	Burst int
+}
+
+// EventEmitter records health transitions as events of the Node object.
+type EventEmitter struct {
+	recorder    record.EventRecorder
+	node        *corev1.ObjectReference
+	dedupWindow time.Duration
+	limiter     flowcontrol.RateLimiter
+	now         func() time.Time
+
+	mu sync.Mutex
+	// emitted is the last time of every emitted event.
+	emitted map[string]time.Time
+}
+
+func NewEventEmitter(config *EventConfig) (*EventEmitter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if config.Recorder == nil {
+		return nil, fmt.Errorf("recorder is required")
+	}
+	if config.NodeName == "" {
+		return nil, fmt.Errorf("node name is required")
+	}
+
+	dedupWindow := config.DedupWindow
+	if dedupWindow == 0 {
+		dedupWindow = DefaultEventDedupWindow
+	}
+	qps := config.QPS
+	if qps == 0 {
+		qps = DefaultEventQPS
+	}
+	burst := config.Burst
+	if burst == 0 {
+		burst = DefaultEventBurst
+	}
+
+	return &EventEmitter{
+		recorder: config.Recorder,
+		// Node events use the node name as UID, as the kubelet does.
+		node: &corev1.ObjectReference{
+			Kind: "Node",
+			Name: config.NodeName,
+			UID:  types.UID(config.NodeName),
+		},
+		dedupWindow: dedupWindow,
+		limiter:     flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		now:         time.Now,
+		emitted:     make(map[string]time.Time),
+	}, nil
+}
+
+// Emit records the transition as a Warning event if the check became
+// unhealthy and a Normal event if it recovered. Identical events within the
+// dedup window and events over the rate limit are dropped.
+func (e *EventEmitter) Emit(event *monitor.Event) {
+	eventType := corev1.EventTypeWarning
+	state := "unhealthy"
+	if event.Healthy {
+		eventType = corev1.EventTypeNormal
+		state = "healthy"
+	}
+	reason := EventReason(event.Check, event.Healthy)
+
+	target := fmt.Sprintf("GPU %s", event.GPU)
+	if event.GPU == diagnose.GPUUUIDOverall {
+		target = "Node"
+	}
+	message := fmt.Sprintf("%s: %s is %s", target, event.Check, state)
+	if event.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, event.Message)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%s", event.GPU, reason, message)
+	now := e.now()
+	if last, ok := e.emitted[key]; ok && now.Sub(last) < e.dedupWindow {
+		klog.V(2).InfoS("Dropped duplicate event", "reason", reason, "message", message)
+		return
+	}
+	if !e.limiter.TryAccept() {
+		klog.InfoS("Dropped rate limited event", "reason", reason, "message", message)
+		return
+	}
+
+	e.emitted[key] = now
+	for k, last := range e.emitted {
+		if now.Sub(last) >= e.dedupWindow {
+			delete(e.emitted, k)
+		}
+	}
+	e.recorder.Event(e.node, eventType, reason, message)
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+// drainEvents returns the events recorded so far.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventReason(t *testing.T) {
+	for _, check := range diagnose.AllDiagnoseTypes {
+		assert.Contains(t, eventReasons, check, "check %s has no event reason", check)
+	}
+	assert.Equal(t, "GPULinkDegraded", EventReason(diagnose.DiagnoseGPULinkStatus, false))
+	assert.Equal(t, "GPULinkRecovered", EventReason(diagnose.DiagnoseGPULinkStatus, true))
+	assert.Equal(t, "GPUFallenOffBus", EventReason(diagnose.DiagnoseGPUBusPresence, false))
+	assert.Equal(t, "GPUDiagnosisFailed", EventReason(monitor.CheckDiagnosis, false))
+	assert.Equal(t, "GPUFanSpeedUnhealthy", EventReason("gpu_fan_speed", false))
+}
+
+func TestNewEventEmitter(t *testing.T) {
+	_, err := NewEventEmitter(nil)
+	assert.EqualError(t, err, "config cannot be nil")
+	_, err = NewEventEmitter(&EventConfig{NodeName: "node-1"})
+	assert.EqualError(t, err, "recorder is required")
+	_, err = NewEventEmitter(&EventConfig{Recorder: record.NewFakeRecorder(1)})
+	assert.EqualError(t, err, "node name is required")
+}
+
+func TestEmit(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	emitter, err := NewEventEmitter(&EventConfig{Recorder: recorder, NodeName: "node-1", Burst: 3})
+	assert.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emitter.now = func() time.Time { return now }
+
+	degraded := &monitor.Event{
+		GPU:     "GPU-uuid-1",
+		Check:   diagnose.DiagnoseGPULinkStatus,
+		Healthy: false,
+		Message: "Link is not OK: link width is not ok, max: 16, current: 8",
+	}
+	recovered := &monitor.Event{GPU: "GPU-uuid-1", Check: diagnose.DiagnoseGPULinkStatus, Healthy: true}
+
+	emitter.Emit(degraded)
+	emitter.Emit(recovered)
+	assert.Equal(t, []string{
+		"Warning GPULinkDegraded GPU GPU-uuid-1: gpu_link_status is unhealthy: Link is not OK: link width is not ok, max: 16, current: 8",
+		"Normal GPULinkRecovered GPU GPU-uuid-1: gpu_link_status is healthy",
+	}, drainEvents(recorder))
+
+	// A flapping link is deduplicated within the window.
+	now = now.Add(time.Minute)
+	emitter.Emit(degraded)
+	assert.Empty(t, drainEvents(recorder))
+
+	now = now.Add(DefaultEventDedupWindow)
+	emitter.Emit(&monitor.Event{GPU: diagnose.GPUUUIDOverall, Check: diagnose.DiagnoseGPUDriverStatus, Healthy: false})
+	assert.Equal(t, []string{"Warning GPUDriverFailure Node: gpu_driver_status is unhealthy"}, drainEvents(recorder))
+
+	// The burst is used up.
+	emitter.Emit(degraded)
+	assert.Empty(t, drainEvents(recorder))
+}
@@ -0,0 +1,298 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+)
+
+const (
+	// ConditionGPUHealthy is True if the diagnosis succeeded and every check
+	// is healthy.
+	ConditionGPUHealthy corev1.NodeConditionType = "GPUHealthy"
+
+	// TaintKeyGPUUnhealthy is the NoSchedule taint applied to unhealthy nodes.
+	TaintKeyGPUUnhealthy = "accelerator.aibrix.ai/gpu-unhealthy"
+	// LabelHealthyGPUCount is the number of GPUs whose checks are all healthy.
+	LabelHealthyGPUCount = "accelerator.aibrix.ai/healthy-gpu-count"
+
+	// maxMessageLength keeps the conditions readable in kubectl describe.
+	maxMessageLength = 1024
+)
+
+type Config struct {
+	Client   kubernetes.Interface
+	NodeName string
+	// Taint applies TaintKeyGPUUnhealthy to the node when it is unhealthy and
+	// removes it once it is healthy again.
+	Taint bool
+}
+
+// Reporter reports diagnosis results on the Node object of the current node.
+type Reporter struct {
+	client   kubernetes.Interface
+	nodeName string
+	taint    bool
+	now      func() time.Time
+}
+
+func NewReporter(config *Config) (*Reporter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if config.Client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+	if config.NodeName == "" {
+		return nil, fmt.Errorf("node name is required")
+	}
+
+	return &Reporter{
+		client:   config.Client,
+		nodeName: config.NodeName,
+		taint:    config.Taint,
+		now:      time.Now,
+	}, nil
+}
+
+// Report updates the GPUHealthy condition, a condition per check, e.g.
+// GPULinkStatusUnhealthy, the healthy GPU count label and, if enabled, the
+// taint of the node from the results of Diagnoser.Check and its error.
+func (r *Reporter) Report(ctx context.Context, results map[diagnose.GPUUID][]*diagnose.DiagnoseResult, checkErr error) error {
+	healthy, healthyGPUs, problems := summarize(results)
+	if checkErr != nil {
+		healthy = false
+		healthyGPUs = 0
+	}
+
+	node, err := r.client.CoreV1().Nodes().Get(ctx, r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get node %s failed: %s", r.nodeName, err)
+	}
+
+	conditions := r.newConditions(node, results, healthy, problems, checkErr)
+	if err := r.patchConditions(ctx, conditions); err != nil {
+		return err
+	}
+
+	return r.updateLabelAndTaint(ctx, healthy, healthyGPUs)
+}
+
+// summarize returns whether every check is healthy, the number of GPUs whose
+// checks are all healthy, and the unhealthy checks.
+func summarize(results map[diagnose.GPUUID][]*diagnose.DiagnoseResult) (bool, int, []string) {
+	healthy := true
+	healthyGPUs := 0
+	var problems []string
+
+	for uuid, gpuResults := range results {
+		gpuHealthy := true
+		for _, result := range gpuResults {
+			if result == nil || result.IsHealthy == nil || *result.IsHealthy {
+				continue
+			}
+			gpuHealthy = false
+			problems = append(problems, fmt.Sprintf("%s %s: %s", uuid, result.Name, result.Message))
+		}
+		healthy = healthy && gpuHealthy
+		if uuid != diagnose.GPUUUIDOverall && gpuHealthy {
+			healthyGPUs++
+		}
+	}
+	if !healthy {
+		// No GPU is usable if a node level check, e.g. the driver, fails.
+		for _, result := range results[diagnose.GPUUUIDOverall] {
+			if result != nil && result.IsHealthy != nil && !*result.IsHealthy {
+				healthyGPUs = 0
+				break
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	return healthy, healthyGPUs, problems
+}
+
+func (r *Reporter) newConditions(node *corev1.Node, results map[diagnose.GPUUID][]*diagnose.DiagnoseResult,
+	healthy bool, problems []string, checkErr error) []corev1.NodeCondition {
+	now := metav1.NewTime(r.now())
+
+	overall := corev1.NodeCondition{
+		Type:    ConditionGPUHealthy,
+		Status:  corev1.ConditionTrue,
+		Reason:  "GPUsHealthy",
+		Message: "All GPU checks are healthy",
+	}
+	switch {
+	case checkErr != nil:
+		overall.Status = corev1.ConditionFalse
+		overall.Reason = "DiagnoseFailed"
+		overall.Message = checkErr.Error()
+	case !healthy:
+		overall.Status = corev1.ConditionFalse
+		overall.Reason = "GPUsUnhealthy"
+		overall.Message = strings.Join(problems, "; ")
+	}
+	conditions := []corev1.NodeCondition{overall}
+
+	// A condition per check, True if the check failed on any GPU, following
+	// the convention of node-problem-detector.
+	failed := map[diagnose.DiagnoseType][]string{}
+	seen := map[diagnose.DiagnoseType]bool{}
+	for uuid, gpuResults := range results {
+		for _, result := range gpuResults {
+			if result == nil || result.IsHealthy == nil {
+				continue
+			}
+			seen[result.Name] = true
+			if !*result.IsHealthy {
+				failed[result.Name] = append(failed[result.Name], fmt.Sprintf("%s: %s", uuid, result.Message))
+			}
+		}
+	}
+	for _, check := range diagnose.AllDiagnoseTypes {
+		if !seen[check] {
+			// Keep the previous state of checks which did not run.
+			continue
+		}
+		condition := corev1.NodeCondition{
+			Type:    ProblemConditionType(check),
+			Status:  corev1.ConditionFalse,
+			Reason:  "CheckPassed",
+			Message: fmt.Sprintf("%s is healthy", check),
+		}
+		if messages, ok := failed[check]; ok {
+			sort.Strings(messages)
+			condition.Status = corev1.ConditionTrue
+			condition.Reason = "CheckFailed"
+			condition.Message = strings.Join(messages, "; ")
+		}
+		conditions = append(conditions, condition)
+	}
+
+	for i := range conditions {
+		conditions[i].Message = truncate(conditions[i].Message, maxMessageLength)
+		conditions[i].LastHeartbeatTime = now
+		conditions[i].LastTransitionTime = now
+		for _, existing := range node.Status.Conditions {
+			if existing.Type == conditions[i].Type && existing.Status == conditions[i].Status {
+				conditions[i].LastTransitionTime = existing.LastTransitionTime
+			}
+		}
+	}
+
+	return conditions
+}
+
+// ProblemConditionType returns the condition type of a check, e.g.
+// GPULinkStatusUnhealthy for gpu_link_status.
+func ProblemConditionType(check diagnose.DiagnoseType) corev1.NodeConditionType {
+	acronyms := map[string]string{"gpu": "GPU", "vram": "VRAM", "pcie": "PCIe", "aer": "AER", "rdma": "RDMA"}
+
+	var name strings.Builder
+	for _, word := range strings.Split(string(check), "_") {
+		if acronym, ok := acronyms[word]; ok {
+			name.WriteString(acronym)
+		} else if word != "" {
+			name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	name.WriteString("Unhealthy")
+
+	return corev1.NodeConditionType(name.String())
+}
+
+// patchConditions patches the conditions of the node status. Conditions are
+// merged by type, so conditions owned by other components are untouched.
+func (r *Reporter) patchConditions(ctx context.Context, conditions []corev1.NodeCondition) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": conditions,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.client.CoreV1().Nodes().PatchStatus(ctx, r.nodeName, patch); err != nil {
+		return fmt.Errorf("patch conditions of node %s failed: %s", r.nodeName, err)
+	}
+
+	return nil
+}
+
+func (r *Reporter) updateLabelAndTaint(ctx context.Context, healthy bool, healthyGPUs int) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := r.client.CoreV1().Nodes().Get(ctx, r.nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		count := strconv.Itoa(healthyGPUs)
+		if node.Labels[LabelHealthyGPUCount] != count {
+			if node.Labels == nil {
+				node.Labels = map[string]string{}
+			}
+			node.Labels[LabelHealthyGPUCount] = count
+			changed = true
+		}
+		if r.taint {
+			var taintChanged bool
+			node.Spec.Taints, taintChanged = updateTaint(node.Spec.Taints, !healthy)
+			changed = changed || taintChanged
+		}
+		if !changed {
+			return nil
+		}
+
+		_, err = r.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("update node %s failed: %s", r.nodeName, err)
+	}
+
+	return nil
+}
+
+// updateTaint adds or removes the GPU unhealthy taint and returns whether the
+// taints changed.
+func updateTaint(taints []corev1.Taint, present bool) ([]corev1.Taint, bool) {
+	for i, taint := range taints {
+		if taint.Key != TaintKeyGPUUnhealthy || taint.Effect != corev1.TaintEffectNoSchedule {
+			continue
+		}
+		if present {
+			return taints, false
+		}
+		return append(taints[:i:i], taints[i+1:]...), true
+	}
+	if !present {
+		return taints, false
+	}
+
+	return append(taints, corev1.Taint{
+		Key:    TaintKeyGPUUnhealthy,
+		Value:  "true",
+		Effect: corev1.TaintEffectNoSchedule,
+	}), true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,142 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func testResults(linkHealthy bool) map[diagnose.GPUUID][]*diagnose.DiagnoseResult {
+	return map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+		diagnose.GPUUUIDOverall: {
+			{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+		},
+		"GPU-uuid-1": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(linkHealthy), Message: "link width is not ok"},
+		},
+		"GPU-uuid-2": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+		},
+	}
+}
+
+func getCondition(node *corev1.Node, conditionType corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == conditionType {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func hasTaint(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintKeyGPUUnhealthy && taint.Effect == corev1.TaintEffectNoSchedule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewReporter(t *testing.T) {
+	_, err := NewReporter(nil)
+	assert.EqualError(t, err, "config cannot be nil")
+	_, err = NewReporter(&Config{NodeName: "node-1"})
+	assert.EqualError(t, err, "client is required")
+	_, err = NewReporter(&Config{Client: fake.NewSimpleClientset()})
+	assert.EqualError(t, err, "node name is required")
+}
+
+func TestProblemConditionType(t *testing.T) {
+	assert.Equal(t, corev1.NodeConditionType("GPULinkStatusUnhealthy"), ProblemConditionType(diagnose.DiagnoseGPULinkStatus))
+	assert.Equal(t, corev1.NodeConditionType("GPUVRAMUnrecoverableErrorsUnhealthy"), ProblemConditionType(diagnose.DiagnoseGPUnrecoverableErrors))
+	assert.Equal(t, corev1.NodeConditionType("GPUPCIeAERErrorsUnhealthy"), ProblemConditionType(diagnose.DiagnoseGPUPCIeAERErrors))
+	assert.Equal(t, corev1.NodeConditionType("RDMADeviceStatusUnhealthy"), ProblemConditionType(diagnose.DiagnoseRDMADeviceStatus))
+}
+
+func TestReport(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{{Key: "other", Effect: corev1.TaintEffectNoExecute}},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	client := fake.NewSimpleClientset(node)
+	reporter, err := NewReporter(&Config{Client: client, NodeName: "node-1", Taint: true})
+	assert.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reporter.now = func() time.Time { return now }
+	get := func() *corev1.Node {
+		node, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return node
+	}
+
+	// An unhealthy link taints the node.
+	err = reporter.Report(context.Background(), testResults(false), nil)
+	assert.NoError(t, err)
+	got := get()
+	assert.Equal(t, corev1.ConditionFalse, getCondition(got, ConditionGPUHealthy).Status)
+	assert.Equal(t, "GPUsUnhealthy", getCondition(got, ConditionGPUHealthy).Reason)
+	assert.Equal(t, "GPU-uuid-1 gpu_link_status: link width is not ok", getCondition(got, ConditionGPUHealthy).Message)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(got, "GPULinkStatusUnhealthy").Status)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(got, "GPUDriverStatusUnhealthy").Status)
+	assert.Nil(t, getCondition(got, "RDMADeviceStatusUnhealthy"))
+	assert.Equal(t, corev1.ConditionTrue, getCondition(got, corev1.NodeReady).Status)
+	assert.Equal(t, "1", got.Labels[LabelHealthyGPUCount])
+	assert.True(t, hasTaint(got))
+	assert.Len(t, got.Spec.Taints, 2)
+
+	// Recovery removes the taint, transition times only change on transitions.
+	now = now.Add(time.Minute)
+	err = reporter.Report(context.Background(), testResults(true), nil)
+	assert.NoError(t, err)
+	got = get()
+	assert.Equal(t, corev1.ConditionTrue, getCondition(got, ConditionGPUHealthy).Status)
+	assert.Equal(t, now, getCondition(got, ConditionGPUHealthy).LastTransitionTime.Time.UTC())
+	assert.Equal(t, now.Add(-time.Minute), getCondition(got, "GPUDriverStatusUnhealthy").LastTransitionTime.Time.UTC())
+	assert.Equal(t, now, getCondition(got, "GPUDriverStatusUnhealthy").LastHeartbeatTime.Time.UTC())
+	assert.Equal(t, "2", got.Labels[LabelHealthyGPUCount])
+	assert.False(t, hasTaint(got))
+	assert.Len(t, got.Spec.Taints, 1)
+
+	// A failed diagnosis marks the node unhealthy, without touching the
+	// conditions of the checks.
+	err = reporter.Report(context.Background(), nil, fmt.Errorf("GPU card count mismatch: got 1, expected 2"))
+	assert.NoError(t, err)
+	got = get()
+	assert.Equal(t, "DiagnoseFailed", getCondition(got, ConditionGPUHealthy).Reason)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(got, "GPULinkStatusUnhealthy").Status)
+	assert.Equal(t, "0", got.Labels[LabelHealthyGPUCount])
+	assert.True(t, hasTaint(got))
+}
+
+func TestReportWithoutTaint(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	reporter, err := NewReporter(&Config{Client: client, NodeName: "node-1"})
+	assert.NoError(t, err)
+
+	err = reporter.Report(context.Background(), testResults(false), nil)
+	assert.NoError(t, err)
+	got, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.False(t, hasTaint(got))
+
+	reporter, err = NewReporter(&Config{Client: client, NodeName: "node-2"})
+	assert.NoError(t, err)
+	err = reporter.Report(context.Background(), testResults(true), nil)
+	assert.ErrorContains(t, err, "get node node-2 failed")
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+var (
+	checkHealthyDesc = prometheus.NewDesc(
+		"accelerator_check_healthy",
+		"Whether the check is healthy (1) or not (0), node level checks have gpu_uuid OVERALL.",
+		[]string{"gpu_uuid", "check", "vendor"}, nil)
+	eccErrorsDesc = prometheus.NewDesc(
+		"accelerator_gpu_ecc_errors",
+		"Volatile ECC error count of the GPU, reset on driver reload.",
+		[]string{"gpu_uuid", "vendor", "type"}, nil)
+	pcieLinkWidthDesc = prometheus.NewDesc(
+		"accelerator_gpu_pcie_link_width",
+		"PCIe link width of the GPU in lanes.",
+		[]string{"gpu_uuid", "vendor", "kind"}, nil)
+	pcieAERErrorsDesc = prometheus.NewDesc(
+		"accelerator_gpu_pcie_aer_errors",
+		"PCIe AER error count of the GPU since boot.",
+		[]string{"gpu_uuid", "vendor", "severity"}, nil)
+	diagnoseSuccessDesc = prometheus.NewDesc(
+		"accelerator_diagnose_success",
+		"Whether the latest diagnosis completed (1) or failed (0).",
+		nil, nil)
+	diagnoseDurationDesc = prometheus.NewDesc(
+		"accelerator_diagnose_duration_seconds",
+		"Duration of the latest diagnosis.",
+		nil, nil)
+	diagnoseLastRunDesc = prometheus.NewDesc(
+		"accelerator_diagnose_last_run_timestamp_seconds",
+		"Unix time of the start of the latest diagnosis.",
+		nil, nil)
+)
+
+// Collector exposes the results and device snapshot of the latest diagnosis
+// run as Prometheus metrics.
+type Collector struct {
+	latest func() *monitor.Run
+}
+
+// NewCollector returns a Collector of the run returned by latest, which may
+// return nil if no run has finished yet.
+func NewCollector(latest func() *monitor.Run) *Collector {
+	return &Collector{latest: latest}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- checkHealthyDesc
+	ch <- eccErrorsDesc
+	ch <- pcieLinkWidthDesc
+	ch <- pcieAERErrorsDesc
+	ch <- diagnoseSuccessDesc
+	ch <- diagnoseDurationDesc
+	ch <- diagnoseLastRunDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	run := c.latest()
+	if run == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(diagnoseSuccessDesc, prometheus.GaugeValue, boolToFloat(run.Err == nil))
+	ch <- prometheus.MustNewConstMetric(diagnoseDurationDesc, prometheus.GaugeValue, run.Duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(diagnoseLastRunDesc, prometheus.GaugeValue, float64(run.Time.UnixNano())/1e9)
+
+	vendor := ""
+	if run.Snapshot != nil {
+		vendor = string(run.Snapshot.Vendor)
+	}
+
+	for gpu, results := range run.Results {
+		for _, result := range results {
+			if result == nil || result.IsHealthy == nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(checkHealthyDesc, prometheus.GaugeValue,
+				boolToFloat(*result.IsHealthy), string(gpu), string(result.Name), vendor)
+		}
+	}
+
+	if run.Snapshot == nil {
+		return
+	}
+	for uuid, gpu := range run.Snapshot.GPUs {
+		collectUint(ch, eccErrorsDesc, gpu.ECCCorrected, string(uuid), vendor, "corrected")
+		collectUint(ch, eccErrorsDesc, gpu.ECCUncorrected, string(uuid), vendor, "uncorrected")
+		collectInt(ch, pcieLinkWidthDesc, gpu.LinkWidthCurrent, string(uuid), vendor, "current")
+		collectInt(ch, pcieLinkWidthDesc, gpu.LinkWidthMax, string(uuid), vendor, "max")
+		collectUint(ch, pcieAERErrorsDesc, gpu.PCIeAERCorrected, string(uuid), vendor, "correctable")
+		collectUint(ch, pcieAERErrorsDesc, gpu.PCIeAERNonFatal, string(uuid), vendor, "nonfatal")
+		collectUint(ch, pcieAERErrorsDesc, gpu.PCIeAERFatal, string(uuid), vendor, "fatal")
+	}
+}
+
+// NewHandler returns an HTTP handler serving the metrics of the collector
+// only, without the Go runtime metrics of the default registry.
+func NewHandler(collector prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// TextfileName is the name of the file written by WriteTextfile.
+const TextfileName = "ai-accelerator-tool.prom"
+
+// WriteTextfile writes the metrics of the run to TextfileName in dir for the
+// node_exporter textfile collector. The file is written to a temporary file
+// and renamed, so the collector never reads a partial file.
+func WriteTextfile(dir string, run *monitor.Run) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(NewCollector(func() *monitor.Run { return run })); err != nil {
+		return err
+	}
+
+	return prometheus.WriteToTextfile(filepath.Join(dir, TextfileName), registry)
+}
+
+func collectUint(ch chan<- prometheus.Metric, desc *prometheus.Desc, value *uint64, labels ...string) {
+	if value == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(*value), labels...)
+}
+
+func collectInt(ch chan<- prometheus.Metric, desc *prometheus.Desc, value *int, labels ...string) {
+	if value == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(*value), labels...)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
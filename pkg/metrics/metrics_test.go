@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+func intPtr(v int) *int { return &v }
+
+func TestCollector(t *testing.T) {
+	tests := []struct {
+		name string
+		run  *monitor.Run
+		want string
+	}{
+		{
+			name: "no run yet",
+			want: "",
+		},
+		{
+			name: "failed run",
+			run: &monitor.Run{
+				Time:     time.Unix(1700000000, 0),
+				Duration: 2 * time.Second,
+				Err:      fmt.Errorf("card count mismatch"),
+			},
+			want: `
+# HELP accelerator_diagnose_duration_seconds Duration of the latest diagnosis.
+# TYPE accelerator_diagnose_duration_seconds gauge
+accelerator_diagnose_duration_seconds 2
+# HELP accelerator_diagnose_last_run_timestamp_seconds Unix time of the start of the latest diagnosis.
+# TYPE accelerator_diagnose_last_run_timestamp_seconds gauge
+accelerator_diagnose_last_run_timestamp_seconds 1.7e+09
+# HELP accelerator_diagnose_success Whether the latest diagnosis completed (1) or failed (0).
+# TYPE accelerator_diagnose_success gauge
+accelerator_diagnose_success 0
+`,
+		},
+		{
+			name: "results and snapshot",
+			run: &monitor.Run{
+				Time:     time.Unix(1700000000, 0),
+				Duration: 500 * time.Millisecond,
+				Results: map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+					diagnose.GPUUUIDOverall: {
+						{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+					},
+					"GPU-uuid-1": {
+						{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(false)},
+					},
+				},
+				Snapshot: &diagnose.Snapshot{
+					Vendor: utils.NvidiaVendor,
+					GPUs: map[diagnose.GPUUID]*diagnose.GPUSnapshot{
+						"GPU-uuid-1": {
+							LinkWidthCurrent: intPtr(8),
+							LinkWidthMax:     intPtr(16),
+							ECCCorrected:     uint64Ptr(3),
+							PCIeAERFatal:     uint64Ptr(0),
+						},
+					},
+				},
+			},
+			want: `
+# HELP accelerator_check_healthy Whether the check is healthy (1) or not (0), node level checks have gpu_uuid OVERALL.
+# TYPE accelerator_check_healthy gauge
+accelerator_check_healthy{check="gpu_driver_status",gpu_uuid="OVERALL",vendor="nvidia"} 1
+accelerator_check_healthy{check="gpu_link_status",gpu_uuid="GPU-uuid-1",vendor="nvidia"} 0
+# HELP accelerator_diagnose_duration_seconds Duration of the latest diagnosis.
+# TYPE accelerator_diagnose_duration_seconds gauge
+accelerator_diagnose_duration_seconds 0.5
+# HELP accelerator_diagnose_last_run_timestamp_seconds Unix time of the start of the latest diagnosis.
+# TYPE accelerator_diagnose_last_run_timestamp_seconds gauge
+accelerator_diagnose_last_run_timestamp_seconds 1.7e+09
+# HELP accelerator_diagnose_success Whether the latest diagnosis completed (1) or failed (0).
+# TYPE accelerator_diagnose_success gauge
+accelerator_diagnose_success 1
+# HELP accelerator_gpu_ecc_errors Volatile ECC error count of the GPU, reset on driver reload.
+# TYPE accelerator_gpu_ecc_errors gauge
+accelerator_gpu_ecc_errors{gpu_uuid="GPU-uuid-1",type="corrected",vendor="nvidia"} 3
+# HELP accelerator_gpu_pcie_aer_errors PCIe AER error count of the GPU since boot.
+# TYPE accelerator_gpu_pcie_aer_errors gauge
+accelerator_gpu_pcie_aer_errors{gpu_uuid="GPU-uuid-1",severity="fatal",vendor="nvidia"} 0
+# HELP accelerator_gpu_pcie_link_width PCIe link width of the GPU in lanes.
+# TYPE accelerator_gpu_pcie_link_width gauge
+accelerator_gpu_pcie_link_width{gpu_uuid="GPU-uuid-1",kind="current",vendor="nvidia"} 8
+accelerator_gpu_pcie_link_width{gpu_uuid="GPU-uuid-1",kind="max",vendor="nvidia"} 16
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := NewCollector(func() *monitor.Run { return tt.run })
+			err := testutil.CollectAndCompare(collector, strings.NewReader(tt.want))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	run := &monitor.Run{
+		Time: time.Unix(1700000000, 0),
+		Results: map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			diagnose.GPUUUIDOverall: {
+				{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(false)},
+			},
+		},
+	}
+
+	err := WriteTextfile(dir, run)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, TextfileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `accelerator_check_healthy{check="gpu_driver_status",gpu_uuid="OVERALL",vendor=""} 0`)
+	assert.Contains(t, string(data), "accelerator_diagnose_success 1")
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	err = WriteTextfile(filepath.Join(dir, "missing"), run)
+	assert.Error(t, err)
+}
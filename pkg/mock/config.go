@@ -0,0 +1,836 @@
+package mock
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SupportedConfigVersion is the version of the mock config format described by
+// MockConfig, see hack/gpu_mock_conf.toml.
+const SupportedConfigVersion = "0.1.0"
+
+// MockConfig is the model of gpu_mock_conf.toml, which is read by the injection
+// library. Unset values are nil and not injected.
+type MockConfig struct {
+	Version    string            `toml:"version,omitempty"`
+	GPUs       *GPUsConfig       `toml:"gpus,omitempty"`
+	AscendNPUs *AscendNPUsConfig `toml:"ascend_npus,omitempty"`
+	// Timeline changes GPU configs while the mock environment runs, it is
+	// applied by the controller and not read by the injection library.
+	Timeline []*TimelineEvent `toml:"-"`
+}
+
+// GPUsConfig holds the node level configs of NVIDIA GPUs, and the card level
+// configs in tables keyed by the card index, e.g. [gpus.0].
+type GPUsConfig struct {
+	CardCount     *int `toml:"card_count,omitempty"`
+	NVMLInitError *int `toml:"nvml_init_error,omitempty"`
+
+	Cards map[int]*GPUConfig `toml:"-"`
+}
+
+// GPUConfig holds the configs of a single GPU.
+type GPUConfig struct {
+	DeviceName          *string `toml:"device_name,omitempty"`
+	Arch                *int    `toml:"arch,omitempty"`
+	PCI                 *string `toml:"pci,omitempty"`
+	UUID                *string `toml:"uuid,omitempty"`
+	LinkGen             *int    `toml:"link_gen,omitempty"`
+	LinkWidthCurrent    *int    `toml:"link_width_current,omitempty"`
+	LinkWidthMax        *int    `toml:"link_width_max,omitempty"`
+	NVLinkActive        []bool  `toml:"nvlink_active,omitempty"`
+	RemappingFailure    *bool   `toml:"remapping_failure,omitempty"`
+	RemappingPending    *bool   `toml:"remapping_pending,omitempty"`
+	SRAMUE              *int    `toml:"sram_ue,omitempty"`
+	DRAMUE              *int    `toml:"dram_ue,omitempty"`
+	DRAMCE              *int    `toml:"dram_ce,omitempty"`
+	RetiredPageSBE      *int    `toml:"retired_page_sbe,omitempty"`
+	RetiredPageDBE      *int    `toml:"retired_page_dbe,omitempty"`
+	RetiredPagePending  *bool   `toml:"retired_page_pending,omitempty"`
+	UncorrectableAggL1  *int    `toml:"uncorrectable_agg_l1,omitempty"`
+	UncorrectableAggL2  *int    `toml:"uncorrectable_agg_l2,omitempty"`
+	UncorrectableAggReg *int    `toml:"uncorrectable_agg_reg,omitempty"`
+	CrictlXID           []int   `toml:"crictl_xid,omitempty"`
+}
+
+// AscendNPUsConfig holds the node level configs of Ascend NPUs, and the device
+// level configs in tables keyed by the card and device index, e.g.
+// [ascend_npus.0.0].
+type AscendNPUsConfig struct {
+	CardCount     *int `toml:"card_count,omitempty"`
+	DCMIInitError *int `toml:"dcmi_init_error,omitempty"`
+
+	Cards map[int]map[int]*AscendNPUConfig `toml:"-"`
+}
+
+// AscendNPUConfig holds the configs of a single NPU device.
+type AscendNPUConfig struct {
+	FaultCodes []int `toml:"fault_codes,omitempty"`
+}
+
+// TimelineEvent changes configs at an offset from the start of the mock
+// environment, e.g.
+//
+//	[[timeline]]
+//	gpu = 0
+//	at = "30s"
+//	until = "5m"
+//	ramp = { dram_ce = [0, 100] }
+type TimelineEvent struct {
+	// GPU is the index of the card whose configs are changed, nil for the
+	// node level configs of [gpus].
+	GPU *int
+	At  time.Duration
+	// Until ends the event, nil if it lasts until the mock is stopped.
+	Until *time.Duration
+	// Every repeats the event with the given period, e.g. for a flapping link.
+	Every *time.Duration
+	// Set are the values of configs while the event lasts.
+	Set map[string]interface{}
+	// Ramp are integer configs increased linearly from the first to the
+	// second value until the event ends, holding the second value afterwards.
+	Ramp map[string][2]int
+}
+
+// timelineEventKeys are the keys of a [[timeline]] table.
+var timelineEventKeys = map[string]bool{
+	"gpu": true, "at": true, "until": true, "every": true, "set": true, "ramp": true,
+}
+
+// signedKeys may be negative, all other integers are counts or sizes.
+var signedKeys = map[string]bool{
+	"nvml_init_error": true,
+	"dcmi_init_error": true,
+}
+
+// ValidationError is a problem of a mock config at a line, 0 if unknown.
+type ValidationError struct {
+	Line    int
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Key, e.Message)
+}
+
+// ValidationErrors are all problems of a mock config, ordered by line.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LoadConfig reads and validates the mock config at the given path.
+func LoadConfig(path string) (*MockConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	return ParseConfig(data)
+}
+
+// ParseConfig validates the mock config and returns its model. Unknown keys,
+// wrong types and out of range values are returned as ValidationErrors, which
+// the injection library would silently ignore.
+func ParseConfig(data []byte) (*MockConfig, error) {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return nil, err
+	}
+
+	v := &validator{lines: keyLines(data)}
+	v.validate(raw)
+	if len(v.errs) > 0 {
+		sort.SliceStable(v.errs, func(i, j int) bool {
+			return v.errs[i].Line < v.errs[j].Line
+		})
+		return nil, v.errs
+	}
+
+	return decodeConfig(data)
+}
+
+type validator struct {
+	lines map[string]int
+	errs  ValidationErrors
+}
+
+func (v *validator) addError(path []string, format string, args ...interface{}) {
+	key := strings.Join(path, ".")
+	// Keys of inline tables have the line of the table.
+	line := 0
+	for i := len(path); i > 0 && line == 0; i-- {
+		line = v.lines[strings.Join(path[:i], ".")]
+	}
+	v.errs = append(v.errs, &ValidationError{
+		Line:    line,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(raw map[string]interface{}) {
+	for _, key := range sortedMapKeys(raw) {
+		path := []string{key}
+		switch key {
+		case "version":
+			version, ok := raw[key].(string)
+			if !ok {
+				v.addError(path, "expected string, got %s", typeName(raw[key]))
+			} else if version != SupportedConfigVersion {
+				v.addError(path, "unsupported version %q, expected %q", version, SupportedConfigVersion)
+			}
+		case "gpus":
+			v.validateIndexed(path, raw[key], reflect.TypeOf(GPUsConfig{}), func(cardPath []string, card interface{}) {
+				v.validateTable(cardPath, card, reflect.TypeOf(GPUConfig{}))
+			})
+		case "ascend_npus":
+			v.validateIndexed(path, raw[key], reflect.TypeOf(AscendNPUsConfig{}), func(cardPath []string, card interface{}) {
+				v.validateIndexed(cardPath, card, nil, func(devicePath []string, device interface{}) {
+					v.validateTable(devicePath, device, reflect.TypeOf(AscendNPUConfig{}))
+				})
+			})
+		case "timeline":
+			v.validateTimeline(path, raw[key], cardCount(raw))
+		default:
+			v.addError(path, "unknown key")
+		}
+	}
+}
+
+// validateIndexed validates a table of the node level keys of the given type,
+// and sub tables keyed by an index below card_count.
+func (v *validator) validateIndexed(path []string, value interface{}, typ reflect.Type,
+	validateItem func([]string, interface{})) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		v.addError(path, "expected table, got %s", typeName(value))
+		return
+	}
+
+	count := -1
+	if c, ok := table["card_count"].(int64); ok && typ != nil {
+		count = int(c)
+	}
+
+	for _, key := range sortedMapKeys(table) {
+		keyPath := append(append([]string{}, path...), key)
+		if index, err := strconv.Atoi(key); err == nil {
+			if index < 0 {
+				v.addError(keyPath, "index must not be negative")
+			} else if count >= 0 && index >= count {
+				v.addError(keyPath, "index %d out of range, card_count is %d", index, count)
+			}
+			validateItem(keyPath, table[key])
+			continue
+		}
+
+		if typ == nil {
+			v.addError(keyPath, "unknown key, expected an index")
+			continue
+		}
+		field, ok := fieldByKey(typ, key)
+		if !ok {
+			v.addError(keyPath, "unknown key")
+			continue
+		}
+		v.validateValue(keyPath, field.Type, table[key])
+	}
+}
+
+// validateTable validates a table of the keys of the given type.
+func (v *validator) validateTable(path []string, value interface{}, typ reflect.Type) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		v.addError(path, "expected table, got %s", typeName(value))
+		return
+	}
+
+	for _, key := range sortedMapKeys(table) {
+		keyPath := append(append([]string{}, path...), key)
+		field, ok := fieldByKey(typ, key)
+		if !ok {
+			v.addError(keyPath, "unknown key")
+			continue
+		}
+		v.validateValue(keyPath, field.Type, table[key])
+	}
+}
+
+// validateValue validates the value against the type of its model field.
+func (v *validator) validateValue(path []string, typ reflect.Type, value interface{}) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() == reflect.Slice {
+		values, ok := value.([]interface{})
+		if !ok {
+			v.addError(path, "expected array of %s, got %s", kindName(typ.Elem().Kind()), typeName(value))
+			return
+		}
+		for i, elem := range values {
+			if kindName(typ.Elem().Kind()) != typeName(elem) {
+				v.addError(path, "expected array of %s, got %s at %d", kindName(typ.Elem().Kind()), typeName(elem), i)
+				return
+			}
+		}
+		return
+	}
+
+	if kindName(typ.Kind()) != typeName(value) {
+		v.addError(path, "expected %s, got %s", kindName(typ.Kind()), typeName(value))
+		return
+	}
+	key := path[len(path)-1]
+	if i, ok := value.(int64); ok && i < 0 && !signedKeys[key] {
+		v.addError(path, "must not be negative, got %d", i)
+	}
+}
+
+// cardCount returns the card_count of [gpus], -1 if it is not set.
+func cardCount(raw map[string]interface{}) int {
+	gpus, _ := raw["gpus"].(map[string]interface{})
+	if count, ok := gpus["card_count"].(int64); ok {
+		return int(count)
+	}
+	return -1
+}
+
+// validateTimeline validates the [[timeline]] tables, gpu indices must be
+// below card_count unless it is negative.
+func (v *validator) validateTimeline(path []string, value interface{}, count int) {
+	events, ok := value.([]map[string]interface{})
+	if !ok {
+		v.addError(path, "expected array of tables, got %s", typeName(value))
+		return
+	}
+
+	for i, event := range events {
+		eventPath := append(append([]string{}, path...), strconv.Itoa(i))
+		for _, key := range sortedMapKeys(event) {
+			if !timelineEventKeys[key] {
+				v.addError(append(eventPath, key), "unknown key")
+			}
+		}
+
+		typ := reflect.TypeOf(GPUsConfig{})
+		if gpu, ok := event["gpu"]; ok {
+			typ = reflect.TypeOf(GPUConfig{})
+			index, ok := gpu.(int64)
+			switch {
+			case !ok:
+				v.addError(append(eventPath, "gpu"), "expected integer, got %s", typeName(gpu))
+			case index < 0:
+				v.addError(append(eventPath, "gpu"), "index must not be negative")
+			case count >= 0 && int(index) >= count:
+				v.addError(append(eventPath, "gpu"), "index %d out of range, card_count is %d", index, count)
+			}
+		}
+
+		if _, ok := event["at"]; !ok {
+			v.addError(eventPath, "at is required")
+		}
+		at, hasAt := v.validateDuration(eventPath, event, "at")
+		until, hasUntil := v.validateDuration(eventPath, event, "until")
+		if hasAt && hasUntil && until <= at {
+			v.addError(append(eventPath, "until"), "must be after at")
+		}
+		if every, ok := v.validateDuration(eventPath, event, "every"); ok {
+			if !hasUntil {
+				v.addError(append(eventPath, "every"), "requires until")
+			} else if hasAt && every <= until-at {
+				v.addError(append(eventPath, "every"), "must be longer than until - at, got %s", every)
+			}
+		}
+
+		set, hasSet := event["set"]
+		if hasSet {
+			v.validateTable(append(eventPath, "set"), set, typ)
+		}
+		ramp, hasRamp := event["ramp"]
+		if hasRamp {
+			if !hasUntil {
+				v.addError(append(eventPath, "ramp"), "requires until")
+			}
+			v.validateRamp(append(eventPath, "ramp"), ramp, typ)
+		}
+		if !hasSet && !hasRamp {
+			v.addError(eventPath, "set or ramp is required")
+		}
+	}
+}
+
+// validateDuration validates the duration of the key in the table, and returns
+// it if it is valid.
+func (v *validator) validateDuration(path []string, table map[string]interface{}, key string) (time.Duration, bool) {
+	value, ok := table[key]
+	if !ok {
+		return 0, false
+	}
+	keyPath := append(append([]string{}, path...), key)
+	s, ok := value.(string)
+	if !ok {
+		v.addError(keyPath, "expected duration string, got %s", typeName(value))
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		v.addError(keyPath, "invalid duration %q", s)
+		return 0, false
+	}
+	if d < 0 {
+		v.addError(keyPath, "must not be negative, got %s", s)
+		return 0, false
+	}
+	return d, true
+}
+
+// validateRamp validates a table of integer keys of the given type to arrays
+// of their start and end value.
+func (v *validator) validateRamp(path []string, value interface{}, typ reflect.Type) {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		v.addError(path, "expected table, got %s", typeName(value))
+		return
+	}
+
+	for _, key := range sortedMapKeys(table) {
+		keyPath := append(append([]string{}, path...), key)
+		field, ok := fieldByKey(typ, key)
+		if !ok {
+			v.addError(keyPath, "unknown key")
+			continue
+		}
+		if field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Int {
+			v.addError(keyPath, "only integers can be ramped")
+			continue
+		}
+		values, ok := table[key].([]interface{})
+		if !ok || len(values) != 2 || typeName(values[0]) != "integer" || typeName(values[1]) != "integer" {
+			v.addError(keyPath, "expected array of 2 integers [from, to]")
+			continue
+		}
+		for _, value := range values {
+			if i := value.(int64); i < 0 && !signedKeys[key] {
+				v.addError(keyPath, "must not be negative, got %d", i)
+			}
+		}
+	}
+}
+
+// fieldByKey returns the field of the struct type with the given toml key.
+func fieldByKey(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name != "-" && name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func kindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Int:
+		return "integer"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return kind.String()
+}
+
+// typeName returns the TOML type name of a decoded value.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case []interface{}, []map[string]interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "table"
+	}
+	return "datetime"
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EncodeConfig returns the mock config as TOML, with the tables of cards and
+// devices ordered by index.
+func EncodeConfig(config *MockConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	encode := func(header string, value interface{}) error {
+		if header != "" {
+			fmt.Fprintf(&buf, "\n[%s]\n", header)
+		}
+		return toml.NewEncoder(&buf).Encode(value)
+	}
+
+	if err := encode("", struct {
+		Version string `toml:"version,omitempty"`
+	}{config.Version}); err != nil {
+		return nil, err
+	}
+
+	if gpus := config.GPUs; gpus != nil {
+		if err := encode("gpus", gpus); err != nil {
+			return nil, err
+		}
+		for _, index := range sortedIndices(gpus.Cards) {
+			if err := encode(fmt.Sprintf("gpus.%d", index), gpus.Cards[index]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if npus := config.AscendNPUs; npus != nil {
+		if err := encode("ascend_npus", npus); err != nil {
+			return nil, err
+		}
+		for _, cardIndex := range sortedIndices(npus.Cards) {
+			devices := npus.Cards[cardIndex]
+			for _, deviceIndex := range sortedIndices(devices) {
+				header := fmt.Sprintf("ascend_npus.%d.%d", cardIndex, deviceIndex)
+				if err := encode(header, devices[deviceIndex]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, event := range config.Timeline {
+		buf.WriteString("\n[[timeline]]\n")
+		if err := toml.NewEncoder(&buf).Encode(encodeTimelineEvent(event)); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// timelineTable is the [[timeline]] table of an event.
+type timelineTable struct {
+	GPU   *int        `toml:"gpu,omitempty"`
+	At    string      `toml:"at"`
+	Until string      `toml:"until,omitempty"`
+	Every string      `toml:"every,omitempty"`
+	Set   inlineTable `toml:"set,omitempty"`
+	Ramp  inlineTable `toml:"ramp,omitempty"`
+}
+
+func encodeTimelineEvent(event *TimelineEvent) *timelineTable {
+	table := &timelineTable{
+		GPU: event.GPU,
+		At:  event.At.String(),
+		Set: event.Set,
+	}
+	if event.Until != nil {
+		table.Until = event.Until.String()
+	}
+	if event.Every != nil {
+		table.Every = event.Every.String()
+	}
+	if len(event.Ramp) > 0 {
+		table.Ramp = inlineTable{}
+		for key, values := range event.Ramp {
+			table.Ramp[key] = []int{values[0], values[1]}
+		}
+	}
+	return table
+}
+
+// inlineTable is a table encoded as an inline table, e.g. { dram_ce = 1 }.
+type inlineTable map[string]interface{}
+
+func (t inlineTable) MarshalTOML() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, key := range sortedMapKeys(t) {
+		var value bytes.Buffer
+		if err := toml.NewEncoder(&value).Encode(map[string]interface{}{key: t[key]}); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(" " + strings.TrimSpace(value.String()))
+	}
+	buf.WriteString(" }")
+	return buf.Bytes(), nil
+}
+
+func sortedIndices[T any](m map[int]T) []int {
+	indices := make([]int, 0, len(m))
+	for index := range m {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// decodeConfig decodes a validated config into its model.
+func decodeConfig(data []byte) (*MockConfig, error) {
+	var doc struct {
+		Version    string                    `toml:"version"`
+		GPUs       map[string]toml.Primitive `toml:"gpus"`
+		AscendNPUs map[string]toml.Primitive `toml:"ascend_npus"`
+		Timeline   []map[string]interface{}  `toml:"timeline"`
+	}
+	md, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &MockConfig{Version: doc.Version}
+	if doc.GPUs != nil {
+		config.GPUs = &GPUsConfig{}
+		err := decodeIndexed(md, doc.GPUs, config.GPUs, func(index int, prim toml.Primitive) error {
+			card := &GPUConfig{}
+			if err := md.PrimitiveDecode(prim, card); err != nil {
+				return err
+			}
+			if config.GPUs.Cards == nil {
+				config.GPUs.Cards = map[int]*GPUConfig{}
+			}
+			config.GPUs.Cards[index] = card
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if doc.AscendNPUs != nil {
+		config.AscendNPUs = &AscendNPUsConfig{}
+		err := decodeIndexed(md, doc.AscendNPUs, config.AscendNPUs, func(cardIndex int, prim toml.Primitive) error {
+			var devices map[string]toml.Primitive
+			if err := md.PrimitiveDecode(prim, &devices); err != nil {
+				return err
+			}
+			if config.AscendNPUs.Cards == nil {
+				config.AscendNPUs.Cards = map[int]map[int]*AscendNPUConfig{}
+			}
+			config.AscendNPUs.Cards[cardIndex] = map[int]*AscendNPUConfig{}
+			for key, devicePrim := range devices {
+				deviceIndex, _ := strconv.Atoi(key)
+				device := &AscendNPUConfig{}
+				if err := md.PrimitiveDecode(devicePrim, device); err != nil {
+					return err
+				}
+				config.AscendNPUs.Cards[cardIndex][deviceIndex] = device
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, raw := range doc.Timeline {
+		config.Timeline = append(config.Timeline, decodeTimelineEvent(raw))
+	}
+
+	return config, nil
+}
+
+// decodeTimelineEvent decodes a validated [[timeline]] table.
+func decodeTimelineEvent(raw map[string]interface{}) *TimelineEvent {
+	event := &TimelineEvent{}
+	if gpu, ok := raw["gpu"].(int64); ok {
+		index := int(gpu)
+		event.GPU = &index
+	}
+	duration := func(key string) *time.Duration {
+		s, ok := raw[key].(string)
+		if !ok {
+			return nil
+		}
+		d, _ := time.ParseDuration(s)
+		return &d
+	}
+	if at := duration("at"); at != nil {
+		event.At = *at
+	}
+	event.Until = duration("until")
+	event.Every = duration("every")
+
+	if set, ok := raw["set"].(map[string]interface{}); ok {
+		event.Set = set
+	}
+	if ramp, ok := raw["ramp"].(map[string]interface{}); ok {
+		event.Ramp = map[string][2]int{}
+		for key, value := range ramp {
+			values := value.([]interface{})
+			event.Ramp[key] = [2]int{int(values[0].(int64)), int(values[1].(int64))}
+		}
+	}
+
+	return event
+}
+
+// decodeIndexed decodes the node level keys of the table into the fields of
+// out, and passes the tables keyed by an index to decodeItem.
+func decodeIndexed(md toml.MetaData, table map[string]toml.Primitive, out interface{},
+	decodeItem func(int, toml.Primitive) error) error {
+	value := reflect.ValueOf(out).Elem()
+	for key, prim := range table {
+		if index, err := strconv.Atoi(key); err == nil {
+			if err := decodeItem(index, prim); err != nil {
+				return err
+			}
+			continue
+		}
+
+		field, _ := fieldByKey(value.Type(), key)
+		if err := md.PrimitiveDecode(prim, value.FieldByIndex(field.Index).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyLines returns the line of every table header and key in the TOML data,
+// keyed by its dotted path, e.g. gpus.0.dram_ue.
+func keyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	var table []string
+	// Tables of an array are keyed by their index, e.g. timeline.0.at.
+	arrayCounts := map[string]int{}
+	// Lines of multi-line arrays and strings are skipped.
+	depth := 0
+	inString := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if inString {
+			if strings.Count(line, `"""`)%2 == 1 {
+				inString = false
+			}
+			continue
+		}
+		if depth > 0 {
+			depth += bracketDepth(line)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") {
+			header := strings.Trim(stripComment(line), "[] ")
+			table = append(splitKey(header), strconv.Itoa(arrayCounts[header]))
+			arrayCounts[header]++
+			lines[strings.Join(table, ".")] = n
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			header := strings.Trim(stripComment(line), "[] ")
+			table = splitKey(header)
+			// Parent tables are defined implicitly by their first sub table.
+			for i := 1; i <= len(table); i++ {
+				if _, ok := lines[strings.Join(table[:i], ".")]; !ok || i == len(table) {
+					lines[strings.Join(table[:i], ".")] = n
+				}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		path := append(append([]string{}, table...), splitKey(key)...)
+		lines[strings.Join(path, ".")] = n
+
+		value = stripComment(value)
+		depth = bracketDepth(value)
+		if strings.Count(value, `"""`)%2 == 1 {
+			inString = true
+		}
+	}
+
+	return lines
+}
+
+// splitKey splits a dotted key into its parts, removing quotes.
+func splitKey(key string) []string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return parts
+}
+
+// stripComment removes a trailing comment, which is not within a string.
+func stripComment(line string) string {
+	quote := rune(0)
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// bracketDepth returns the number of unclosed array brackets of a value.
+func bracketDepth(value string) int {
+	depth := 0
+	quote := rune(0)
+	for _, r := range stripComment(value) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
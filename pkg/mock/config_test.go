@@ -0,0 +1,261 @@
+package mock
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigExample(t *testing.T) {
+	config, err := LoadConfig("../../hack/gpu_mock_conf.toml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, SupportedConfigVersion, config.Version)
+	assert.Equal(t, 4, *config.GPUs.CardCount)
+	assert.Equal(t, 9, *config.GPUs.NVMLInitError)
+	assert.Len(t, config.GPUs.Cards, 2)
+	assert.True(t, *config.GPUs.Cards[0].RemappingPending)
+	assert.Equal(t, 7, *config.GPUs.Cards[0].DRAMUE)
+	assert.Nil(t, config.GPUs.Cards[0].DeviceName)
+	assert.Equal(t, "A800", *config.GPUs.Cards[1].DeviceName)
+	assert.Len(t, config.GPUs.Cards[1].NVLinkActive, 6)
+	assert.Nil(t, config.AscendNPUs)
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *MockConfig
+		wantErr string
+	}{
+		{
+			name: "gpus and npus",
+			data: `version = "0.1.0"
+[gpus]
+card_count = 2
+nvml_init_error = -1
+[gpus.1]
+link_width_current = 8
+crictl_xid = [79]
+[ascend_npus]
+card_count = 1
+[ascend_npus.0.0]
+fault_codes = [
+  1,
+  2,
+]
+`,
+			want: &MockConfig{
+				Version: "0.1.0",
+				GPUs: &GPUsConfig{
+					CardCount:     intPtr(2),
+					NVMLInitError: intPtr(-1),
+					Cards: map[int]*GPUConfig{
+						1: {LinkWidthCurrent: intPtr(8), CrictlXID: []int{79}},
+					},
+				},
+				AscendNPUs: &AscendNPUsConfig{
+					CardCount: intPtr(1),
+					Cards: map[int]map[int]*AscendNPUConfig{
+						0: {0: {FaultCodes: []int{1, 2}}},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown keys",
+			data: `version = "0.1.0"
+[gpus]
+card_count = 1
+[gpus.0]
+dram_eu = 7 # typo
+[gpu.0]
+dram_ue = 7
+`,
+			wantErr: "line 5: gpus.0.dram_eu: unknown key; line 6: gpu: unknown key",
+		},
+		{
+			name: "wrong types",
+			data: `[gpus]
+card_count = "4"
+[gpus.0]
+dram_ue = 1.5
+nvlink_active = [true, 1]
+remapping_pending = [true]
+`,
+			wantErr: "line 2: gpus.card_count: expected integer, got string; " +
+				"line 4: gpus.0.dram_ue: expected integer, got float; " +
+				"line 5: gpus.0.nvlink_active: expected array of boolean, got integer at 1; " +
+				"line 6: gpus.0.remapping_pending: expected boolean, got array",
+		},
+		{
+			name: "out of range",
+			data: `[gpus]
+card_count = 2
+[gpus.0]
+sram_ue = -1
+[gpus.2]
+dram_ue = 1
+`,
+			wantErr: "line 4: gpus.0.sram_ue: must not be negative, got -1; " +
+				"line 5: gpus.2: index 2 out of range, card_count is 2",
+		},
+		{
+			name: "unsupported version",
+			data: `version = "1.0.0"
+`,
+			wantErr: `line 1: version: unsupported version "1.0.0", expected "0.1.0"`,
+		},
+		{
+			name: "npu device keys",
+			data: `[ascend_npus.0]
+fault_codes = [1]
+[ascend_npus.0.0]
+fault_code = [1]
+`,
+			wantErr: "line 2: ascend_npus.0.fault_codes: unknown key, expected an index; " +
+				"line 4: ascend_npus.0.0.fault_code: unknown key",
+		},
+		{
+			name: "timeline",
+			data: `[gpus]
+card_count = 1
+[[timeline]]
+at = "1m"
+set = { nvml_init_error = 9 }
+[[timeline]]
+gpu = 0
+at = "10s"
+until = "20s"
+every = "1m"
+ramp = { dram_ce = [0, 100] }
+`,
+			want: &MockConfig{
+				GPUs: &GPUsConfig{CardCount: intPtr(1)},
+				Timeline: []*TimelineEvent{
+					{At: time.Minute, Set: map[string]interface{}{"nvml_init_error": int64(9)}},
+					{
+						GPU:   intPtr(0),
+						At:    10 * time.Second,
+						Until: durationPtr(20 * time.Second),
+						Every: durationPtr(time.Minute),
+						Ramp:  map[string][2]int{"dram_ce": {0, 100}},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid timeline",
+			data: `[gpus]
+card_count = 1
+[[timeline]]
+gpu = 1
+until = "1h"
+set = { dram_eu = 1 }
+[[timeline]]
+at = "10s"
+until = "5s"
+every = "1s"
+ramp = { card_count = [1], nvml_init_error = [0, 9] }
+[[timeline]]
+at = "1 minute"
+gpus = 0
+[[timeline]]
+gpu = 0
+at = "0s"
+ramp = { device_name = ["a", "b"] }
+`,
+			wantErr: "line 3: timeline.0: at is required; " +
+				"line 4: timeline.0.gpu: index 1 out of range, card_count is 1; " +
+				"line 6: timeline.0.set.dram_eu: unknown key; " +
+				"line 9: timeline.1.until: must be after at; " +
+				"line 11: timeline.1.ramp.card_count: expected array of 2 integers [from, to]; " +
+				"line 12: timeline.2: set or ramp is required; " +
+				"line 13: timeline.2.at: invalid duration \"1 minute\"; " +
+				"line 14: timeline.2.gpus: unknown key; " +
+				"line 18: timeline.3.ramp: requires until; " +
+				"line 18: timeline.3.ramp.device_name: only integers can be ramped",
+		},
+		{
+			name:    "syntax error",
+			data:    "[gpus\n",
+			wantErr: "toml: line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, config)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, config)
+		})
+	}
+}
+
+func TestEncodeConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "example",
+			data: "",
+		},
+		{
+			name: "cards ordered by index",
+			data: `version = "0.1.0"
+[gpus]
+card_count = 11
+[gpus.10]
+uuid = "GPU-10"
+[gpus.2]
+nvlink_active = [true, false]
+[ascend_npus.1.0]
+fault_codes = [1, 2]
+`,
+		},
+		{
+			name: "timeline",
+			data: testTimelineConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.data == "" {
+				var err error
+				data, err = os.ReadFile("../../hack/gpu_mock_conf.toml")
+				assert.NoError(t, err)
+			}
+			config, err := ParseConfig(data)
+			assert.NoError(t, err)
+
+			encoded, err := EncodeConfig(config)
+			assert.NoError(t, err)
+			got, err := ParseConfig(encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, config, got)
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -6,14 +6,40 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
 
 	"github.com/aibrix/ai-accelerator-tool/pkg/mock/resources"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	// EnvLDPreload is the environment variable of the dynamic linker listing
+	// libraries loaded before all others.
+	EnvLDPreload = "LD_PRELOAD"
+	// EnvConfPath is the environment variable the injection library reads its
+	// configuration path from.
+	EnvConfPath = "GPU_MOCK_CONF_PATH"
+
+	libName  = "nvml_injectiond.so"
+	confName = "gpu_mock_conf.toml"
 )
 
+// Config of the mock environment. GPUMockDir and LDPreloadFile are host paths,
+// which are resolved under the host root when it is set.
 type Config struct {
 	ConfigPath    string
 	GPUMockDir    string
 	LDPreloadFile string
+	// Global injects the library into every process on the host through
+	// LDPreloadFile, which requires root. Otherwise the library is only
+	// injected into processes started with Env, and GPUMockDir defaults to a
+	// temporary directory.
+	Global bool
+	// JournalFile is the host path of the recovery journal in global mode,
+	// DefaultJournalFile if empty.
+	JournalFile string
 }
 
 type Controller struct {
@@ -22,14 +48,27 @@ type Controller struct {
 	active bool
 	// Track the temporary lib path if we extract the embedded one
 	tempLibPath string
+	// Track the path of the copied config file
+	confPath string
 	// Track original preload content to restore it
 	originalPreloadContent string
+	originalPreloadExists  bool
+	// stopTimeline stops applying the timeline of the config, which is done
+	// once timelineDone is closed.
+	stopTimeline chan struct{}
+	timelineDone chan struct{}
 }
 
 func NewController(config *Config) (*Controller, error) {
 	if config.ConfigPath == "" {
 		return nil, fmt.Errorf("config path is required")
 	}
+	if config.Global && config.GPUMockDir == "" {
+		return nil, fmt.Errorf("gpu mock dir is required in global mode")
+	}
+	if config.Global && config.LDPreloadFile == "" {
+		return nil, fmt.Errorf("ld preload file is required in global mode")
+	}
 
 	return &Controller{
 		config: config,
@@ -37,7 +76,7 @@ func NewController(config *Config) (*Controller, error) {
 	}, nil
 }
 
-func (c *Controller) Start() error {
+func (c *Controller) Start() (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -50,21 +89,47 @@ func (c *Controller) Start() error {
 		return fmt.Errorf("config file not found: %v", err)
 	}
 
-	// Create parent directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(c.config.GPUMockDir), 0755); err != nil {
-		return fmt.Errorf("failed to create parent directory: %v", err)
+	configData, err := os.ReadFile(c.config.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	// The injection library silently ignores what it does not understand, so
+	// the config is validated here to fail on a typo rather than mock nothing.
+	timeline, err := NewTimeline(configData)
+	if err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	// The injection library only reads the config at the start of a
+	// process, the timeline is rendered into the config on schedule instead.
+	if !timeline.Static() {
+		configData, err = timeline.Render(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Repair the injection of a mock environment that was not stopped, which
+	// would otherwise keep faking GPU state for every process.
+	if c.config.Global {
+		cleaned, err := Cleanup(c.journalFile(), c.config.LDPreloadFile, false)
+		if err != nil {
+			return fmt.Errorf("failed to clean up stale mock: %v", err)
+		}
+		if cleaned {
+			klog.InfoS("Cleaned up stale mock injection", "preloadFile", c.config.LDPreloadFile)
+		}
 	}
 
 	// Extract embedded library
-	err := os.Mkdir(c.config.GPUMockDir, 0755)
+	mockDir, err := c.createMockDir()
 	if err != nil {
-		return fmt.Errorf("failed to create mock dir: %v", err)
+		return err
 	}
 
 	// Add cleanup in case of error
 	defer func() {
 		if err != nil {
-			os.RemoveAll(c.config.GPUMockDir)
+			os.RemoveAll(utils.HostPath(mockDir))
 		}
 	}()
 
@@ -73,28 +138,142 @@ func (c *Controller) Start() error {
 		return fmt.Errorf("failed to get embedded library: %v", err)
 	}
 
-	libPath := filepath.Join(c.config.GPUMockDir, "nvml_injectiond.so")
-	if err := os.WriteFile(libPath, libData, 0755); err != nil {
+	// The library is loaded by host processes, so it is referred to by its
+	// host path.
+	libPath := filepath.Join(mockDir, libName)
+	if err := os.WriteFile(utils.HostPath(libPath), libData, 0755); err != nil {
 		return fmt.Errorf("failed to write library: %v", err)
 	}
 
-	c.tempLibPath = libPath
-
 	// Verify injection library exists
-	if _, err := os.Stat(libPath); err != nil {
+	if _, err := utils.Stat(libPath); err != nil {
 		return fmt.Errorf("injection library not found: %v", err)
 	}
 
+	// Copy config file
+	confPath := filepath.Join(mockDir, confName)
+	if err := os.WriteFile(utils.HostPath(confPath), configData, 0644); err != nil {
+		return fmt.Errorf("failed to copy config file: %v", err)
+	}
+
+	if c.config.Global {
+		if err := c.addPreload(mockDir, libPath); err != nil {
+			return err
+		}
+	}
+
+	if !timeline.Static() {
+		c.stopTimeline = make(chan struct{})
+		c.timelineDone = make(chan struct{})
+		go c.runTimeline(timeline, confPath, time.Now(), c.stopTimeline, c.timelineDone)
+	}
+
+	c.tempLibPath = libPath
+	c.confPath = confPath
+	c.active = true
+	return nil
+}
+
+// runTimeline renders the config at every change of the timeline, until stop
+// is closed.
+func (c *Controller) runTimeline(timeline *Timeline, confPath string, start time.Time, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	var elapsed time.Duration
+	for {
+		next, ok := timeline.Next(elapsed)
+		if !ok {
+			klog.InfoS("Mock timeline completed", "elapsed", elapsed)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(start.Add(next)))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		elapsed = next
+
+		data, err := timeline.Render(elapsed)
+		if err != nil {
+			klog.ErrorS(err, "Failed to render mock timeline", "elapsed", elapsed)
+			continue
+		}
+		// Processes starting meanwhile must not read a partial config.
+		if err := writeFileSync(utils.HostPath(confPath), data, 0644); err != nil {
+			klog.ErrorS(err, "Failed to write mock config", "elapsed", elapsed)
+			continue
+		}
+		klog.V(2).InfoS("Applied mock timeline", "elapsed", elapsed)
+	}
+}
+
+// createMockDir creates the directory the library and config are written to,
+// and returns its host path.
+func (c *Controller) createMockDir() (string, error) {
+	if c.config.GPUMockDir == "" {
+		dir, err := os.MkdirTemp(utils.HostPath(os.TempDir()), "gpu_mock")
+		if err != nil {
+			return "", fmt.Errorf("failed to create mock dir: %v", err)
+		}
+		return utils.TrimHostPath(dir), nil
+	}
+
+	gpuMockDir := utils.HostPath(c.config.GPUMockDir)
+
+	// Create parent directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(gpuMockDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directory: %v", err)
+	}
+
+	if err := os.Mkdir(gpuMockDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create mock dir: %v", err)
+	}
+
+	return c.config.GPUMockDir, nil
+}
+
+func (c *Controller) journalFile() string {
+	if c.config.JournalFile == "" {
+		return DefaultJournalFile
+	}
+	return c.config.JournalFile
+}
+
+// addPreload adds the library to the preload file, saving its original content
+// in the recovery journal first.
+func (c *Controller) addPreload(mockDir, libPath string) error {
+	ldPreloadFile := utils.HostPath(c.config.LDPreloadFile)
+
 	// Save original preload state
-	preloadContent, err := os.ReadFile(c.config.LDPreloadFile)
+	exists := true
+	preloadContent, err := os.ReadFile(ldPreloadFile)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("failed to read preload file: %v", err)
 		}
 		// File doesn't exist, that's fine
+		exists = false
 		preloadContent = []byte{}
 	}
 	c.originalPreloadContent = string(preloadContent)
+	c.originalPreloadExists = exists
+
+	err = writeJournal(c.journalFile(), &Journal{
+		PID:             os.Getpid(),
+		BootID:          currentBootID(),
+		Time:            time.Now(),
+		LDPreloadFile:   c.config.LDPreloadFile,
+		OriginalExists:  exists,
+		OriginalContent: c.originalPreloadContent,
+		Checksum:        checksum(c.originalPreloadContent),
+		GPUMockDir:      mockDir,
+	})
+	if err != nil {
+		return err
+	}
 
 	// Add our library to preload
 	newContent := c.originalPreloadContent
@@ -104,23 +283,36 @@ func (c *Controller) Start() error {
 	newContent += libPath + "\n"
 
 	// Write updated preload content
-	if err := os.WriteFile(c.config.LDPreloadFile, []byte(newContent), 0644); err != nil {
+	if err := writeFileSync(ldPreloadFile, []byte(newContent), 0644); err != nil {
+		os.Remove(utils.HostPath(c.journalFile()))
 		return fmt.Errorf("failed to update preload file: %v", err)
 	}
 
-	// Copy config file
-	destPath := filepath.Join(c.config.GPUMockDir, "gpu_mock_conf.toml")
-	configData, err := os.ReadFile(c.config.ConfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+	return nil
+}
+
+// Env returns the environment variables injecting the library into a process,
+// to be added to its environment. In global mode the library is already
+// injected, and only its config path is returned.
+func (c *Controller) Env() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.active {
+		return nil
 	}
 
-	if err := os.WriteFile(destPath, configData, 0644); err != nil {
-		return fmt.Errorf("failed to copy config file: %v", err)
+	env := []string{EnvConfPath + "=" + c.confPath}
+	if c.config.Global {
+		return env
 	}
 
-	c.active = true
-	return nil
+	preload := c.tempLibPath
+	if existing := os.Getenv(EnvLDPreload); existing != "" {
+		preload += ":" + existing
+	}
+
+	return append(env, EnvLDPreload+"="+preload)
 }
 
 func (c *Controller) Stop() error {
@@ -131,22 +323,28 @@ func (c *Controller) Stop() error {
 		return nil
 	}
 
+	if c.stopTimeline != nil {
+		close(c.stopTimeline)
+		<-c.timelineDone
+		c.stopTimeline = nil
+		c.timelineDone = nil
+	}
+
 	// Clean up preload file
 	if c.tempLibPath != "" {
-		if c.originalPreloadContent == "" {
-			// If file didn't exist originally, remove it
-			if err := os.Remove(c.config.LDPreloadFile); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("failed to remove preload file: %v", err)
+		if c.config.Global {
+			// Restore original content, or remove the file if it didn't exist
+			if err := restorePreload(c.config.LDPreloadFile, c.originalPreloadExists, c.originalPreloadContent); err != nil {
+				return err
 			}
-		} else {
-			// Restore original content
-			if err := os.WriteFile(c.config.LDPreloadFile, []byte(c.originalPreloadContent), 0644); err != nil {
-				return fmt.Errorf("failed to restore preload file: %v", err)
+			// The preload file is restored, the journal is no longer needed
+			if err := os.Remove(utils.HostPath(c.journalFile())); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove journal: %v", err)
 			}
 		}
 
 		// Clean up temporary files
-		if err := os.RemoveAll(filepath.Dir(c.tempLibPath)); err != nil {
+		if err := os.RemoveAll(utils.HostPath(filepath.Dir(c.tempLibPath))); err != nil {
 			return fmt.Errorf("failed to cleanup temp library: %v", err)
 		}
 		c.tempLibPath = ""
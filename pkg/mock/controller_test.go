@@ -5,8 +5,15 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
 )
 
+const testConfig = `version = "0.1.0"
+[gpus.0]
+dram_ue = 1
+`
+
 func TestNewController(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -20,6 +27,30 @@ func TestNewController(t *testing.T) {
 			wantErr:     true,
 			errContains: "config path is required",
 		},
+		{
+			name: "global without gpu mock dir",
+			config: &Config{
+				ConfigPath:    "testdata/config.toml",
+				LDPreloadFile: "/tmp/ld.so.preload",
+				Global:        true,
+			},
+			wantErr:     true,
+			errContains: "gpu mock dir is required in global mode",
+		},
+		{
+			name: "global without preload file",
+			config: &Config{
+				ConfigPath: "testdata/config.toml",
+				GPUMockDir: "/tmp/gpu-mock",
+				Global:     true,
+			},
+			wantErr:     true,
+			errContains: "ld preload file is required in global mode",
+		},
+		{
+			name:   "process mode",
+			config: &Config{ConfigPath: "testdata/config.toml"},
+		},
 		{
 			name: "valid config",
 			config: &Config{
@@ -68,7 +99,7 @@ func TestController_StartStop(t *testing.T) {
 	preloadPath := filepath.Join(tempDir, "ld.so.preload")
 
 	// Create a test config file
-	if err := os.WriteFile(configPath, []byte("test config"), 0644); err != nil {
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
 		t.Fatalf("failed to create test config: %v", err)
 	}
 
@@ -76,6 +107,8 @@ func TestController_StartStop(t *testing.T) {
 		ConfigPath:    configPath,
 		GPUMockDir:    mockDir,
 		LDPreloadFile: preloadPath,
+		Global:        true,
+		JournalFile:   filepath.Join(tempDir, "journal.json"),
 	}
 
 	controller, err := NewController(config)
@@ -121,3 +154,135 @@ func TestController_StartStop(t *testing.T) {
 		t.Error("mock directory was not cleaned up")
 	}
 }
+
+func TestController_StartStopHostRoot(t *testing.T) {
+	hostRoot := t.TempDir()
+	defer utils.SetFSRoot(hostRoot)()
+
+	if err := os.MkdirAll(filepath.Join(hostRoot, "etc"), 0755); err != nil {
+		t.Fatalf("failed to create host etc: %v", err)
+	}
+	preloadPath := filepath.Join(hostRoot, "etc", "ld.so.preload")
+	if err := os.WriteFile(preloadPath, []byte("/usr/lib/libother.so\n"), 0644); err != nil {
+		t.Fatalf("failed to create preload file: %v", err)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	controller, err := NewController(&Config{
+		ConfigPath:    configPath,
+		GPUMockDir:    "/opt/gpu_mock",
+		LDPreloadFile: "/etc/ld.so.preload",
+		Global:        true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	if err := controller.Start(); err != nil {
+		t.Fatalf("failed to start mock environment: %v", err)
+	}
+
+	// The files are written under the host root, but the preload file refers
+	// to the library as seen by host processes.
+	if _, err := os.Stat(filepath.Join(hostRoot, "opt", "gpu_mock", "gpu_mock_conf.toml")); err != nil {
+		t.Errorf("mock config file was not created under the host root: %v", err)
+	}
+	content, err := os.ReadFile(preloadPath)
+	if err != nil {
+		t.Fatalf("failed to read preload file: %v", err)
+	}
+	if want := "/usr/lib/libother.so\n/opt/gpu_mock/nvml_injectiond.so\n"; string(content) != want {
+		t.Errorf("preload content = %q, want %q", content, want)
+	}
+
+	if err := controller.Stop(); err != nil {
+		t.Fatalf("failed to stop mock environment: %v", err)
+	}
+
+	content, err = os.ReadFile(preloadPath)
+	if err != nil {
+		t.Fatalf("failed to read preload file: %v", err)
+	}
+	if want := "/usr/lib/libother.so\n"; string(content) != want {
+		t.Errorf("preload content = %q, want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(hostRoot, "opt", "gpu_mock")); !os.IsNotExist(err) {
+		t.Error("mock directory was not cleaned up")
+	}
+}
+
+func TestController_StartStopProcess(t *testing.T) {
+	hostRoot := t.TempDir()
+	defer utils.SetFSRoot(hostRoot)()
+	if err := os.MkdirAll(filepath.Join(hostRoot, os.TempDir()), 0755); err != nil {
+		t.Fatalf("failed to create host temp dir: %v", err)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+	t.Setenv(EnvLDPreload, "/usr/lib/libother.so")
+
+	controller, err := NewController(&Config{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+	if env := controller.Env(); env != nil {
+		t.Errorf("env before Start() = %v, want nil", env)
+	}
+
+	if err := controller.Start(); err != nil {
+		t.Fatalf("failed to start mock environment: %v", err)
+	}
+
+	env := controller.Env()
+	if len(env) != 2 {
+		t.Fatalf("env = %v, want config path and preload", env)
+	}
+	confPath := strings.TrimPrefix(env[0], EnvConfPath+"=")
+	if data, err := os.ReadFile(filepath.Join(hostRoot, confPath)); err != nil || string(data) != testConfig {
+		t.Errorf("config file under the host root = %q, %v", data, err)
+	}
+	libPath := filepath.Join(filepath.Dir(confPath), libName)
+	if want := EnvLDPreload + "=" + libPath + ":/usr/lib/libother.so"; env[1] != want {
+		t.Errorf("preload env = %q, want %q", env[1], want)
+	}
+	if _, err := os.Stat(filepath.Join(hostRoot, libPath)); err != nil {
+		t.Errorf("library was not created under the host root: %v", err)
+	}
+
+	if err := controller.Stop(); err != nil {
+		t.Fatalf("failed to stop mock environment: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hostRoot, filepath.Dir(confPath))); !os.IsNotExist(err) {
+		t.Error("mock directory was not cleaned up")
+	}
+}
+
+func TestController_StartInvalidConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.toml")
+	if err := os.WriteFile(configPath, []byte("[gpus.0]\ndram_eu = 1\n"), 0644); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	controller, err := NewController(&Config{
+		ConfigPath: configPath,
+		GPUMockDir: filepath.Join(tempDir, "gpu_mock"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	err = controller.Start()
+	if want := "invalid config file: line 2: gpus.0.dram_eu: unknown key"; err == nil || err.Error() != want {
+		t.Errorf("Start() error = %v, want %v", err, want)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "gpu_mock")); !os.IsNotExist(err) {
+		t.Error("mock directory should not be created")
+	}
+}
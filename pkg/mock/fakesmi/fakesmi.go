@@ -0,0 +1,579 @@
+// Package fakesmi implements a fake nvidia-smi answering from a mock config,
+// so that the diagnosis can be tested end to end on machines without GPUs.
+package fakesmi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock"
+)
+
+// Exit codes of nvidia-smi.
+const (
+	exitOK              = 0
+	exitInvalidArgument = 2
+	exitNoDevices       = 6
+)
+
+const (
+	driverVersion = "535.161.08"
+	cudaVersion   = "12.2"
+
+	defaultDeviceName = "NVIDIA A100-SXM4-80GB"
+	defaultLinkGen    = 4
+	defaultLinkWidth  = 16
+
+	driverFailedMsg = "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver. " +
+		"Make sure that the latest NVIDIA driver is installed and running."
+	invalidArgsMsg = "Invalid combination of input arguments. Please run 'nvidia-smi -h' for help."
+)
+
+// Main runs the fake nvidia-smi with the mock config at GPU_MOCK_CONF_PATH,
+// the same as the injection library, and returns the exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	path := os.Getenv(mock.EnvConfPath)
+	if path == "" {
+		fmt.Fprintf(stderr, "%s is not set\n", mock.EnvConfPath)
+		return exitInvalidArgument
+	}
+	config, err := mock.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid mock config %s: %v\n", path, err)
+		return exitInvalidArgument
+	}
+
+	return Run(config, args, stdout, stderr)
+}
+
+// Run runs the fake nvidia-smi with the given mock config and returns the exit
+// code. It supports -L, --query-gpu, --query-retired-pages, -q -x, topo -m and
+// nvlink -s.
+func Run(config *mock.MockConfig, args []string, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr, invalidArgsMsg)
+		return exitInvalidArgument
+	}
+
+	if code := nvmlInitError(config); code != 0 {
+		fmt.Fprintln(stdout, driverFailedMsg)
+		return code
+	}
+
+	gpus := newGPUs(config)
+	selected, err := selectGPUs(gpus, opts.ids)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return exitNoDevices
+	}
+	if len(selected) == 0 {
+		fmt.Fprintln(stdout, "No devices were found")
+		return exitNoDevices
+	}
+
+	switch {
+	case opts.list:
+		for _, g := range selected {
+			fmt.Fprintf(stdout, "GPU %d: %s (UUID: %s)\n", g.index, g.name, g.uuid)
+		}
+	case opts.queryGPU != "":
+		return writeCSV(stdout, stderr, opts, selected, gpuFields)
+	case opts.queryRetiredPages != "":
+		var pages []*retiredPage
+		for _, g := range selected {
+			pages = append(pages, g.retiredPages()...)
+		}
+		return writeCSV(stdout, stderr, opts, pages, retiredPageFields)
+	case opts.query && opts.xml:
+		return writeXML(stdout, stderr, selected)
+	case opts.topo:
+		writeTopoMatrix(stdout, gpus)
+	case opts.nvlink:
+		writeNVLinkStatus(stdout, selected)
+	default:
+		fmt.Fprintln(stderr, invalidArgsMsg)
+		return exitInvalidArgument
+	}
+
+	return exitOK
+}
+
+func nvmlInitError(config *mock.MockConfig) int {
+	if config.GPUs == nil || config.GPUs.NVMLInitError == nil || *config.GPUs.NVMLInitError == 0 {
+		return 0
+	}
+	if code := *config.GPUs.NVMLInitError; code > 0 && code < 256 {
+		return code
+	}
+	return 255
+}
+
+type options struct {
+	list              bool
+	ids               []string
+	queryGPU          string
+	queryRetiredPages string
+	format            string
+	query             bool
+	xml               bool
+	topo              bool
+	nvlink            bool
+}
+
+func parseArgs(args []string) (*options, error) {
+	opts := &options{}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		// nextValue returns the value of the flag, after = or in the next arg.
+		nextValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing value of %s", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch {
+		case i == 0 && name == "topo":
+			opts.topo = true
+		case i == 0 && name == "nvlink":
+			opts.nvlink = true
+		case name == "-L" || name == "--list-gpus":
+			opts.list = true
+		case name == "-i" || name == "--id":
+			var ids string
+			ids, err = nextValue()
+			opts.ids = strings.Split(ids, ",")
+		case name == "--query-gpu":
+			opts.queryGPU, err = nextValue()
+		case name == "--query-retired-pages":
+			opts.queryRetiredPages, err = nextValue()
+		case name == "--format":
+			opts.format, err = nextValue()
+		case name == "-q" || name == "--query":
+			opts.query = true
+		case name == "-x" || name == "--xml-format":
+			opts.xml = true
+		case opts.topo && (name == "-m" || name == "--matrix"):
+		case opts.nvlink && (name == "-s" || name == "--status"):
+		default:
+			return nil, fmt.Errorf("unknown argument %q", args[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// selectGPUs returns the GPUs with the given indices, UUIDs or bus ids, all
+// GPUs if none are given.
+func selectGPUs(gpus []*gpu, ids []string) ([]*gpu, error) {
+	if len(ids) == 0 {
+		return gpus, nil
+	}
+
+	var selected []*gpu
+	for _, id := range ids {
+		found := false
+		for _, g := range gpus {
+			if id == strconv.Itoa(g.index) || id == g.uuid || strings.EqualFold(id, g.busID) {
+				selected = append(selected, g)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No devices were found")
+		}
+	}
+
+	return selected, nil
+}
+
+type gpu struct {
+	index              int
+	name               string
+	uuid               string
+	busID              string
+	linkGen            int
+	linkWidthMax       int
+	linkWidthCurrent   int
+	eccUncorrected     int
+	dramUncorrected    int
+	eccCorrected       int
+	retiredSBE         int
+	retiredDBE         int
+	retiredPending     bool
+	remappingPending   bool
+	remappingFailure   bool
+	nvlinkActive       []bool
+	uncorrectedAggL1   int
+	uncorrectedAggL2   int
+	uncorrectedAggReg  int
+	uncorrectedAggSRAM int
+}
+
+// newGPUs returns the GPUs of the mock config, card_count defaults to the
+// highest configured index plus one.
+func newGPUs(config *mock.MockConfig) []*gpu {
+	count := 0
+	var cards map[int]*mock.GPUConfig
+	if config.GPUs != nil {
+		cards = config.GPUs.Cards
+		for index := range cards {
+			if index+1 > count {
+				count = index + 1
+			}
+		}
+		if config.GPUs.CardCount != nil {
+			count = *config.GPUs.CardCount
+		}
+	}
+
+	gpus := make([]*gpu, 0, count)
+	for i := 0; i < count; i++ {
+		gpus = append(gpus, newGPU(i, cards[i]))
+	}
+	return gpus
+}
+
+func newGPU(index int, card *mock.GPUConfig) *gpu {
+	if card == nil {
+		card = &mock.GPUConfig{}
+	}
+
+	g := &gpu{
+		index:              index,
+		name:               stringOr(card.DeviceName, defaultDeviceName),
+		uuid:               stringOr(card.UUID, fmt.Sprintf("GPU-00000000-0000-0000-0000-%012d", index)),
+		busID:              fmt.Sprintf("00000000:%02X:00.0", index+1),
+		linkGen:            intOr(card.LinkGen, defaultLinkGen),
+		linkWidthMax:       intOr(card.LinkWidthMax, defaultLinkWidth),
+		dramUncorrected:    intOr(card.DRAMUE, 0),
+		eccCorrected:       intOr(card.DRAMCE, 0),
+		retiredSBE:         intOr(card.RetiredPageSBE, 0),
+		retiredDBE:         intOr(card.RetiredPageDBE, 0),
+		retiredPending:     boolOr(card.RetiredPagePending, false),
+		remappingPending:   boolOr(card.RemappingPending, false),
+		remappingFailure:   boolOr(card.RemappingFailure, false),
+		nvlinkActive:       card.NVLinkActive,
+		uncorrectedAggL1:   intOr(card.UncorrectableAggL1, 0),
+		uncorrectedAggL2:   intOr(card.UncorrectableAggL2, 0),
+		uncorrectedAggReg:  intOr(card.UncorrectableAggReg, 0),
+		uncorrectedAggSRAM: intOr(card.SRAMUE, 0),
+	}
+	g.linkWidthCurrent = intOr(card.LinkWidthCurrent, g.linkWidthMax)
+	g.eccUncorrected = g.uncorrectedAggSRAM + g.dramUncorrected
+
+	// pci is bus:device, e.g. 3b:00.
+	if card.PCI != nil {
+		if bus, device, ok := strings.Cut(*card.PCI, ":"); ok {
+			g.busID = fmt.Sprintf("00000000:%s:%s.0", strings.ToUpper(bus), strings.ToUpper(device))
+		}
+	}
+
+	return g
+}
+
+func stringOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
+}
+
+func intOr(i *int, def int) int {
+	if i == nil {
+		return def
+	}
+	return *i
+}
+
+func boolOr(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+type retiredPage struct {
+	address uint64
+	cause   string
+}
+
+// retiredPages returns fake addresses of the retired pages, single bit errors
+// first.
+func (g *gpu) retiredPages() []*retiredPage {
+	var pages []*retiredPage
+	for i := 0; i < g.retiredSBE+g.retiredDBE; i++ {
+		cause := "Single Bit ECC"
+		if i >= g.retiredSBE {
+			cause = "Double Bit ECC"
+		}
+		pages = append(pages, &retiredPage{
+			address: uint64(g.index+1)<<32 | uint64(i+1)<<12,
+			cause:   cause,
+		})
+	}
+	return pages
+}
+
+// gpuFields are the supported --query-gpu fields.
+var gpuFields = map[string]func(*gpu) string{
+	"index":                                          func(g *gpu) string { return strconv.Itoa(g.index) },
+	"name":                                           func(g *gpu) string { return g.name },
+	"uuid":                                           func(g *gpu) string { return g.uuid },
+	"pci.bus_id":                                     func(g *gpu) string { return g.busID },
+	"driver_version":                                 func(g *gpu) string { return driverVersion },
+	"pcie.link.gen.current":                          func(g *gpu) string { return strconv.Itoa(g.linkGen) },
+	"pcie.link.gen.max":                              func(g *gpu) string { return strconv.Itoa(g.linkGen) },
+	"pcie.link.width.current":                        func(g *gpu) string { return strconv.Itoa(g.linkWidthCurrent) },
+	"pcie.link.width.max":                            func(g *gpu) string { return strconv.Itoa(g.linkWidthMax) },
+	"ecc.mode.current":                               func(g *gpu) string { return "Enabled" },
+	"ecc.errors.uncorrected.volatile.total":          func(g *gpu) string { return strconv.Itoa(g.eccUncorrected) },
+	"ecc.errors.corrected.volatile.total":            func(g *gpu) string { return strconv.Itoa(g.eccCorrected) },
+	"ecc.errors.uncorrected.volatile.sram":           func(g *gpu) string { return strconv.Itoa(g.uncorrectedAggSRAM) },
+	"ecc.errors.uncorrected.volatile.dram":           func(g *gpu) string { return strconv.Itoa(g.dramUncorrected) },
+	"ecc.errors.corrected.volatile.dram":             func(g *gpu) string { return strconv.Itoa(g.eccCorrected) },
+	"ecc.errors.uncorrected.aggregate.l1_cache":      func(g *gpu) string { return strconv.Itoa(g.uncorrectedAggL1) },
+	"ecc.errors.uncorrected.aggregate.l2_cache":      func(g *gpu) string { return strconv.Itoa(g.uncorrectedAggL2) },
+	"ecc.errors.uncorrected.aggregate.register_file": func(g *gpu) string { return strconv.Itoa(g.uncorrectedAggReg) },
+	"retired_pages.sbe":                              func(g *gpu) string { return strconv.Itoa(g.retiredSBE) },
+	"retired_pages.dbe":                              func(g *gpu) string { return strconv.Itoa(g.retiredDBE) },
+	"retired_pages.pending":                          func(g *gpu) string { return yesNo(g.retiredPending) },
+	"remapped_rows.pending":                          func(g *gpu) string { return yesNo(g.remappingPending) },
+	"remapped_rows.failure":                          func(g *gpu) string { return yesNo(g.remappingFailure) },
+}
+
+// retiredPageFields are the supported --query-retired-pages fields.
+var retiredPageFields = map[string]func(*retiredPage) string{
+	"retired_pages.address": func(p *retiredPage) string { return fmt.Sprintf("0x%016x", p.address) },
+	"retired_pages.cause":   func(p *retiredPage) string { return p.cause },
+}
+
+// writeCSV writes the queried fields of every row in the given format, which
+// must be csv.
+func writeCSV[T any](stdout, stderr io.Writer, opts *options, rows []T, fields map[string]func(T) string) int {
+	query := opts.queryGPU
+	if query == "" {
+		query = opts.queryRetiredPages
+	}
+	names := strings.Split(query, ",")
+	for _, name := range names {
+		if _, ok := fields[name]; !ok {
+			fmt.Fprintf(stderr, "Field \"%s\" is not a valid field to query.\n", name)
+			return exitInvalidArgument
+		}
+	}
+
+	formats := strings.Split(opts.format, ",")
+	if formats[0] != "csv" {
+		fmt.Fprintf(stderr, "Format \"%s\" is not supported.\n", opts.format)
+		return exitInvalidArgument
+	}
+	noHeader := false
+	for _, format := range formats[1:] {
+		switch format {
+		case "noheader":
+			noHeader = true
+		case "nounits":
+		default:
+			fmt.Fprintf(stderr, "Format \"%s\" is not supported.\n", opts.format)
+			return exitInvalidArgument
+		}
+	}
+
+	if !noHeader {
+		fmt.Fprintln(stdout, strings.Join(names, ", "))
+	}
+	for _, row := range rows {
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			values = append(values, fields[name](row))
+		}
+		fmt.Fprintln(stdout, strings.Join(values, ", "))
+	}
+
+	return exitOK
+}
+
+type smiLog struct {
+	XMLName       xml.Name `xml:"nvidia_smi_log"`
+	DriverVersion string   `xml:"driver_version"`
+	CUDAVersion   string   `xml:"cuda_version"`
+	AttachedGPUs  int      `xml:"attached_gpus"`
+	GPUs          []smiGPU `xml:"gpu"`
+}
+
+type smiGPU struct {
+	ID          string `xml:"id,attr"`
+	ProductName string `xml:"product_name"`
+	UUID        string `xml:"uuid"`
+	MinorNumber int    `xml:"minor_number"`
+	PCI         smiPCI `xml:"pci"`
+	ECCMode     struct {
+		Current string `xml:"current_ecc"`
+		Pending string `xml:"pending_ecc"`
+	} `xml:"ecc_mode"`
+	ECCErrors struct {
+		Volatile struct {
+			SRAMUncorrectable int `xml:"sram_uncorrectable"`
+			DRAMUncorrectable int `xml:"dram_uncorrectable"`
+			DRAMCorrectable   int `xml:"dram_correctable"`
+		} `xml:"volatile"`
+		Aggregate struct {
+			L1CacheUncorrectable  int `xml:"l1_cache_uncorrectable"`
+			L2CacheUncorrectable  int `xml:"l2_cache_uncorrectable"`
+			RegisterUncorrectable int `xml:"register_file_uncorrectable"`
+		} `xml:"aggregate"`
+	} `xml:"ecc_errors"`
+	RetiredPages struct {
+		SingleBit struct {
+			Count int `xml:"retired_count"`
+		} `xml:"multiple_single_bit_retirement"`
+		DoubleBit struct {
+			Count int `xml:"retired_count"`
+		} `xml:"double_bit_retirement"`
+		Pending string `xml:"pending_retirement"`
+	} `xml:"retired_pages"`
+	RemappedRows struct {
+		Pending string `xml:"remapped_row_pending"`
+		Failure string `xml:"remapped_row_failure"`
+	} `xml:"remapped_rows"`
+}
+
+type smiPCI struct {
+	BusID    string `xml:"pci_bus_id"`
+	LinkInfo struct {
+		Gen struct {
+			Max     int `xml:"max_link_gen"`
+			Current int `xml:"current_link_gen"`
+		} `xml:"pcie_gen"`
+		Widths struct {
+			Max     string `xml:"max_link_width"`
+			Current string `xml:"current_link_width"`
+		} `xml:"link_widths"`
+	} `xml:"pci_gpu_link_info"`
+}
+
+func writeXML(stdout, stderr io.Writer, gpus []*gpu) int {
+	log := &smiLog{
+		DriverVersion: driverVersion,
+		CUDAVersion:   cudaVersion,
+		AttachedGPUs:  len(gpus),
+	}
+	for _, g := range gpus {
+		s := smiGPU{
+			ID:          g.busID,
+			ProductName: g.name,
+			UUID:        g.uuid,
+			MinorNumber: g.index,
+		}
+		s.PCI.BusID = g.busID
+		s.PCI.LinkInfo.Gen.Max = g.linkGen
+		s.PCI.LinkInfo.Gen.Current = g.linkGen
+		s.PCI.LinkInfo.Widths.Max = fmt.Sprintf("%dx", g.linkWidthMax)
+		s.PCI.LinkInfo.Widths.Current = fmt.Sprintf("%dx", g.linkWidthCurrent)
+		s.ECCMode.Current = "Enabled"
+		s.ECCMode.Pending = "Enabled"
+		s.ECCErrors.Volatile.SRAMUncorrectable = g.uncorrectedAggSRAM
+		s.ECCErrors.Volatile.DRAMUncorrectable = g.dramUncorrected
+		s.ECCErrors.Volatile.DRAMCorrectable = g.eccCorrected
+		s.ECCErrors.Aggregate.L1CacheUncorrectable = g.uncorrectedAggL1
+		s.ECCErrors.Aggregate.L2CacheUncorrectable = g.uncorrectedAggL2
+		s.ECCErrors.Aggregate.RegisterUncorrectable = g.uncorrectedAggReg
+		s.RetiredPages.SingleBit.Count = g.retiredSBE
+		s.RetiredPages.DoubleBit.Count = g.retiredDBE
+		s.RetiredPages.Pending = yesNo(g.retiredPending)
+		s.RemappedRows.Pending = yesNo(g.remappingPending)
+		s.RemappedRows.Failure = yesNo(g.remappingFailure)
+		log.GPUs = append(log.GPUs, s)
+	}
+
+	data, err := xml.MarshalIndent(log, "", "\t")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalidArgument
+	}
+	fmt.Fprintln(stdout, xml.Header+string(data))
+
+	return exitOK
+}
+
+func (g *gpu) activeNVLinks() int {
+	active := 0
+	for _, a := range g.nvlinkActive {
+		if a {
+			active++
+		}
+	}
+	return active
+}
+
+// writeTopoMatrix writes the topology matrix, GPUs with active NVLinks are
+// connected by the lower count of active links of both, others through the
+// system interconnect.
+func writeTopoMatrix(w io.Writer, gpus []*gpu) {
+	header := []string{""}
+	for _, g := range gpus {
+		header = append(header, fmt.Sprintf("GPU%d", g.index))
+	}
+	fmt.Fprintln(w, strings.Join(append(header, "CPU Affinity", "NUMA Affinity"), "\t"))
+
+	for _, g := range gpus {
+		row := []string{fmt.Sprintf("GPU%d", g.index)}
+		for _, peer := range gpus {
+			links := min(g.activeNVLinks(), peer.activeNVLinks())
+			switch {
+			case peer.index == g.index:
+				row = append(row, " X ")
+			case links > 0:
+				row = append(row, fmt.Sprintf("NV%d", links))
+			default:
+				row = append(row, "SYS")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(append(row, "0-63", "0"), "\t"))
+	}
+
+	fmt.Fprint(w, `
+Legend:
+
+  X    = Self
+  SYS  = Connection traversing PCIe as well as the SMP interconnect between NUMA nodes (e.g., QPI/UPI)
+  NV#  = Connection traversing a bonded set of # NVLinks
+`)
+}
+
+// writeNVLinkStatus writes the status of every NVLink of the GPUs.
+func writeNVLinkStatus(w io.Writer, gpus []*gpu) {
+	for _, g := range gpus {
+		fmt.Fprintf(w, "GPU %d: %s (UUID: %s)\n", g.index, g.name, g.uuid)
+		for link, active := range g.nvlinkActive {
+			if active {
+				fmt.Fprintf(w, "\t Link %d: 25 GB/s\n", link)
+			} else {
+				fmt.Fprintf(w, "\t Link %d: <inactive>\n", link)
+			}
+		}
+	}
+}
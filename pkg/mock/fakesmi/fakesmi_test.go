@@ -0,0 +1,270 @@
+package fakesmi
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const testConfig = `version = "0.1.0"
+[gpus]
+card_count = 2
+[gpus.0]
+pci = "3b:00"
+link_width_current = 8
+dram_ue = 2
+sram_ue = 1
+dram_ce = 5
+retired_page_sbe = 1
+retired_page_dbe = 1
+nvlink_active = [true, false, true]
+[gpus.1]
+device_name = "A800"
+uuid = "GPU-1"
+nvlink_active = [true, true]
+`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		args     []string
+		wantCode int
+		wantOut  string
+		// wantContains is checked instead of wantOut for long outputs.
+		wantContains string
+		wantErr      string
+	}{
+		{
+			name:     "list gpus",
+			config:   testConfig,
+			args:     []string{"-L"},
+			wantCode: 0,
+			wantOut: "GPU 0: NVIDIA A100-SXM4-80GB (UUID: GPU-00000000-0000-0000-0000-000000000000)\n" +
+				"GPU 1: A800 (UUID: GPU-1)\n",
+		},
+		{
+			name:     "card count defaults to configured cards",
+			config:   "[gpus.2]\ndram_ue = 1\n",
+			args:     []string{"--query-gpu=index", "--format=csv,noheader"},
+			wantCode: 0,
+			wantOut:  "0\n1\n2\n",
+		},
+		{
+			name:     "query gpu",
+			config:   testConfig,
+			args:     []string{"--query-gpu=index,pci.bus_id,uuid", "--format=csv"},
+			wantCode: 0,
+			wantOut: "index, pci.bus_id, uuid\n" +
+				"0, 00000000:3B:00.0, GPU-00000000-0000-0000-0000-000000000000\n" +
+				"1, 00000000:02:00.0, GPU-1\n",
+		},
+		{
+			name:   "query gpu by index",
+			config: testConfig,
+			args: []string{"-i", "0", "--query-gpu=pcie.link.width.max,pcie.link.width.current,ecc.mode.current," +
+				"ecc.errors.uncorrected.volatile.total,ecc.errors.corrected.volatile.total", "--format=csv,noheader,nounits"},
+			wantCode: 0,
+			wantOut:  "16, 8, Enabled, 3, 5\n",
+		},
+		{
+			name:     "query gpu by uuid",
+			config:   testConfig,
+			args:     []string{"--id=GPU-1", "--query-gpu=name,remapped_rows.pending", "--format=csv,noheader"},
+			wantCode: 0,
+			wantOut:  "A800, No\n",
+		},
+		{
+			name:     "query retired pages",
+			config:   testConfig,
+			args:     []string{"-i", "0", "--query-retired-pages=retired_pages.address,retired_pages.cause", "--format=csv,noheader"},
+			wantCode: 0,
+			wantOut:  "0x0000000100001000, Single Bit ECC\n0x0000000100002000, Double Bit ECC\n",
+		},
+		{
+			name:     "no retired pages",
+			config:   testConfig,
+			args:     []string{"-i", "1", "--query-retired-pages=retired_pages.address,retired_pages.cause", "--format=csv,noheader"},
+			wantCode: 0,
+			wantOut:  "",
+		},
+		{
+			name:         "topology matrix",
+			config:       testConfig,
+			args:         []string{"topo", "-m"},
+			wantCode:     0,
+			wantContains: "GPU0\t X \tNV2\t0-63\t0\nGPU1\tNV2\t X \t0-63\t0\n",
+		},
+		{
+			name:         "nvlink status",
+			config:       testConfig,
+			args:         []string{"nvlink", "-s", "-i", "0"},
+			wantCode:     0,
+			wantContains: "\t Link 0: 25 GB/s\n\t Link 1: <inactive>\n\t Link 2: 25 GB/s\n",
+		},
+		{
+			name:         "nvml init error",
+			config:       "[gpus]\nnvml_init_error = 9\n",
+			args:         []string{"-L"},
+			wantCode:     9,
+			wantContains: "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver",
+		},
+		{
+			name:     "no gpus",
+			config:   "",
+			args:     []string{"-L"},
+			wantCode: 6,
+			wantOut:  "No devices were found\n",
+		},
+		{
+			name:     "unknown index",
+			config:   testConfig,
+			args:     []string{"-i", "2", "--query-gpu=uuid", "--format=csv,noheader"},
+			wantCode: 6,
+			wantOut:  "No devices were found\n",
+		},
+		{
+			name:     "unknown field",
+			config:   testConfig,
+			args:     []string{"--query-gpu=temperature.gpu", "--format=csv"},
+			wantCode: 2,
+			wantErr:  `Field "temperature.gpu" is not a valid field to query.`,
+		},
+		{
+			name:     "unknown format",
+			config:   testConfig,
+			args:     []string{"--query-gpu=uuid", "--format=json"},
+			wantCode: 2,
+			wantErr:  `Format "json" is not supported.`,
+		},
+		{
+			name:     "unknown argument",
+			config:   testConfig,
+			args:     []string{"--reset"},
+			wantCode: 2,
+			wantErr:  `unknown argument "--reset"`,
+		},
+		{
+			name:     "missing value",
+			config:   testConfig,
+			args:     []string{"-L", "-i"},
+			wantCode: 2,
+			wantErr:  "missing value of -i",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := mock.ParseConfig([]byte(tt.config))
+			assert.NoError(t, err)
+
+			var stdout, stderr bytes.Buffer
+			code := Run(config, tt.args, &stdout, &stderr)
+			assert.Equal(t, tt.wantCode, code)
+			if tt.wantErr != "" {
+				assert.Contains(t, stderr.String(), tt.wantErr)
+				return
+			}
+			assert.Empty(t, stderr.String())
+			if tt.wantContains != "" {
+				assert.Contains(t, stdout.String(), tt.wantContains)
+			} else {
+				assert.Equal(t, tt.wantOut, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunXML(t *testing.T) {
+	config, err := mock.ParseConfig([]byte(testConfig))
+	assert.NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, Run(config, []string{"-q", "-x"}, &stdout, &stderr))
+	assert.Empty(t, stderr.String())
+
+	var log smiLog
+	assert.NoError(t, xml.Unmarshal(stdout.Bytes(), &log))
+	assert.Equal(t, 2, log.AttachedGPUs)
+	assert.Len(t, log.GPUs, 2)
+	assert.Equal(t, "00000000:3B:00.0", log.GPUs[0].PCI.BusID)
+	assert.Equal(t, "8x", log.GPUs[0].PCI.LinkInfo.Widths.Current)
+	assert.Equal(t, 1, log.GPUs[0].ECCErrors.Volatile.SRAMUncorrectable)
+	assert.Equal(t, 2, log.GPUs[0].ECCErrors.Volatile.DRAMUncorrectable)
+	assert.Equal(t, 1, log.GPUs[0].RetiredPages.DoubleBit.Count)
+	assert.Equal(t, "A800", log.GPUs[1].ProductName)
+}
+
+func TestMainConfigPath(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	t.Setenv(mock.EnvConfPath, "")
+	assert.Equal(t, 2, Main([]string{"-L"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), mock.EnvConfPath+" is not set")
+
+	path := filepath.Join(t.TempDir(), "gpu_mock_conf.toml")
+	assert.NoError(t, os.WriteFile(path, []byte(testConfig), 0644))
+	t.Setenv(mock.EnvConfPath, path)
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 0, Main([]string{"-L"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "GPU 1: A800 (UUID: GPU-1)")
+}
+
+// TestRecordReplay records the state of the fake GPUs and checks that the fake
+// nvidia-smi answers the same from the recorded config.
+func TestRecordReplay(t *testing.T) {
+	config, err := mock.ParseConfig([]byte(testConfig))
+	assert.NoError(t, err)
+	run := func(config *mock.MockConfig) utils.ExecCmdFunc {
+		return func(_ context.Context, _ string, args []string) (string, error) {
+			var stdout bytes.Buffer
+			if code := Run(config, args, &stdout, &stdout); code != 0 {
+				return stdout.String(), fmt.Errorf("exit status %d", code)
+			}
+			return stdout.String(), nil
+		}
+	}
+
+	restore := utils.SetExecCmd(run(config))
+	recorded, err := mock.Record(context.Background(), &mock.RecordOptions{})
+	restore()
+	assert.NoError(t, err)
+	data, err := mock.EncodeConfig(recorded)
+	assert.NoError(t, err)
+	replayed, err := mock.ParseConfig(data)
+	assert.NoError(t, err)
+
+	for _, args := range [][]string{
+		{"-L"},
+		{"-q", "-x"},
+		{"nvlink", "-s"},
+		{"--query-retired-pages=retired_pages.address,retired_pages.cause", "--format=csv"},
+		{"--query-gpu=" + strings.Join(sortedKeys(gpuFields), ","), "--format=csv"},
+	} {
+		want, err := run(config)(context.Background(), "nvidia-smi", args)
+		assert.NoError(t, err)
+		got, err := run(replayed)(context.Background(), "nvidia-smi", args)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, "nvidia-smi %s", strings.Join(args, " "))
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,223 @@
+package mock
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	// DefaultJournalFile is where the recovery journal of a global mock
+	// environment is written. It is kept on disk, so that the preload file can
+	// be restored after a reboot.
+	DefaultJournalFile = "/var/lib/ai-accelerator-tool/mock-journal.json"
+
+	bootIDFile = "/proc/sys/kernel/random/boot_id"
+)
+
+// Journal records the state of the preload file before a global mock
+// environment modified it. It is written before the modification and removed
+// once the preload file is restored, so a journal left behind means the
+// environment was not stopped.
+type Journal struct {
+	PID    int    `json:"pid"`
+	BootID string `json:"bootID,omitempty"`
+	// Time the mock environment was started.
+	Time          time.Time `json:"time"`
+	LDPreloadFile string    `json:"ldPreloadFile"`
+	// OriginalExists is false if the preload file did not exist, in which case
+	// it is removed on restore.
+	OriginalExists  bool   `json:"originalExists"`
+	OriginalContent string `json:"originalContent"`
+	// Checksum is the sha256 of OriginalContent, guarding against restoring a
+	// corrupted journal.
+	Checksum   string `json:"checksum"`
+	GPUMockDir string `json:"gpuMockDir"`
+}
+
+// Alive returns whether the process which wrote the journal is still running.
+// A process of a previous boot is never alive, even if its pid was reused.
+func (j *Journal) Alive() bool {
+	if j.BootID != "" && j.BootID != currentBootID() {
+		return false
+	}
+	if j.PID <= 0 {
+		return false
+	}
+
+	err := syscall.Kill(j.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func currentBootID() string {
+	data, err := utils.ReadFile(bootIDFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ReadJournal reads the journal at the given host path, it returns nil if there
+// is none.
+func ReadJournal(journalFile string) (*Journal, error) {
+	data, err := utils.ReadFile(journalFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	journal := &Journal{}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %v", journalFile, err)
+	}
+	if journal.Checksum != checksum(journal.OriginalContent) {
+		return nil, fmt.Errorf("journal %s is corrupted: checksum mismatch", journalFile)
+	}
+
+	return journal, nil
+}
+
+func writeJournal(journalFile string, journal *Journal) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(utils.HostPath(filepath.Dir(journalFile)), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %v", err)
+	}
+	if err := writeFileSync(utils.HostPath(journalFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+
+	return nil
+}
+
+// Cleanup restores the preload file from the journal of a mock environment
+// which was not stopped, and removes its files. Without a journal, any entry of
+// the injection library is removed from the given preload file. It refuses to
+// clean up after a running process unless forced, and returns whether anything
+// was cleaned up.
+func Cleanup(journalFile, ldPreloadFile string, force bool) (bool, error) {
+	journal, err := ReadJournal(journalFile)
+	if err != nil {
+		return false, err
+	}
+	if journal == nil {
+		return removeInjection(ldPreloadFile)
+	}
+
+	if journal.Alive() && !force {
+		return false, fmt.Errorf("mock environment is active in pid %d, stop it first", journal.PID)
+	}
+
+	if err := restorePreload(journal.LDPreloadFile, journal.OriginalExists, journal.OriginalContent); err != nil {
+		return false, err
+	}
+	if journal.GPUMockDir != "" {
+		if err := os.RemoveAll(utils.HostPath(journal.GPUMockDir)); err != nil {
+			return false, fmt.Errorf("failed to remove mock dir: %v", err)
+		}
+	}
+	if err := os.Remove(utils.HostPath(journalFile)); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove journal: %v", err)
+	}
+
+	return true, nil
+}
+
+// restorePreload writes back the original content of the preload file, or
+// removes it if it did not exist.
+func restorePreload(ldPreloadFile string, exists bool, content string) error {
+	path := utils.HostPath(ldPreloadFile)
+	if !exists {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove preload file: %v", err)
+		}
+		return nil
+	}
+
+	if err := writeFileSync(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to restore preload file: %v", err)
+	}
+	return nil
+}
+
+// removeInjection removes the entries of the injection library from the
+// preload file, and returns whether there were any.
+func removeInjection(ldPreloadFile string) (bool, error) {
+	content, err := utils.ReadFile(ldPreloadFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read preload file: %v", err)
+	}
+
+	var kept []string
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		if filepath.Base(strings.TrimSpace(scanner.Text())) == libName {
+			found = true
+			continue
+		}
+		kept = append(kept, scanner.Text())
+	}
+	if !found {
+		return false, nil
+	}
+
+	newContent := ""
+	if len(kept) > 0 {
+		newContent = strings.Join(kept, "\n") + "\n"
+	}
+	if err := restorePreload(ldPreloadFile, newContent != "", newContent); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// writeFileSync writes to a temporary file in the same directory, syncs and
+// renames it, so that neither readers nor a crash leave a partial file.
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
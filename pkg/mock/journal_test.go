@@ -0,0 +1,212 @@
+package mock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	testJournalFile = "/var/lib/ai-accelerator-tool/mock-journal.json"
+	testPreloadFile = "/etc/ld.so.preload"
+	testMockDir     = "/opt/gpu_mock"
+	testBootID      = "boot-1"
+)
+
+func writeTestFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+}
+
+func TestCleanup(t *testing.T) {
+	injected := "/usr/lib/libother.so\n/opt/gpu_mock/nvml_injectiond.so\n"
+
+	tests := []struct {
+		name        string
+		journal     *Journal
+		rawJournal  string
+		preload     *string
+		force       bool
+		wantCleaned bool
+		wantErr     string
+		wantPreload *string
+	}{
+		{
+			name:        "nothing to clean up",
+			wantPreload: nil,
+		},
+		{
+			name:        "injection without journal",
+			preload:     strPtr(injected),
+			wantCleaned: true,
+			wantPreload: strPtr("/usr/lib/libother.so\n"),
+		},
+		{
+			name:        "only injection without journal",
+			preload:     strPtr("/opt/gpu_mock/nvml_injectiond.so\n"),
+			wantCleaned: true,
+			wantPreload: nil,
+		},
+		{
+			name: "journal of previous boot",
+			journal: &Journal{
+				PID:             os.Getpid(),
+				BootID:          "boot-0",
+				LDPreloadFile:   testPreloadFile,
+				OriginalExists:  true,
+				OriginalContent: "/usr/lib/libother.so\n",
+				GPUMockDir:      testMockDir,
+			},
+			preload:     strPtr(injected),
+			wantCleaned: true,
+			wantPreload: strPtr("/usr/lib/libother.so\n"),
+		},
+		{
+			name: "journal of preload file which did not exist",
+			journal: &Journal{
+				BootID:        testBootID,
+				LDPreloadFile: testPreloadFile,
+				GPUMockDir:    testMockDir,
+			},
+			preload:     strPtr("/opt/gpu_mock/nvml_injectiond.so\n"),
+			wantCleaned: true,
+			wantPreload: nil,
+		},
+		{
+			name: "journal of running process",
+			journal: &Journal{
+				PID:             os.Getpid(),
+				BootID:          testBootID,
+				LDPreloadFile:   testPreloadFile,
+				OriginalExists:  true,
+				OriginalContent: "/usr/lib/libother.so\n",
+				GPUMockDir:      testMockDir,
+			},
+			preload:     strPtr(injected),
+			wantErr:     "mock environment is active in pid " + strconv.Itoa(os.Getpid()) + ", stop it first",
+			wantPreload: strPtr(injected),
+		},
+		{
+			name: "forced cleanup of running process",
+			journal: &Journal{
+				PID:             os.Getpid(),
+				BootID:          testBootID,
+				LDPreloadFile:   testPreloadFile,
+				OriginalExists:  true,
+				OriginalContent: "/usr/lib/libother.so\n",
+				GPUMockDir:      testMockDir,
+			},
+			preload:     strPtr(injected),
+			force:       true,
+			wantCleaned: true,
+			wantPreload: strPtr("/usr/lib/libother.so\n"),
+		},
+		{
+			name:        "corrupted journal",
+			rawJournal:  `{"pid": 1, "originalExists": true, "originalContent": "x", "checksum": "sha256:0"}`,
+			preload:     strPtr(injected),
+			wantErr:     "journal " + testJournalFile + " is corrupted: checksum mismatch",
+			wantPreload: strPtr(injected),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			defer utils.SetFSRoot(root)()
+			writeTestFile(t, root, bootIDFile, testBootID+"\n")
+			writeTestFile(t, root, filepath.Join(testMockDir, libName), "")
+			if tt.preload != nil {
+				writeTestFile(t, root, testPreloadFile, *tt.preload)
+			}
+			if tt.journal != nil {
+				tt.journal.Checksum = checksum(tt.journal.OriginalContent)
+				data, err := json.Marshal(tt.journal)
+				assert.NoError(t, err)
+				writeTestFile(t, root, testJournalFile, string(data))
+			}
+			if tt.rawJournal != "" {
+				writeTestFile(t, root, testJournalFile, tt.rawJournal)
+			}
+
+			cleaned, err := Cleanup(testJournalFile, testPreloadFile, tt.force)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCleaned, cleaned)
+
+			content, err := os.ReadFile(filepath.Join(root, testPreloadFile))
+			if tt.wantPreload == nil {
+				assert.True(t, os.IsNotExist(err), "preload file should not exist")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, *tt.wantPreload, string(content))
+			}
+
+			if tt.journal != nil && tt.wantCleaned {
+				_, err := os.Stat(filepath.Join(root, testJournalFile))
+				assert.True(t, os.IsNotExist(err), "journal should be removed")
+				_, err = os.Stat(filepath.Join(root, testMockDir))
+				assert.True(t, os.IsNotExist(err), "mock dir should be removed")
+			}
+		})
+	}
+}
+
+func TestControllerRepairsStaleInjection(t *testing.T) {
+	root := t.TempDir()
+	defer utils.SetFSRoot(root)()
+	writeTestFile(t, root, bootIDFile, testBootID+"\n")
+	writeTestFile(t, root, testPreloadFile, "/usr/lib/libother.so\n")
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0644))
+
+	config := &Config{
+		ConfigPath:    configPath,
+		GPUMockDir:    testMockDir,
+		LDPreloadFile: testPreloadFile,
+		Global:        true,
+	}
+	crashed, err := NewController(config)
+	assert.NoError(t, err)
+	assert.NoError(t, crashed.Start())
+
+	journal, err := ReadJournal(testJournalFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), journal.PID)
+	assert.Equal(t, testBootID, journal.BootID)
+	assert.Equal(t, "/usr/lib/libother.so\n", journal.OriginalContent)
+
+	// The environment of a running process is not taken over.
+	controller, err := NewController(config)
+	assert.NoError(t, err)
+	assert.EqualError(t, controller.Start(),
+		"failed to clean up stale mock: mock environment is active in pid "+strconv.Itoa(os.Getpid())+", stop it first")
+
+	// After a reboot, the stale injection is repaired and injected again.
+	writeTestFile(t, root, bootIDFile, "boot-2\n")
+	assert.NoError(t, controller.Start())
+	content, err := os.ReadFile(filepath.Join(root, testPreloadFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/lib/libother.so\n/opt/gpu_mock/nvml_injectiond.so\n", string(content))
+
+	assert.NoError(t, controller.Stop())
+	content, err = os.ReadFile(filepath.Join(root, testPreloadFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/lib/libother.so\n", string(content))
+	_, err = os.Stat(filepath.Join(root, testJournalFile))
+	assert.True(t, os.IsNotExist(err), "journal should be removed")
+}
+
+func strPtr(s string) *string {
+	return &s
+}
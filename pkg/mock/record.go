@@ -0,0 +1,256 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// RecordOptions configure how the device state is recorded.
+type RecordOptions struct {
+	// Anonymize replaces the UUIDs of the GPUs by ones derived from their
+	// index. Serial numbers are not part of the mock config and never
+	// recorded.
+	Anonymize bool
+}
+
+// recordField is a --query-gpu field of nvidia-smi and the config it is
+// recorded into.
+type recordField struct {
+	name   string
+	record func(card *GPUConfig, value string) error
+}
+
+var recordFields = []recordField{
+	{"name", recordString(func(c *GPUConfig) **string { return &c.DeviceName })},
+	{"uuid", recordString(func(c *GPUConfig) **string { return &c.UUID })},
+	{"pci.bus_id", recordPCI},
+	{"pcie.link.gen.current", recordInt(func(c *GPUConfig) **int { return &c.LinkGen })},
+	{"pcie.link.width.current", recordInt(func(c *GPUConfig) **int { return &c.LinkWidthCurrent })},
+	{"pcie.link.width.max", recordInt(func(c *GPUConfig) **int { return &c.LinkWidthMax })},
+	{"ecc.errors.uncorrected.volatile.sram", recordInt(func(c *GPUConfig) **int { return &c.SRAMUE })},
+	{"ecc.errors.uncorrected.volatile.dram", recordInt(func(c *GPUConfig) **int { return &c.DRAMUE })},
+	{"ecc.errors.corrected.volatile.dram", recordInt(func(c *GPUConfig) **int { return &c.DRAMCE })},
+	{"ecc.errors.uncorrected.aggregate.l1_cache", recordInt(func(c *GPUConfig) **int { return &c.UncorrectableAggL1 })},
+	{"ecc.errors.uncorrected.aggregate.l2_cache", recordInt(func(c *GPUConfig) **int { return &c.UncorrectableAggL2 })},
+	{"ecc.errors.uncorrected.aggregate.register_file", recordInt(func(c *GPUConfig) **int { return &c.UncorrectableAggReg })},
+	{"retired_pages.sbe", recordInt(func(c *GPUConfig) **int { return &c.RetiredPageSBE })},
+	{"retired_pages.dbe", recordInt(func(c *GPUConfig) **int { return &c.RetiredPageDBE })},
+	{"retired_pages.pending", recordBool(func(c *GPUConfig) **bool { return &c.RetiredPagePending })},
+	{"remapped_rows.pending", recordBool(func(c *GPUConfig) **bool { return &c.RemappingPending })},
+	{"remapped_rows.failure", recordBool(func(c *GPUConfig) **bool { return &c.RemappingFailure })},
+}
+
+// Record returns the mock config of the GPUs of this node as reported by
+// nvidia-smi, so that their state can be replayed on any node. Values which are
+// not supported by the GPU or driver are left unset.
+func Record(ctx context.Context, opts *RecordOptions) (*MockConfig, error) {
+	cards, err := recordCards(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordNVLinks(ctx, cards); err != nil {
+		klog.V(2).InfoS("NVLink state not recorded", "err", err)
+	}
+
+	count := len(cards)
+	config := &MockConfig{
+		Version: SupportedConfigVersion,
+		GPUs: &GPUsConfig{
+			CardCount: &count,
+			Cards:     map[int]*GPUConfig{},
+		},
+	}
+	for index, card := range cards {
+		if opts.Anonymize && card.UUID != nil {
+			uuid := fmt.Sprintf("GPU-00000000-0000-0000-0000-%012d", index)
+			card.UUID = &uuid
+		}
+		config.GPUs.Cards[index] = card
+	}
+
+	return config, nil
+}
+
+// recordCards queries the fields of every GPU, ordered by index. Drivers fail
+// the whole query on a field they do not know, in which case the fields are
+// queried one by one and unknown ones are skipped.
+func recordCards(ctx context.Context) ([]*GPUConfig, error) {
+	rows, err := queryGPU(ctx, []string{"index"})
+	if err != nil {
+		return nil, err
+	}
+	cards := make([]*GPUConfig, len(rows))
+	for i := range cards {
+		cards[i] = &GPUConfig{}
+	}
+
+	if err := recordFieldValues(ctx, cards, recordFields); err == nil {
+		return cards, nil
+	}
+	for _, field := range recordFields {
+		if err := recordFieldValues(ctx, cards, []recordField{field}); err != nil {
+			klog.V(2).InfoS("Field not recorded", "field", field.name, "err", err)
+		}
+	}
+
+	return cards, nil
+}
+
+// recordFieldValues queries the fields of every GPU and records them.
+func recordFieldValues(ctx context.Context, cards []*GPUConfig, fields []recordField) error {
+	names := []string{"index"}
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+	rows, err := queryGPU(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		index, err := strconv.Atoi(row[0])
+		if err != nil || index < 0 || index >= len(cards) {
+			return fmt.Errorf("unexpected GPU index %q", row[0])
+		}
+		for i, field := range fields {
+			if err := recordValue(cards[index], field, row[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// queryGPU returns the values of the given fields of every GPU.
+func queryGPU(ctx context.Context, fields []string) ([][]string, error) {
+	res, err := utils.ExecCmd(ctx, "nvidia-smi",
+		[]string{"--query-gpu=" + strings.Join(fields, ","), "--format=csv,noheader,nounits"})
+	if err != nil {
+		return nil, execError("nvidia-smi", err, res)
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(res), "\n") {
+		if line == "" {
+			continue
+		}
+		row := strings.Split(line, ",")
+		if len(row) != len(fields) {
+			return nil, fmt.Errorf("unexpected nvidia-smi output: %s", line)
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no GPUs found")
+	}
+
+	return rows, nil
+}
+
+func recordValue(card *GPUConfig, field recordField, value string) error {
+	// Unsupported values are reported as N/A, [N/A] or [Not Supported].
+	if value == "" || strings.Contains(value, "N/A") || strings.Contains(value, "Not Supported") {
+		return nil
+	}
+	if err := field.record(card, value); err != nil {
+		return fmt.Errorf("invalid %s %q: %v", field.name, value, err)
+	}
+	return nil
+}
+
+func recordString(field func(*GPUConfig) **string) func(*GPUConfig, string) error {
+	return func(card *GPUConfig, value string) error {
+		*field(card) = &value
+		return nil
+	}
+}
+
+func recordInt(field func(*GPUConfig) **int) func(*GPUConfig, string) error {
+	return func(card *GPUConfig, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(card) = &i
+		return nil
+	}
+}
+
+func recordBool(field func(*GPUConfig) **bool) func(*GPUConfig, string) error {
+	return func(card *GPUConfig, value string) error {
+		var b bool
+		switch value {
+		case "Yes":
+			b = true
+		case "No":
+		default:
+			return fmt.Errorf("expected Yes or No")
+		}
+		*field(card) = &b
+		return nil
+	}
+}
+
+// recordPCI records the bus and device of a bus id, e.g. 00000000:3B:00.0 as
+// 3b:00.
+func recordPCI(card *GPUConfig, value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected domain:bus:device.function")
+	}
+	device, _, _ := strings.Cut(parts[2], ".")
+	pci := strings.ToLower(parts[1] + ":" + device)
+	card.PCI = &pci
+	return nil
+}
+
+// recordNVLinks records the state of the NVLinks of every GPU from
+// nvidia-smi nvlink -s, e.g.
+//
+//	GPU 0: NVIDIA A100-SXM4-80GB (UUID: GPU-...)
+//		 Link 0: 25 GB/s
+//		 Link 1: <inactive>
+func recordNVLinks(ctx context.Context, cards []*GPUConfig) error {
+	res, err := utils.ExecCmd(ctx, "nvidia-smi", []string{"nvlink", "-s"})
+	if err != nil {
+		return execError("nvidia-smi nvlink", err, res)
+	}
+
+	var card *GPUConfig
+	for _, line := range strings.Split(res, "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "GPU "); ok {
+			index, err := strconv.Atoi(strings.SplitN(rest, ":", 2)[0])
+			if err != nil || index < 0 || index >= len(cards) {
+				return fmt.Errorf("unexpected GPU line: %s", line)
+			}
+			card = cards[index]
+			continue
+		}
+		if card == nil || !strings.HasPrefix(line, "Link ") {
+			continue
+		}
+		card.NVLinkActive = append(card.NVLinkActive, !strings.Contains(line, "inactive"))
+	}
+
+	return nil
+}
+
+// execError returns the error of a failed command with its output, which
+// explains why it failed.
+func execError(name string, err error, output string) error {
+	if output = strings.TrimSpace(output); output != "" {
+		return fmt.Errorf("%s failed: %v: %s", name, err, output)
+	}
+	return fmt.Errorf("%s failed: %v", name, err)
+}
@@ -0,0 +1,145 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// queryCmd returns the nvidia-smi command querying the given fields.
+func queryCmd(fields ...string) string {
+	return "nvidia-smi --query-gpu=" + strings.Join(append([]string{"index"}, fields...), ",") +
+		" --format=csv,noheader,nounits"
+}
+
+func allRecordFields() []string {
+	var names []string
+	for _, field := range recordFields {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+const testNVLinkStatus = `GPU 0: NVIDIA H100 80GB HBM3 (UUID: GPU-a1b2)
+	 Link 0: 26.562 GB/s
+	 Link 1: <inactive>
+GPU 1: NVIDIA H100 80GB HBM3 (UUID: GPU-c3d4)
+	 Link 0: 26.562 GB/s
+	 Link 1: 26.562 GB/s
+`
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		commands  map[string]string
+		anonymize bool
+		want      *MockConfig
+		wantErr   string
+	}{
+		{
+			name: "all fields",
+			commands: map[string]string{
+				queryCmd(): "0\n1\n",
+				queryCmd(allRecordFields()...): "0, NVIDIA H100 80GB HBM3, GPU-a1b2, 00000000:3B:00.0, 5, 8, 16, 0, 2, 3, 0, 0, 0, [N/A], [N/A], [N/A], No, Yes\n" +
+					"1, NVIDIA H100 80GB HBM3, GPU-c3d4, 00000000:86:00.0, 5, 16, 16, 0, 0, 0, 0, 0, 0, [N/A], [N/A], [N/A], No, No\n",
+				"nvidia-smi nvlink -s": testNVLinkStatus,
+			},
+			want: &MockConfig{
+				Version: SupportedConfigVersion,
+				GPUs: &GPUsConfig{
+					CardCount: intPtr(2),
+					Cards: map[int]*GPUConfig{
+						0: {
+							DeviceName:          stringPtr("NVIDIA H100 80GB HBM3"),
+							UUID:                stringPtr("GPU-a1b2"),
+							PCI:                 stringPtr("3b:00"),
+							LinkGen:             intPtr(5),
+							LinkWidthCurrent:    intPtr(8),
+							LinkWidthMax:        intPtr(16),
+							SRAMUE:              intPtr(0),
+							DRAMUE:              intPtr(2),
+							DRAMCE:              intPtr(3),
+							UncorrectableAggL1:  intPtr(0),
+							UncorrectableAggL2:  intPtr(0),
+							UncorrectableAggReg: intPtr(0),
+							RemappingPending:    utils.BoolPtr(false),
+							RemappingFailure:    utils.BoolPtr(true),
+							NVLinkActive:        []bool{true, false},
+						},
+						1: {
+							DeviceName:          stringPtr("NVIDIA H100 80GB HBM3"),
+							UUID:                stringPtr("GPU-c3d4"),
+							PCI:                 stringPtr("86:00"),
+							LinkGen:             intPtr(5),
+							LinkWidthCurrent:    intPtr(16),
+							LinkWidthMax:        intPtr(16),
+							SRAMUE:              intPtr(0),
+							DRAMUE:              intPtr(0),
+							DRAMCE:              intPtr(0),
+							UncorrectableAggL1:  intPtr(0),
+							UncorrectableAggL2:  intPtr(0),
+							UncorrectableAggReg: intPtr(0),
+							RemappingPending:    utils.BoolPtr(false),
+							RemappingFailure:    utils.BoolPtr(false),
+							NVLinkActive:        []bool{true, true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown fields are skipped and uuids anonymized",
+			commands: map[string]string{
+				queryCmd():                        "0\n",
+				queryCmd("name"):                  "0, Tesla V100-SXM2-32GB\n",
+				queryCmd("uuid"):                  "0, GPU-e5f6\n",
+				queryCmd("pci.bus_id"):            "0, 00000000:1A:00.0\n",
+				queryCmd("retired_pages.sbe"):     "0, 1\n",
+				queryCmd("retired_pages.dbe"):     "0, 2\n",
+				queryCmd("retired_pages.pending"): "0, Yes\n",
+				queryCmd("remapped_rows.pending"): "0, [Not Supported]\n",
+			},
+			anonymize: true,
+			want: &MockConfig{
+				Version: SupportedConfigVersion,
+				GPUs: &GPUsConfig{
+					CardCount: intPtr(1),
+					Cards: map[int]*GPUConfig{
+						0: {
+							DeviceName:         stringPtr("Tesla V100-SXM2-32GB"),
+							UUID:               stringPtr("GPU-00000000-0000-0000-0000-000000000000"),
+							PCI:                stringPtr("1a:00"),
+							RetiredPageSBE:     intPtr(1),
+							RetiredPageDBE:     intPtr(2),
+							RetiredPagePending: utils.BoolPtr(true),
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "nvidia-smi fails",
+			commands: map[string]string{},
+			wantErr:  "nvidia-smi failed: command not found: " + queryCmd(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &utils.MockExecCmd{Commands: tt.commands}
+			defer utils.SetExecCmd(mock.Exec)()
+
+			config, err := Record(context.Background(), &RecordOptions{Anonymize: tt.anonymize})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, config)
+		})
+	}
+}
@@ -0,0 +1,335 @@
+// Package scenario runs the diagnosis against named fault scenarios, each a
+// mock config with the results the diagnosis is expected to produce, as a
+// regression suite of the checks without GPUs.
+package scenario
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	// ConfigFile is the mock config of a scenario.
+	ConfigFile = "gpu_mock_conf.toml"
+	// ExpectedFile holds the expected results of a scenario.
+	ExpectedFile = "expected.yaml"
+
+	sysfsPCIDevicesDir = "/sys/bus/pci/devices"
+	sysfsPCIRootDir    = "/sys/devices/pci0000:00"
+	procNVIDIAGPUsDir  = "/proc/driver/nvidia/gpus"
+
+	fakeLSPCI = "#!/bin/sh\necho '00:00.0 3D controller: NVIDIA Corporation Device'\n"
+)
+
+//go:embed scenarios
+var builtin embed.FS
+
+// Builtin returns the scenarios shipped with the tool.
+func Builtin() fs.FS {
+	sub, err := fs.Sub(builtin, "scenarios")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Scenario is a named fault scenario.
+type Scenario struct {
+	Name     string
+	Config   []byte
+	Expected *Expected
+}
+
+// Expected describes the host of a scenario and the results the diagnosis is
+// expected to produce, checks which are not listed are not compared.
+type Expected struct {
+	Description string `yaml:"description"`
+	// CardCount is the expected card count the diagnosis is run with.
+	CardCount int `yaml:"cardCount"`
+	// PCIBusIDs are the GPUs on the PCI bus and known to the driver, which
+	// may differ from the ones nvidia-smi lists.
+	PCIBusIDs []string `yaml:"pciBusIDs"`
+	// Error is a part of the error the diagnosis is expected to fail with.
+	Error string `yaml:"error"`
+	// Results are the expected results of every GPU by UUID, or OVERALL.
+	Results map[diagnose.GPUUID][]ExpectedResult `yaml:"results"`
+}
+
+// ExpectedResult is the expected result of a check.
+type ExpectedResult struct {
+	Name    diagnose.DiagnoseType `yaml:"name"`
+	Healthy bool                  `yaml:"healthy"`
+	// Message is a part of the message of the result.
+	Message string `yaml:"message"`
+}
+
+// Load loads every scenario of the directories in fsys, sorted by name.
+func Load(fsys fs.FS) ([]*Scenario, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var scenarios []*Scenario
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s, err := loadScenario(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("load scenario %s failed: %v", entry.Name(), err)
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios, nil
+}
+
+func loadScenario(fsys fs.FS, name string) (*Scenario, error) {
+	config, err := fs.ReadFile(fsys, path.Join(name, ConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mock.ParseConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ConfigFile, err)
+	}
+
+	data, err := fs.ReadFile(fsys, path.Join(name, ExpectedFile))
+	if err != nil {
+		return nil, err
+	}
+	expected := &Expected{}
+	if err := yaml.Unmarshal(data, expected); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ExpectedFile, err)
+	}
+	if expected.CardCount <= 0 {
+		return nil, fmt.Errorf("invalid %s: cardCount must be positive", ExpectedFile)
+	}
+	known := map[diagnose.DiagnoseType]bool{}
+	for _, t := range diagnose.AllDiagnoseTypes {
+		known[t] = true
+	}
+	for _, results := range expected.Results {
+		for _, res := range results {
+			if !known[res.Name] {
+				return nil, fmt.Errorf("invalid %s: unknown check %q", ExpectedFile, res.Name)
+			}
+		}
+	}
+
+	return &Scenario{
+		Name:     name,
+		Config:   config,
+		Expected: expected,
+	}, nil
+}
+
+// Result is the outcome of a scenario.
+type Result struct {
+	Scenario *Scenario
+	// Failures describe every difference to the expected results.
+	Failures []string
+}
+
+// Passed returns whether the diagnosis produced the expected results.
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Runner runs scenarios, one at a time since the diagnosis reads the process
+// wide file system root and PATH.
+type Runner struct {
+	// NvidiaSMI is the command running the fake nvidia-smi, the arguments
+	// of nvidia-smi are appended.
+	NvidiaSMI []string
+}
+
+// Run runs the diagnosis of the scenario against the fake nvidia-smi and a
+// fake sysfs, and compares its results.
+func (r *Runner) Run(ctx context.Context, s *Scenario) (*Result, error) {
+	if len(r.NvidiaSMI) == 0 {
+		return nil, fmt.Errorf("fake nvidia-smi command is required")
+	}
+
+	dir, err := os.MkdirTemp("", "gpu_mock_scenario")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scenario dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	restore, err := r.setupHost(dir, s)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	controller, err := diagnose.NewController(&diagnose.Config{ExpectedCardCount: s.Expected.CardCount})
+	if err != nil {
+		return nil, err
+	}
+	results, err := controller.Check(ctx)
+
+	return &Result{
+		Scenario: s,
+		Failures: compare(s.Expected, results, err),
+	}, nil
+}
+
+// setupHost writes the fake host of the scenario to dir, and points the
+// process at it until the returned function is called.
+func (r *Runner) setupHost(dir string, s *Scenario) (func(), error) {
+	bin := filepath.Join(dir, "bin")
+	root := filepath.Join(dir, "root")
+	confPath := filepath.Join(dir, ConfigFile)
+
+	quoted := make([]string, 0, len(r.NvidiaSMI))
+	for _, arg := range r.NvidiaSMI {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	files := map[string]string{
+		filepath.Join(bin, "nvidia-smi"): fmt.Sprintf("#!/bin/sh\nexec %s \"$@\"\n", strings.Join(quoted, " ")),
+		filepath.Join(bin, "lspci"):      fakeLSPCI,
+		confPath:                         string(s.Config),
+	}
+	for _, busID := range s.Expected.PCIBusIDs {
+		devDir := filepath.Join(root, sysfsPCIRootDir, busID)
+		files[filepath.Join(devDir, "vendor")] = "0x10de\n"
+		files[filepath.Join(devDir, "class")] = "0x030200\n"
+		if err := os.MkdirAll(filepath.Join(root, procNVIDIAGPUsDir, busID), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create driver gpu dir: %v", err)
+		}
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create dir: %v", err)
+		}
+		mode := os.FileMode(0644)
+		if filepath.Dir(name) == bin {
+			mode = 0755
+		}
+		if err := os.WriteFile(name, []byte(content), mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, sysfsPCIDevicesDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create pci devices dir: %v", err)
+	}
+	for _, busID := range s.Expected.PCIBusIDs {
+		target := filepath.Join("..", "..", "..", "devices", "pci0000:00", busID)
+		if err := os.Symlink(target, filepath.Join(root, sysfsPCIDevicesDir, busID)); err != nil {
+			return nil, fmt.Errorf("failed to link pci device: %v", err)
+		}
+	}
+
+	restoreEnv := setenv(map[string]string{
+		"PATH":           bin + string(os.PathListSeparator) + os.Getenv("PATH"),
+		mock.EnvConfPath: confPath,
+	})
+	restoreRoot := utils.SetFSRoot(root)
+
+	return func() {
+		restoreRoot()
+		restoreEnv()
+	}, nil
+}
+
+// setenv sets the environment variables and returns a function restoring them.
+func setenv(env map[string]string) func() {
+	original := map[string]*string{}
+	for key, value := range env {
+		if old, ok := os.LookupEnv(key); ok {
+			original[key] = &old
+		} else {
+			original[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+
+	return func() {
+		for key, value := range original {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// compare returns the differences of the results and error of the diagnosis to
+// the expected ones.
+func compare(expected *Expected, results map[diagnose.GPUUID][]*diagnose.DiagnoseResult, err error) []string {
+	var failures []string
+	if err != nil {
+		if expected.Error == "" {
+			return []string{fmt.Sprintf("diagnosis failed: %v", err)}
+		}
+		if !strings.Contains(err.Error(), expected.Error) {
+			failures = append(failures, fmt.Sprintf("error %q does not contain %q", err, expected.Error))
+		}
+		return failures
+	}
+	if expected.Error != "" {
+		return []string{fmt.Sprintf("diagnosis succeeded, expected error %q", expected.Error)}
+	}
+
+	gpuIDs := make([]string, 0, len(expected.Results))
+	for gpuID := range expected.Results {
+		gpuIDs = append(gpuIDs, string(gpuID))
+	}
+	sort.Strings(gpuIDs)
+
+	for _, gpuID := range gpuIDs {
+		for _, want := range expected.Results[diagnose.GPUUID(gpuID)] {
+			got := findResult(results[diagnose.GPUUID(gpuID)], want.Name)
+			switch {
+			case got == nil:
+				failures = append(failures, fmt.Sprintf("%s %s: no result", gpuID, want.Name))
+			case got.IsHealthy == nil || *got.IsHealthy != want.Healthy:
+				failures = append(failures, fmt.Sprintf("%s %s: healthy is %s, expected %t: %s",
+					gpuID, want.Name, formatHealthy(got.IsHealthy), want.Healthy, got.Message))
+			case !strings.Contains(got.Message, want.Message):
+				failures = append(failures, fmt.Sprintf("%s %s: message %q does not contain %q",
+					gpuID, want.Name, got.Message, want.Message))
+			}
+		}
+	}
+
+	return failures
+}
+
+func findResult(results []*diagnose.DiagnoseResult, name diagnose.DiagnoseType) *diagnose.DiagnoseResult {
+	for _, res := range results {
+		if res.Name == name {
+			return res
+		}
+	}
+	return nil
+}
+
+func formatHealthy(healthy *bool) string {
+	if healthy == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%t", *healthy)
+}
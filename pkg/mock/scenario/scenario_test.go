@@ -0,0 +1,198 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/mock/fakesmi"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// TestMain runs the test binary as the fake nvidia-smi when it is invoked
+// through the nvidia-smi link of testRunner.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "nvidia-smi" {
+		os.Exit(fakesmi.Main(os.Args[1:], os.Stdout, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+func testRunner(t *testing.T) *Runner {
+	t.Helper()
+
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	link := filepath.Join(t.TempDir(), "nvidia-smi")
+	assert.NoError(t, os.Symlink(exe, link))
+
+	return &Runner{NvidiaSMI: []string{link}}
+}
+
+func TestBuiltinScenarios(t *testing.T) {
+	scenarios, err := Load(Builtin())
+	assert.NoError(t, err)
+
+	var names []string
+	for _, s := range scenarios {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"dbe-retired-pages", "gpu-missing", "healthy", "link-width-x8", "nvml-init-fails", "remap-pending"}, names)
+
+	runner := testRunner(t)
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			res, err := runner.Run(context.Background(), s)
+			assert.NoError(t, err)
+			assert.True(t, res.Passed(), "failures: %v", res.Failures)
+		})
+	}
+}
+
+func TestRunRestoresEnvironment(t *testing.T) {
+	scenarios, err := Load(Builtin())
+	assert.NoError(t, err)
+	path := os.Getenv("PATH")
+
+	_, err = testRunner(t).Run(context.Background(), scenarios[0])
+	assert.NoError(t, err)
+	assert.Equal(t, path, os.Getenv("PATH"))
+	assert.Equal(t, "/sys", utils.HostPath("/sys"))
+}
+
+func TestLoad(t *testing.T) {
+	config := &fstest.MapFile{Data: []byte("version = \"0.1.0\"\n")}
+
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "valid",
+			fsys: fstest.MapFS{
+				"a/gpu_mock_conf.toml": config,
+				"a/expected.yaml":      {Data: []byte("cardCount: 1\nresults:\n  OVERALL:\n    - name: gpu_driver_status\n      healthy: true\n")},
+				"README.md":            {Data: []byte("not a scenario")},
+			},
+		},
+		{
+			name: "invalid config",
+			fsys: fstest.MapFS{
+				"a/gpu_mock_conf.toml": {Data: []byte("[gpus.0]\ndram_eu = 1\n")},
+				"a/expected.yaml":      {Data: []byte("cardCount: 1\n")},
+			},
+			wantErr: "load scenario a failed: invalid gpu_mock_conf.toml: line 2: gpus.0.dram_eu: unknown key",
+		},
+		{
+			name: "missing expected results",
+			fsys: fstest.MapFS{
+				"a/gpu_mock_conf.toml": config,
+			},
+			wantErr: "load scenario a failed: open a/expected.yaml: file does not exist",
+		},
+		{
+			name: "missing card count",
+			fsys: fstest.MapFS{
+				"a/gpu_mock_conf.toml": config,
+				"a/expected.yaml":      {Data: []byte("results: {}\n")},
+			},
+			wantErr: "load scenario a failed: invalid expected.yaml: cardCount must be positive",
+		},
+		{
+			name: "unknown check",
+			fsys: fstest.MapFS{
+				"a/gpu_mock_conf.toml": config,
+				"a/expected.yaml":      {Data: []byte("cardCount: 1\nresults:\n  OVERALL:\n    - name: gpu_driver\n")},
+			},
+			wantErr: `load scenario a failed: invalid expected.yaml: unknown check "gpu_driver"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenarios, err := Load(tt.fsys)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, scenarios, 1)
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	results := map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+		diagnose.GPUUUIDOverall: {
+			{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true), Message: "GPU Driver is loaded successfully"},
+		},
+		"GPU-0": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(false), Message: "Link is not OK"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		expected     *Expected
+		err          error
+		wantFailures []string
+	}{
+		{
+			name: "match",
+			expected: &Expected{Results: map[diagnose.GPUUID][]ExpectedResult{
+				diagnose.GPUUUIDOverall: {{Name: diagnose.DiagnoseGPUDriverStatus, Healthy: true, Message: "loaded"}},
+				"GPU-0":                 {{Name: diagnose.DiagnoseGPULinkStatus, Healthy: false}},
+			}},
+		},
+		{
+			name: "mismatches",
+			expected: &Expected{Results: map[diagnose.GPUUID][]ExpectedResult{
+				diagnose.GPUUUIDOverall: {{Name: diagnose.DiagnoseGPUDriverStatus, Healthy: true, Message: "failed"}},
+				"GPU-0": {
+					{Name: diagnose.DiagnoseGPULinkStatus, Healthy: true},
+					{Name: diagnose.DiagnoseGPUPCIeAERErrors, Healthy: true},
+				},
+			}},
+			wantFailures: []string{
+				`GPU-0 gpu_link_status: healthy is false, expected true: Link is not OK`,
+				`GPU-0 gpu_pcie_aer_errors: no result`,
+				`OVERALL gpu_driver_status: message "GPU Driver is loaded successfully" does not contain "failed"`,
+			},
+		},
+		{
+			name:     "expected error",
+			expected: &Expected{Error: "card count mismatch"},
+			err:      errors.New("GPU card count mismatch: got 1, expected 2"),
+		},
+		{
+			name:         "unexpected error",
+			expected:     &Expected{},
+			err:          errors.New("exit status 9"),
+			wantFailures: []string{"diagnosis failed: exit status 9"},
+		},
+		{
+			name:         "different error",
+			expected:     &Expected{Error: "card count mismatch"},
+			err:          errors.New("exit status 9"),
+			wantFailures: []string{`error "exit status 9" does not contain "card count mismatch"`},
+		},
+		{
+			name:         "missing error",
+			expected:     &Expected{Error: "card count mismatch"},
+			wantFailures: []string{`diagnosis succeeded, expected error "card count mismatch"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantFailures, compare(tt.expected, results, tt.err))
+		})
+	}
+}
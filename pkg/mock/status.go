@@ -0,0 +1,254 @@
+package mock
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+const (
+	// DefaultGPUMockDir is where the injection library looks for its config
+	// when GPU_MOCK_CONF_PATH is not set, and writes its log.
+	DefaultGPUMockDir = "/opt/gpu_mock"
+	// LogName is the log file of the injection library, in the directory of
+	// GPU_MOCK_CONF_PATH or DefaultGPUMockDir.
+	LogName = "log"
+
+	procDir = "/proc"
+)
+
+// Status is the state of the mock injection on the host.
+type Status struct {
+	// Preloaded are the entries of the injection library in the preload file,
+	// which inject every process on the host.
+	Preloaded []string
+	// Journal is the recovery journal of the global mock environment, nil if
+	// there is none.
+	Journal *Journal
+	// JournalAlive is whether the process which wrote the journal is running.
+	JournalAlive bool
+	// Processes are the processes the library is injected into through
+	// LD_PRELOAD.
+	Processes []*InjectedProcess
+}
+
+// InjectedProcess is a process the library is injected into through its
+// environment.
+type InjectedProcess struct {
+	PID     int
+	Command string
+	// ConfigPath is the GPU_MOCK_CONF_PATH of the process, empty if not set.
+	ConfigPath string
+}
+
+// Active returns whether the library is injected into any process.
+func (s *Status) Active() bool {
+	return len(s.Preloaded) > 0 || len(s.Processes) > 0
+}
+
+// ConfigPaths returns the configs read by the injected processes, the config
+// of the global mock environment first.
+func (s *Status) ConfigPaths() []string {
+	var paths []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	if len(s.Preloaded) > 0 {
+		// Processes without GPU_MOCK_CONF_PATH read the default config.
+		if _, err := utils.Stat(filepath.Join(DefaultGPUMockDir, confName)); err == nil {
+			add(filepath.Join(DefaultGPUMockDir, confName))
+		} else if s.Journal != nil {
+			add(filepath.Join(s.Journal.GPUMockDir, confName))
+		}
+	}
+	for _, p := range s.Processes {
+		add(p.ConfigPath)
+	}
+
+	return paths
+}
+
+// LogDirs returns the directories the injected processes write the log of the
+// library to, the one of the global mock environment first.
+func (s *Status) LogDirs() []string {
+	var dirs []string
+	seen := map[string]bool{}
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if len(s.Preloaded) > 0 {
+		add(DefaultGPUMockDir)
+	}
+	for _, p := range s.Processes {
+		if p.ConfigPath == "" {
+			add(DefaultGPUMockDir)
+		} else {
+			add(filepath.Dir(p.ConfigPath))
+		}
+	}
+
+	return dirs
+}
+
+// ReadStatus returns the state of the mock injection from the preload file,
+// the recovery journal and the environment of the running processes. Processes
+// whose environment cannot be read, e.g. without root, are skipped.
+func ReadStatus(journalFile, ldPreloadFile string) (*Status, error) {
+	status := &Status{}
+
+	content, err := utils.ReadFile(ldPreloadFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read preload file: %v", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if entry := strings.TrimSpace(scanner.Text()); filepath.Base(entry) == libName {
+			status.Preloaded = append(status.Preloaded, entry)
+		}
+	}
+
+	status.Journal, err = ReadJournal(journalFile)
+	if err != nil {
+		return nil, err
+	}
+	if status.Journal != nil {
+		status.JournalAlive = status.Journal.Alive()
+	}
+
+	status.Processes, err = injectedProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// injectedProcesses returns the processes with the library in LD_PRELOAD,
+// ordered by pid.
+func injectedProcesses() ([]*InjectedProcess, error) {
+	entries, err := utils.ReadDir(procDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	var processes []*InjectedProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		environ, err := utils.ReadFile(filepath.Join(procDir, entry.Name(), "environ"))
+		if err != nil {
+			continue
+		}
+
+		p := &InjectedProcess{PID: pid}
+		injected := false
+		for _, env := range strings.Split(string(environ), "\x00") {
+			key, value, _ := strings.Cut(env, "=")
+			switch key {
+			case EnvLDPreload:
+				for _, lib := range strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ' ' }) {
+					injected = injected || filepath.Base(lib) == libName
+				}
+			case EnvConfPath:
+				p.ConfigPath = value
+			}
+		}
+		if !injected {
+			continue
+		}
+		if comm, err := utils.ReadFile(filepath.Join(procDir, entry.Name(), "comm")); err == nil {
+			p.Command = strings.TrimSpace(string(comm))
+		}
+		processes = append(processes, p)
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].PID < processes[j].PID
+	})
+	return processes, nil
+}
+
+// GPUValues returns the value of every GPU config key, in the order of
+// GPUConfig, for the cards the injection library reports, card_count or the
+// highest configured index plus one. Keys which are not injected are empty, the
+// device reports its own value for them.
+func GPUValues(config *MockConfig) (keys []string, cards [][]string) {
+	typ := reflect.TypeOf(GPUConfig{})
+	for i := 0; i < typ.NumField(); i++ {
+		key, _, _ := strings.Cut(typ.Field(i).Tag.Get("toml"), ",")
+		keys = append(keys, key)
+	}
+
+	if config.GPUs == nil {
+		return keys, nil
+	}
+	count := 0
+	for index := range config.GPUs.Cards {
+		count = max(count, index+1)
+	}
+	if config.GPUs.CardCount != nil {
+		count = *config.GPUs.CardCount
+	}
+
+	for index := 0; index < count; index++ {
+		values := make([]string, len(keys))
+		if card := config.GPUs.Cards[index]; card != nil {
+			value := reflect.ValueOf(card).Elem()
+			for i := range keys {
+				values[i] = formatValue(value.Field(i))
+			}
+		}
+		cards = append(cards, values)
+	}
+
+	return keys, cards
+}
+
+// formatValue formats a pointer or slice field, empty if it is not set.
+func formatValue(value reflect.Value) string {
+	if value.IsNil() {
+		return ""
+	}
+	if value.Kind() == reflect.Ptr {
+		return fmt.Sprint(value.Elem().Interface())
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// ReadLog returns up to the given number of last lines of the log of the
+// injection library in dir, which is written when it fails to load its config
+// or the original library.
+func ReadLog(dir string, lines int) ([]string, error) {
+	data, err := utils.ReadFile(filepath.Join(dir, LogName))
+	if err != nil {
+		return nil, err
+	}
+
+	all := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(all) == 1 && all[0] == "" {
+		return nil, nil
+	}
+	if lines >= 0 && len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return all, nil
+}
@@ -0,0 +1,233 @@
+package mock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func TestReadStatus(t *testing.T) {
+	defaultConf := filepath.Join(testMockDir, confName)
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		preload string
+		journal *Journal
+		// environs are the environments of processes by pid.
+		environs        map[int]string
+		defaultConf     bool
+		wantActive      bool
+		wantPreloaded   []string
+		wantAlive       bool
+		wantProcesses   []*InjectedProcess
+		wantConfigPaths []string
+		wantLogDirs     []string
+	}{
+		{
+			name:     "inactive",
+			preload:  "/usr/lib/libother.so\n",
+			environs: map[int]string{1: "PATH=/usr/bin\x00HOME=/root\x00"},
+		},
+		{
+			name:    "global",
+			preload: "/usr/lib/libother.so\n/opt/gpu_mock/nvml_injectiond.so\n",
+			journal: &Journal{
+				PID:        os.Getpid(),
+				BootID:     testBootID,
+				Time:       started,
+				GPUMockDir: testMockDir,
+			},
+			defaultConf:     true,
+			wantActive:      true,
+			wantPreloaded:   []string{"/opt/gpu_mock/nvml_injectiond.so"},
+			wantAlive:       true,
+			wantConfigPaths: []string{defaultConf},
+			wantLogDirs:     []string{DefaultGPUMockDir},
+		},
+		{
+			name:    "global of previous boot",
+			preload: "/opt/gpu_mock/nvml_injectiond.so\n",
+			journal: &Journal{
+				PID:        os.Getpid(),
+				BootID:     "boot-0",
+				Time:       started,
+				GPUMockDir: "/var/tmp/gpu_mock",
+			},
+			wantActive:      true,
+			wantPreloaded:   []string{"/opt/gpu_mock/nvml_injectiond.so"},
+			wantConfigPaths: []string{"/var/tmp/gpu_mock/gpu_mock_conf.toml"},
+			wantLogDirs:     []string{DefaultGPUMockDir},
+		},
+		{
+			name: "processes",
+			environs: map[int]string{
+				1:   "PATH=/usr/bin\x00",
+				42:  "LD_PRELOAD=/tmp/gpu_mock1/nvml_injectiond.so:/usr/lib/libother.so\x00GPU_MOCK_CONF_PATH=/tmp/gpu_mock1/gpu_mock_conf.toml\x00",
+				7:   "GPU_MOCK_CONF_PATH=/tmp/gpu_mock2/gpu_mock_conf.toml\x00LD_PRELOAD=/tmp/gpu_mock2/nvml_injectiond.so\x00",
+				100: "LD_PRELOAD=/tmp/gpu_mock1/nvml_injectiond.so\x00GPU_MOCK_CONF_PATH=/tmp/gpu_mock1/gpu_mock_conf.toml\x00",
+			},
+			wantActive: true,
+			wantProcesses: []*InjectedProcess{
+				{PID: 7, Command: "cmd7", ConfigPath: "/tmp/gpu_mock2/gpu_mock_conf.toml"},
+				{PID: 42, Command: "cmd42", ConfigPath: "/tmp/gpu_mock1/gpu_mock_conf.toml"},
+				{PID: 100, Command: "cmd100", ConfigPath: "/tmp/gpu_mock1/gpu_mock_conf.toml"},
+			},
+			wantConfigPaths: []string{"/tmp/gpu_mock2/gpu_mock_conf.toml", "/tmp/gpu_mock1/gpu_mock_conf.toml"},
+			wantLogDirs:     []string{"/tmp/gpu_mock2", "/tmp/gpu_mock1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			defer utils.SetFSRoot(root)()
+			writeTestFile(t, root, bootIDFile, testBootID+"\n")
+			if tt.preload != "" {
+				writeTestFile(t, root, testPreloadFile, tt.preload)
+			}
+			if tt.journal != nil {
+				tt.journal.Checksum = checksum(tt.journal.OriginalContent)
+				data, err := json.Marshal(tt.journal)
+				assert.NoError(t, err)
+				writeTestFile(t, root, testJournalFile, string(data))
+			}
+			if tt.defaultConf {
+				writeTestFile(t, root, defaultConf, testConfig)
+			}
+			for pid, environ := range tt.environs {
+				dir := filepath.Join(procDir, strconv.Itoa(pid))
+				writeTestFile(t, root, filepath.Join(dir, "environ"), environ)
+				writeTestFile(t, root, filepath.Join(dir, "comm"), "cmd"+strconv.Itoa(pid)+"\n")
+			}
+
+			status, err := ReadStatus(testJournalFile, testPreloadFile)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantActive, status.Active())
+			assert.Equal(t, tt.wantPreloaded, status.Preloaded)
+			if tt.journal != nil {
+				assert.Equal(t, started, status.Journal.Time.UTC())
+			} else {
+				assert.Nil(t, status.Journal)
+			}
+			assert.Equal(t, tt.wantAlive, status.JournalAlive)
+			assert.Equal(t, tt.wantProcesses, status.Processes)
+			assert.Equal(t, tt.wantConfigPaths, status.ConfigPaths())
+			assert.Equal(t, tt.wantLogDirs, status.LogDirs())
+		})
+	}
+}
+
+func TestGPUValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantCards []map[string]string
+	}{
+		{
+			name: "no gpus",
+			data: `version = "0.1.0"`,
+		},
+		{
+			name: "card count",
+			data: `version = "0.1.0"
+[gpus]
+card_count = 2
+[gpus.1]
+link_width_current = 8
+nvlink_active = [true, false]
+`,
+			wantCards: []map[string]string{
+				{},
+				{"link_width_current": "8", "nvlink_active": "[true false]"},
+			},
+		},
+		{
+			name: "highest configured index",
+			data: `version = "0.1.0"
+[gpus.2]
+device_name = "A800"
+`,
+			wantCards: []map[string]string{
+				{},
+				{},
+				{"device_name": "A800"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.data))
+			assert.NoError(t, err)
+
+			keys, cards := GPUValues(config)
+			assert.Equal(t, "device_name", keys[0])
+			assert.Equal(t, "crictl_xid", keys[len(keys)-1])
+			assert.Len(t, cards, len(tt.wantCards))
+			for index, want := range tt.wantCards {
+				for i, key := range keys {
+					assert.Equal(t, want[key], cards[index][i], "%s of GPU%d", key, index)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string
+		lines   int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "no log",
+			lines:   10,
+			wantErr: true,
+		},
+		{
+			name:    "empty log",
+			content: strPtr(""),
+			lines:   10,
+		},
+		{
+			name:    "last lines",
+			content: strPtr("failed to find gpu_mock_conf.toml\nline 2\nline 3\n"),
+			lines:   2,
+			want:    []string{"line 2", "line 3"},
+		},
+		{
+			name:    "all lines",
+			content: strPtr("line 1\nline 2\n"),
+			lines:   -1,
+			want:    []string{"line 1", "line 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			defer utils.SetFSRoot(root)()
+			if tt.content != nil {
+				writeTestFile(t, root, filepath.Join(testMockDir, LogName), *tt.content)
+			}
+
+			lines, err := ReadLog(testMockDir, tt.lines)
+			if tt.wantErr {
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, lines)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// rampInterval is how often the config is rendered while a value is ramped.
+const rampInterval = time.Second
+
+// Timeline renders the config read by the injection library at offsets from the
+// start of the mock environment, the static config with the timeline events
+// applied in order.
+type Timeline struct {
+	base   map[string]interface{}
+	events []*TimelineEvent
+}
+
+// NewTimeline validates the mock config and returns its timeline.
+func NewTimeline(data []byte) (*Timeline, error) {
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var base map[string]interface{}
+	if _, err := toml.Decode(string(data), &base); err != nil {
+		return nil, err
+	}
+	delete(base, "timeline")
+
+	return &Timeline{
+		base:   base,
+		events: config.Timeline,
+	}, nil
+}
+
+// Static returns whether the config does not change over time.
+func (t *Timeline) Static() bool {
+	return len(t.events) == 0
+}
+
+// Render returns the config at the given offset from the start.
+func (t *Timeline) Render(elapsed time.Duration) ([]byte, error) {
+	config := deepCopy(t.base).(map[string]interface{})
+	for _, event := range t.events {
+		event.apply(config, elapsed)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(config); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Next returns the next offset after the given one at which the rendered config
+// changes, false if it does not change anymore.
+func (t *Timeline) Next(elapsed time.Duration) (time.Duration, bool) {
+	var next time.Duration
+	found := false
+	for _, event := range t.events {
+		if n, ok := event.next(elapsed); ok && (!found || n < next) {
+			next = n
+			found = true
+		}
+	}
+	return next, found
+}
+
+// offset returns the time since the event last started, false before it first
+// started.
+func (e *TimelineEvent) offset(elapsed time.Duration) (time.Duration, bool) {
+	if elapsed < e.At {
+		return 0, false
+	}
+	offset := elapsed - e.At
+	if e.Every != nil {
+		offset %= *e.Every
+	}
+	return offset, true
+}
+
+// duration returns how long the event lasts, false if it does not end.
+func (e *TimelineEvent) duration() (time.Duration, bool) {
+	if e.Until == nil {
+		return 0, false
+	}
+	return *e.Until - e.At, true
+}
+
+// apply sets the values of the event at the given offset in the raw config.
+func (e *TimelineEvent) apply(config map[string]interface{}, elapsed time.Duration) {
+	offset, started := e.offset(elapsed)
+	if !started {
+		return
+	}
+	duration, ends := e.duration()
+
+	values := map[string]interface{}{}
+	if !ends || offset < duration {
+		for key, value := range e.Set {
+			values[key] = deepCopy(value)
+		}
+	}
+	for key, ramp := range e.Ramp {
+		value := ramp[1]
+		if offset < duration {
+			value = ramp[0] + int(float64(ramp[1]-ramp[0])*float64(offset)/float64(duration))
+		}
+		values[key] = int64(value)
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	table := subTable(config, "gpus")
+	if e.GPU != nil {
+		table = subTable(table, strconv.Itoa(*e.GPU))
+	}
+	for key, value := range values {
+		table[key] = value
+	}
+}
+
+// next returns the next offset after the given one at which the event changes
+// the config.
+func (e *TimelineEvent) next(elapsed time.Duration) (time.Duration, bool) {
+	if elapsed < e.At {
+		return e.At, true
+	}
+
+	start := e.At
+	if e.Every != nil {
+		start += (elapsed - e.At) / *e.Every * *e.Every
+	}
+	duration, ends := e.duration()
+	if !ends {
+		return 0, false
+	}
+
+	end := start + duration
+	if elapsed < end {
+		if len(e.Ramp) > 0 && elapsed+rampInterval < end {
+			return elapsed + rampInterval, true
+		}
+		return end, true
+	}
+	if e.Every != nil {
+		return start + *e.Every, true
+	}
+	return 0, false
+}
+
+// subTable returns the table of the key, which is created if it does not exist.
+func subTable(table map[string]interface{}, key string) map[string]interface{} {
+	sub, ok := table[key].(map[string]interface{})
+	if !ok {
+		sub = map[string]interface{}{}
+		table[key] = sub
+	}
+	return sub
+}
+
+// deepCopy copies the tables and arrays of a decoded TOML value.
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			res[key] = deepCopy(elem)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, elem := range v {
+			res[i] = deepCopy(elem)
+		}
+		return res
+	}
+	return value
+}
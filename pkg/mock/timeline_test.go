@@ -0,0 +1,175 @@
+package mock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimelineConfig = `version = "0.1.0"
+[gpus]
+card_count = 2
+[gpus.0]
+dram_ce = 5
+
+# ECC errors grow.
+[[timeline]]
+gpu = 0
+at = "10s"
+until = "20s"
+ramp = { dram_ce = [0, 100] }
+
+# The link flaps.
+[[timeline]]
+gpu = 1
+at = "5s"
+until = "7s"
+every = "10s"
+set = { link_width_current = 8 }
+
+# An XID appears.
+[[timeline]]
+gpu = 1
+at = "30s"
+set = { crictl_xid = [79] }
+`
+
+func TestTimelineRender(t *testing.T) {
+	timeline, err := NewTimeline([]byte(testTimelineConfig))
+	assert.NoError(t, err)
+	assert.False(t, timeline.Static())
+
+	tests := []struct {
+		name              string
+		elapsed           time.Duration
+		wantDRAMCE        *int
+		wantLinkWidth     *int
+		wantCrictlXID     []int
+		wantGPU1Untouched bool
+	}{
+		{
+			name:              "start",
+			elapsed:           0,
+			wantDRAMCE:        intPtr(5),
+			wantGPU1Untouched: true,
+		},
+		{
+			name:          "link down",
+			elapsed:       6 * time.Second,
+			wantDRAMCE:    intPtr(5),
+			wantLinkWidth: intPtr(8),
+		},
+		{
+			name:              "link up again",
+			elapsed:           7 * time.Second,
+			wantDRAMCE:        intPtr(5),
+			wantGPU1Untouched: true,
+		},
+		{
+			name:          "ramp and link down again",
+			elapsed:       15 * time.Second,
+			wantDRAMCE:    intPtr(50),
+			wantLinkWidth: intPtr(8),
+		},
+		{
+			name:              "ramp holds its end",
+			elapsed:           20 * time.Second,
+			wantDRAMCE:        intPtr(100),
+			wantGPU1Untouched: true,
+		},
+		{
+			name:          "xid",
+			elapsed:       30 * time.Second,
+			wantDRAMCE:    intPtr(100),
+			wantCrictlXID: []int{79},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := timeline.Render(tt.elapsed)
+			assert.NoError(t, err)
+			config, err := ParseConfig(data)
+			assert.NoError(t, err)
+
+			assert.Empty(t, config.Timeline)
+			assert.Equal(t, 2, *config.GPUs.CardCount)
+			assert.Equal(t, tt.wantDRAMCE, config.GPUs.Cards[0].DRAMCE)
+			if tt.wantGPU1Untouched {
+				assert.Nil(t, config.GPUs.Cards[1])
+				return
+			}
+			assert.Equal(t, tt.wantLinkWidth, config.GPUs.Cards[1].LinkWidthCurrent)
+			assert.Equal(t, tt.wantCrictlXID, config.GPUs.Cards[1].CrictlXID)
+		})
+	}
+}
+
+func TestTimelineNext(t *testing.T) {
+	timeline, err := NewTimeline([]byte(testTimelineConfig))
+	assert.NoError(t, err)
+
+	var got []time.Duration
+	var elapsed time.Duration
+	for {
+		next, ok := timeline.Next(elapsed)
+		if !ok || next > 36*time.Second {
+			break
+		}
+		got = append(got, next)
+		elapsed = next
+	}
+
+	want := []time.Duration{5 * time.Second, 7 * time.Second, 10 * time.Second}
+	for s := 11; s <= 20; s++ {
+		want = append(want, time.Duration(s)*time.Second)
+	}
+	want = append(want, 25*time.Second, 27*time.Second, 30*time.Second, 35*time.Second)
+	// The link flaps at 15s and 17s during the ramp.
+	assert.Equal(t, want, got)
+}
+
+func TestTimelineStatic(t *testing.T) {
+	timeline, err := NewTimeline([]byte(testConfig))
+	assert.NoError(t, err)
+	assert.True(t, timeline.Static())
+	_, ok := timeline.Next(0)
+	assert.False(t, ok)
+}
+
+func TestControllerAppliesTimeline(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.toml")
+	config := `version = "0.1.0"
+[gpus.0]
+dram_ue = 1
+
+[[timeline]]
+gpu = 0
+at = "100ms"
+set = { dram_ue = 2 }
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+
+	controller, err := NewController(&Config{ConfigPath: configPath})
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Start())
+	defer controller.Stop()
+
+	mockConfigPath := filepath.Join(filepath.Dir(controller.tempLibPath), confName)
+	mockConfig, err := LoadConfig(mockConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *mockConfig.GPUs.Cards[0].DRAMUE)
+
+	assert.Eventually(t, func() bool {
+		mockConfig, err := LoadConfig(mockConfigPath)
+		return err == nil && *mockConfig.GPUs.Cards[0].DRAMUE == 2
+	}, 5*time.Second, 20*time.Millisecond)
+
+	assert.NoError(t, controller.Stop())
+	_, err = os.Stat(mockConfigPath)
+	assert.True(t, os.IsNotExist(err), "mock config should be removed")
+}
@@ -0,0 +1,293 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+)
+
+type Config struct {
+	Diagnoser diagnose.Diagnoser
+	// Interval is the time between the end of a run and the start of the next.
+	Interval time.Duration
+	// Jitter is the maximum random duration added to every interval, so that
+	// nodes do not run diagnoses in lockstep.
+	Jitter time.Duration
+	// Timeout bounds the duration of a single run.
+	Timeout time.Duration
+}
+
+// Run is the outcome of a single diagnosis run.
+type Run struct {
+	Time     time.Time
+	Duration time.Duration
+	Results  map[diagnose.GPUUID][]*diagnose.DiagnoseResult
+	// Snapshot is nil if the Diagnoser does not implement diagnose.Snapshotter.
+	Snapshot *diagnose.Snapshot
+	Err      error
+}
+
+// CheckDiagnosis is the check of the diagnosis run itself, which is unhealthy
+// while the diagnosis fails.
+const CheckDiagnosis diagnose.DiagnoseType = "diagnosis"
+
+// Event is a health transition of a check of a GPU.
+type Event struct {
+	Time  time.Time             `json:"time"`
+	GPU   diagnose.GPUUID       `json:"gpu"`
+	Check diagnose.DiagnoseType `json:"check"`
+	// Previous is nil the first time the check is seen.
+	Previous *bool  `json:"previous,omitempty"`
+	Healthy  bool   `json:"healthy"`
+	Message  string `json:"message"`
+}
+
+// EventHandler is notified of every health transition.
+type EventHandler func(context.Context, *Event)
+
+// RunHandler is notified after every run.
+type RunHandler func(context.Context, *Run)
+
+type stateKey struct {
+	GPU   diagnose.GPUUID
+	Check diagnose.DiagnoseType
+}
+
+// Monitor runs a Diagnoser periodically, keeps the latest results and detects
+// health transitions per GPU per check.
+type Monitor struct {
+	config *Config
+
+	// runMu serializes runs, the Diagnoser is not safe for concurrent use.
+	runMu sync.Mutex
+
+	mu            sync.RWMutex
+	latest        *Run
+	states        map[stateKey]bool
+	eventHandlers []EventHandler
+	runHandlers   []RunHandler
+}
+
+func NewMonitor(config *Config) (*Monitor, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if config.Diagnoser == nil {
+		return nil, fmt.Errorf("diagnoser is required")
+	}
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", config.Interval)
+	}
+	if config.Jitter < 0 {
+		return nil, fmt.Errorf("jitter must not be negative, got %s", config.Jitter)
+	}
+	if config.Timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive, got %s", config.Timeout)
+	}
+
+	return &Monitor{
+		config: config,
+		states: make(map[stateKey]bool),
+	}, nil
+}
+
+// AddEventHandler registers a handler for health transitions.
+func (m *Monitor) AddEventHandler(handler EventHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventHandlers = append(m.eventHandlers, handler)
+}
+
+// AddRunHandler registers a handler for the outcome of every run.
+func (m *Monitor) AddRunHandler(handler RunHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runHandlers = append(m.runHandlers, handler)
+}
+
+// Start runs the diagnosis immediately and then on every interval until the
+// context is cancelled.
+func (m *Monitor) Start(ctx context.Context) error {
+	for {
+		m.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(m.nextInterval()):
+		}
+	}
+}
+
+// RunOnce runs the diagnosis, records the results and notifies the handlers
+// of the run and of every health transition.
+func (m *Monitor) RunOnce(ctx context.Context) *Run {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	return m.runLocked(ctx)
+}
+
+// TryRunOnce is like RunOnce, but returns false without running if another
+// run is in progress.
+func (m *Monitor) TryRunOnce(ctx context.Context) (*Run, bool) {
+	if !m.runMu.TryLock() {
+		return nil, false
+	}
+	defer m.runMu.Unlock()
+
+	return m.runLocked(ctx), true
+}
+
+func (m *Monitor) runLocked(ctx context.Context) *Run {
+	runCtx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	run := Diagnose(runCtx, m.config.Diagnoser)
+	if run.Err != nil {
+		klog.ErrorS(run.Err, "Diagnose failed")
+	}
+
+	m.mu.Lock()
+	m.latest = run
+	events := m.detectTransitions(run)
+	eventHandlers := append([]EventHandler(nil), m.eventHandlers...)
+	runHandlers := append([]RunHandler(nil), m.runHandlers...)
+	m.mu.Unlock()
+
+	for _, handler := range runHandlers {
+		handler(ctx, run)
+	}
+	for _, event := range events {
+		for _, handler := range eventHandlers {
+			handler(ctx, event)
+		}
+	}
+
+	return run
+}
+
+// Diagnose runs the diagnosis once and returns its outcome, including the
+// device snapshot if the Diagnoser implements diagnose.Snapshotter.
+func Diagnose(ctx context.Context, diagnoser diagnose.Diagnoser) *Run {
+	start := time.Now()
+	results, err := diagnoser.Check(ctx)
+	run := &Run{
+		Time:     start,
+		Duration: time.Since(start),
+		Results:  results,
+		Err:      err,
+	}
+	if snapshotter, ok := diagnoser.(diagnose.Snapshotter); ok {
+		run.Snapshot = snapshotter.Snapshot()
+	}
+
+	return run
+}
+
+// Latest returns the latest run, or nil if no run has finished yet.
+func (m *Monitor) Latest() *Run {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest
+}
+
+// detectTransitions updates the recorded states with the run's results and
+// returns the transitions. A failed run is a transition of CheckDiagnosis and
+// keeps the states of the checks. A GPU which was seen before but is missing
+// from the results, e.g. because it fell off the bus, is a transition of its
+// bus presence. It must be called with mu held.
+func (m *Monitor) detectTransitions(run *Run) []*Event {
+	var events []*Event
+	add := func(gpu diagnose.GPUUID, check diagnose.DiagnoseType, healthy bool, message string) {
+		if event := m.transition(run, stateKey{GPU: gpu, Check: check}, healthy, message); event != nil {
+			events = append(events, event)
+		}
+	}
+
+	if run.Err != nil {
+		add(diagnose.GPUUUIDOverall, CheckDiagnosis, false, run.Err.Error())
+		return events
+	}
+	add(diagnose.GPUUUIDOverall, CheckDiagnosis, true, "")
+
+	gpus := make([]string, 0, len(run.Results))
+	for gpu := range run.Results {
+		gpus = append(gpus, string(gpu))
+	}
+	sort.Strings(gpus)
+
+	for _, gpu := range gpus {
+		busPresence := false
+		for _, result := range run.Results[diagnose.GPUUID(gpu)] {
+			if result == nil || result.IsHealthy == nil {
+				continue
+			}
+			busPresence = busPresence || result.Name == diagnose.DiagnoseGPUBusPresence
+			add(diagnose.GPUUID(gpu), result.Name, *result.IsHealthy, result.Message)
+		}
+
+		// A GPU which disappeared is present again.
+		key := stateKey{GPU: diagnose.GPUUID(gpu), Check: diagnose.DiagnoseGPUBusPresence}
+		if healthy, seen := m.states[key]; gpu != string(diagnose.GPUUUIDOverall) && !busPresence && seen && !healthy {
+			add(key.GPU, key.Check, true, "GPU is present again")
+		}
+	}
+
+	// GPUs which are already known to be off the bus are not reported again.
+	var missing []string
+	seen := map[diagnose.GPUUID]bool{}
+	for key := range m.states {
+		if key.GPU == diagnose.GPUUUIDOverall || seen[key.GPU] {
+			continue
+		}
+		seen[key.GPU] = true
+		healthy, ok := m.states[stateKey{GPU: key.GPU, Check: diagnose.DiagnoseGPUBusPresence}]
+		if _, present := run.Results[key.GPU]; !present && (!ok || healthy) {
+			missing = append(missing, string(key.GPU))
+		}
+	}
+	sort.Strings(missing)
+	for _, gpu := range missing {
+		add(diagnose.GPUUID(gpu), diagnose.DiagnoseGPUBusPresence, false, "GPU is missing from the diagnosis results")
+	}
+
+	return events
+}
+
+// transition records the state of the check and returns the transition, nil
+// if the state did not change. A check that is healthy the first time it is
+// seen is not a transition worth reporting.
+func (m *Monitor) transition(run *Run, key stateKey, healthy bool, message string) *Event {
+	previous, seen := m.states[key]
+	m.states[key] = healthy
+	if (seen && previous == healthy) || (!seen && healthy) {
+		return nil
+	}
+
+	event := &Event{
+		Time:    run.Time,
+		GPU:     key.GPU,
+		Check:   key.Check,
+		Healthy: healthy,
+		Message: message,
+	}
+	if seen {
+		event.Previous = &previous
+	}
+	return event
+}
+
+func (m *Monitor) nextInterval() time.Duration {
+	if m.config.Jitter <= 0 {
+		return m.config.Interval
+	}
+	return m.config.Interval + time.Duration(rand.Int63n(int64(m.config.Jitter)))
+}
@@ -0,0 +1,283 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+// fakeDiagnoser returns the scripted results of each call in turn, repeating
+// the last one.
+type fakeDiagnoser struct {
+	mu    sync.Mutex
+	calls int
+	runs  []map[diagnose.GPUUID][]*diagnose.DiagnoseResult
+	errs  []error
+	// entered is notified when Check is entered, before it waits on block.
+	entered chan struct{}
+	block   chan struct{}
+}
+
+func (f *fakeDiagnoser) Check(ctx context.Context) (map[diagnose.GPUUID][]*diagnose.DiagnoseResult, error) {
+	if f.entered != nil {
+		f.entered <- struct{}{}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	idx := f.calls
+	if idx >= len(f.runs) {
+		idx = len(f.runs) - 1
+	}
+	f.calls++
+
+	var err error
+	if idx < len(f.errs) {
+		err = f.errs[idx]
+	}
+	return f.runs[idx], err
+}
+
+func (f *fakeDiagnoser) Print(context.Context, []*diagnose.DiagnoseResult) error {
+	return nil
+}
+
+func results(linkHealthy, eccHealthy bool) map[diagnose.GPUUID][]*diagnose.DiagnoseResult {
+	return map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+		diagnose.GPUUUIDOverall: {
+			{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+		},
+		"GPU-uuid-1": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(linkHealthy), Message: "link"},
+			{Name: diagnose.DiagnoseGPUnrecoverableErrors, IsHealthy: utils.BoolPtr(eccHealthy), Message: "ecc"},
+		},
+	}
+}
+
+func TestNewMonitor(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{
+			name:    "nil config",
+			wantErr: "config cannot be nil",
+		},
+		{
+			name:    "no diagnoser",
+			config:  &Config{Interval: time.Minute, Timeout: time.Minute},
+			wantErr: "diagnoser is required",
+		},
+		{
+			name:    "invalid interval",
+			config:  &Config{Diagnoser: &fakeDiagnoser{}, Timeout: time.Minute},
+			wantErr: "interval must be positive, got 0s",
+		},
+		{
+			name:    "negative jitter",
+			config:  &Config{Diagnoser: &fakeDiagnoser{}, Interval: time.Minute, Jitter: -time.Second, Timeout: time.Minute},
+			wantErr: "jitter must not be negative, got -1s",
+		},
+		{
+			name:   "valid config",
+			config: &Config{Diagnoser: &fakeDiagnoser{}, Interval: time.Minute, Jitter: time.Second, Timeout: time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMonitor(tt.config)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, m)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, m)
+		})
+	}
+}
+
+func TestRunOnceTransitions(t *testing.T) {
+	diagnoser := &fakeDiagnoser{
+		runs: []map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			results(true, false),
+			results(false, false),
+			nil,
+			results(true, true),
+		},
+		errs: []error{nil, nil, fmt.Errorf("card count mismatch"), nil},
+	}
+	m, err := NewMonitor(&Config{Diagnoser: diagnoser, Interval: time.Minute, Timeout: time.Minute})
+	assert.NoError(t, err)
+
+	var events []*Event
+	m.AddEventHandler(func(_ context.Context, event *Event) {
+		events = append(events, event)
+	})
+	var runs []*Run
+	m.AddRunHandler(func(_ context.Context, run *Run) {
+		runs = append(runs, run)
+	})
+
+	// The first run reports checks which start unhealthy only.
+	m.RunOnce(context.Background())
+	assert.Len(t, events, 1)
+	assert.Equal(t, diagnose.GPUUID("GPU-uuid-1"), events[0].GPU)
+	assert.Equal(t, diagnose.DiagnoseGPUnrecoverableErrors, events[0].Check)
+	assert.Nil(t, events[0].Previous)
+	assert.False(t, events[0].Healthy)
+
+	// The link becomes unhealthy.
+	events = nil
+	m.RunOnce(context.Background())
+	assert.Len(t, events, 1)
+	assert.Equal(t, diagnose.DiagnoseGPULinkStatus, events[0].Check)
+	assert.True(t, *events[0].Previous)
+	assert.False(t, events[0].Healthy)
+
+	// A failed run is reported and keeps the previous states.
+	events = nil
+	run := m.RunOnce(context.Background())
+	assert.Error(t, run.Err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, diagnose.GPUUUIDOverall, events[0].GPU)
+	assert.Equal(t, CheckDiagnosis, events[0].Check)
+	assert.False(t, events[0].Healthy)
+	assert.Equal(t, "card count mismatch", events[0].Message)
+	assert.Equal(t, run, m.Latest())
+
+	// The diagnosis and both checks recover.
+	events = nil
+	m.RunOnce(context.Background())
+	assert.Len(t, events, 3)
+	assert.Equal(t, CheckDiagnosis, events[0].Check)
+	for _, event := range events {
+		assert.False(t, *event.Previous)
+		assert.True(t, event.Healthy)
+	}
+
+	assert.Len(t, runs, 4)
+}
+
+func TestRunOnceGPUDisappears(t *testing.T) {
+	twoGPUs := results(true, true)
+	twoGPUs["GPU-uuid-2"] = []*diagnose.DiagnoseResult{
+		{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+	}
+	diagnoser := &fakeDiagnoser{
+		runs: []map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+			twoGPUs,
+			results(true, true),
+			results(true, true),
+			twoGPUs,
+		},
+	}
+	m, err := NewMonitor(&Config{Diagnoser: diagnoser, Interval: time.Minute, Timeout: time.Minute})
+	assert.NoError(t, err)
+
+	var events []*Event
+	m.AddEventHandler(func(_ context.Context, event *Event) {
+		events = append(events, event)
+	})
+
+	m.RunOnce(context.Background())
+	assert.Empty(t, events)
+
+	// GPU-uuid-2 is missing from the results.
+	m.RunOnce(context.Background())
+	assert.Len(t, events, 1)
+	assert.Equal(t, diagnose.GPUUID("GPU-uuid-2"), events[0].GPU)
+	assert.Equal(t, diagnose.DiagnoseGPUBusPresence, events[0].Check)
+	assert.Nil(t, events[0].Previous)
+	assert.False(t, events[0].Healthy)
+	assert.Equal(t, "GPU is missing from the diagnosis results", events[0].Message)
+
+	// It is reported once.
+	events = nil
+	m.RunOnce(context.Background())
+	assert.Empty(t, events)
+
+	// GPU-uuid-2 is back.
+	events = nil
+	m.RunOnce(context.Background())
+	assert.Len(t, events, 1)
+	assert.Equal(t, diagnose.GPUUID("GPU-uuid-2"), events[0].GPU)
+	assert.Equal(t, diagnose.DiagnoseGPUBusPresence, events[0].Check)
+	assert.False(t, *events[0].Previous)
+	assert.True(t, events[0].Healthy)
+}
+
+func TestTryRunOnce(t *testing.T) {
+	diagnoser := &fakeDiagnoser{
+		runs:    []map[diagnose.GPUUID][]*diagnose.DiagnoseResult{results(true, true)},
+		entered: make(chan struct{}, 1),
+		block:   make(chan struct{}),
+	}
+	m, err := NewMonitor(&Config{Diagnoser: diagnoser, Interval: time.Minute, Timeout: time.Minute})
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		m.RunOnce(context.Background())
+		close(done)
+	}()
+
+	// The first run holds the lock until it is unblocked.
+	<-diagnoser.entered
+	_, ok := m.TryRunOnce(context.Background())
+	assert.False(t, ok)
+
+	close(diagnoser.block)
+	<-done
+
+	run, ok := m.TryRunOnce(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, run.Err)
+}
+
+func TestStart(t *testing.T) {
+	diagnoser := &fakeDiagnoser{
+		runs: []map[diagnose.GPUUID][]*diagnose.DiagnoseResult{results(true, true)},
+	}
+	m, err := NewMonitor(&Config{
+		Diagnoser: diagnoser,
+		Interval:  time.Millisecond,
+		Jitter:    time.Millisecond,
+		Timeout:   time.Second,
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 10)
+	m.AddRunHandler(func(context.Context, *Run) {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- m.Start(ctx)
+	}()
+
+	// Wait for a few runs before shutting down.
+	for i := 0; i < 3; i++ {
+		<-runs
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NotNil(t, m.Latest())
+}
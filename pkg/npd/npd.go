@@ -0,0 +1,285 @@
+// Package npd adapts diagnosis results to the custom plugin protocol of
+// node-problem-detector, which runs a binary and reads its exit code and the
+// first MaxOutputLength bytes of its stdout.
+package npd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/k8s"
+)
+
+// Status is the exit code of a custom plugin.
+type Status int
+
+const (
+	StatusOK      Status = 0
+	StatusNonOK   Status = 1
+	StatusUnknown Status = 2
+)
+
+// MaxOutputLength is the default max_output_length of node-problem-detector.
+const MaxOutputLength = 80
+
+// CheckGroup is a set of related checks reported as a single condition.
+type CheckGroup struct {
+	Name      string
+	Condition string
+	Checks    []diagnose.DiagnoseType
+}
+
+// CheckGroups covers every check in diagnose.AllDiagnoseTypes exactly once.
+var CheckGroups = []CheckGroup{
+	{
+		Name:      "driver",
+		Condition: "GPUDriverUnhealthy",
+		Checks: []diagnose.DiagnoseType{
+			diagnose.DiagnoseGPUDriverStatus,
+			diagnose.DiagnoseGPUKernelModules,
+			diagnose.DiagnoseGPUDeviceNodes,
+		},
+	},
+	{
+		Name:      "pcie",
+		Condition: "GPUPCIeUnhealthy",
+		Checks: []diagnose.DiagnoseType{
+			diagnose.DiagnoseGPUCardCount,
+			diagnose.DiagnoseGPUBusPresence,
+			diagnose.DiagnoseGPULinkStatus,
+			diagnose.DiagnoseGPUPCIeAERErrors,
+		},
+	},
+	{
+		Name:      "memory",
+		Condition: "GPUMemoryUnhealthy",
+		Checks: []diagnose.DiagnoseType{
+			diagnose.DiagnoseGPUnrecoverableErrors,
+			diagnose.DiagnoseGPURecoverableErrors,
+		},
+	},
+	{
+		Name:      "container-runtime",
+		Condition: "GPUContainerRuntimeUnhealthy",
+		Checks:    []diagnose.DiagnoseType{diagnose.DiagnoseGPUContainerRuntime},
+	},
+	{
+		Name:      "rdma",
+		Condition: "RDMAUnhealthy",
+		Checks:    []diagnose.DiagnoseType{diagnose.DiagnoseRDMADeviceStatus},
+	},
+}
+
+// ParseChecks resolves check and group names, which may be comma separated,
+// into checks. No names select every check.
+func ParseChecks(names []string) ([]diagnose.DiagnoseType, error) {
+	if len(names) == 0 {
+		return diagnose.AllDiagnoseTypes, nil
+	}
+
+	known := map[diagnose.DiagnoseType]bool{}
+	for _, check := range diagnose.AllDiagnoseTypes {
+		known[check] = true
+	}
+
+	var checks []diagnose.DiagnoseType
+	selected := map[diagnose.DiagnoseType]bool{}
+	add := func(check diagnose.DiagnoseType) {
+		if !selected[check] {
+			selected[check] = true
+			checks = append(checks, check)
+		}
+	}
+	for _, value := range names {
+	nextName:
+		for _, name := range strings.Split(value, ",") {
+			for _, group := range CheckGroups {
+				if group.Name == name {
+					for _, check := range group.Checks {
+						add(check)
+					}
+					continue nextName
+				}
+			}
+			if !known[diagnose.DiagnoseType(name)] {
+				return nil, fmt.Errorf("unknown check or check group %q", name)
+			}
+			add(diagnose.DiagnoseType(name))
+		}
+	}
+
+	return checks, nil
+}
+
+// Evaluate returns the status of the given checks and a message of at most
+// MaxOutputLength bytes. The status is Unknown if the diagnosis failed or
+// none of the checks ran, e.g. GPU checks when the driver is not loaded.
+func Evaluate(results map[diagnose.GPUUID][]*diagnose.DiagnoseResult, checkErr error, checks []diagnose.DiagnoseType) (Status, string) {
+	if checkErr != nil {
+		return StatusUnknown, truncate(fmt.Sprintf("diagnose failed: %s", checkErr))
+	}
+
+	selected := map[diagnose.DiagnoseType]bool{}
+	for _, check := range checks {
+		selected[check] = true
+	}
+
+	uuids := make([]string, 0, len(results))
+	for uuid := range results {
+		uuids = append(uuids, string(uuid))
+	}
+	sort.Strings(uuids)
+
+	ran := 0
+	var problems []string
+	for _, uuid := range uuids {
+		for _, result := range results[diagnose.GPUUID(uuid)] {
+			if result == nil || result.IsHealthy == nil || !selected[result.Name] {
+				continue
+			}
+			ran++
+			if !*result.IsHealthy {
+				problems = append(problems, fmt.Sprintf("%s %s: %s", result.Name, uuid, result.Message))
+			}
+		}
+	}
+
+	switch {
+	case len(problems) > 0:
+		msg := problems[0]
+		if len(problems) > 1 {
+			// Keep the count visible however long the first problem is.
+			suffix := fmt.Sprintf(" (+%d more)", len(problems)-1)
+			return StatusNonOK, truncate(truncateTo(msg, MaxOutputLength-len(suffix)) + suffix)
+		}
+		return StatusNonOK, truncate(msg)
+	case ran == 0:
+		return StatusUnknown, "no selected check ran"
+	default:
+		return StatusOK, truncate(fmt.Sprintf("%d checks are healthy", ran))
+	}
+}
+
+// PluginConfig is the config of a node-problem-detector custom plugin monitor.
+type PluginConfig struct {
+	Plugin           string       `json:"plugin"`
+	PluginConfig     PluginParams `json:"pluginConfig"`
+	Source           string       `json:"source"`
+	MetricsReporting bool         `json:"metricsReporting"`
+	Conditions       []Condition  `json:"conditions"`
+	Rules            []Rule       `json:"rules"`
+}
+
+type PluginParams struct {
+	InvokeInterval  string `json:"invoke_interval"`
+	Timeout         string `json:"timeout"`
+	MaxOutputLength int    `json:"max_output_length"`
+	Concurrency     int    `json:"concurrency"`
+}
+
+type Condition struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type Rule struct {
+	Type      string   `json:"type"`
+	Condition string   `json:"condition"`
+	Reason    string   `json:"reason"`
+	Path      string   `json:"path"`
+	Args      []string `json:"args"`
+	Timeout   string   `json:"timeout"`
+}
+
+type PluginConfigOptions struct {
+	// Path is the path of this binary on the node.
+	Path           string
+	InvokeInterval string
+	Timeout        string
+	// PerCheck generates a condition per check rather than per check group.
+	// Every rule runs the whole diagnosis, so this multiplies its cost.
+	PerCheck bool
+	// CardCount is the expected number of GPUs passed to every rule, which
+	// reads GPU_CARD_COUNT inherited from node-problem-detector if 0.
+	CardCount int
+	// HostRoot and HostExec are passed to every rule if node-problem-detector
+	// runs in a container with the host file system mounted at HostRoot.
+	HostRoot string
+	HostExec string
+}
+
+// ruleArgs returns the arguments of the rule reporting the given check or
+// check group.
+func (o *PluginConfigOptions) ruleArgs(check string) []string {
+	var args []string
+	if o.HostRoot != "" {
+		args = append(args, "--host-root="+o.HostRoot)
+		if o.HostExec != "" {
+			args = append(args, "--host-exec="+o.HostExec)
+		}
+	}
+	args = append(args, "diagnose", "--npd", "--check="+check)
+	if o.CardCount > 0 {
+		args = append(args, "--card-count="+strconv.Itoa(o.CardCount))
+	}
+	return args
+}
+
+// NewPluginConfig returns a plugin config with a permanent condition per check
+// group, or per check.
+func NewPluginConfig(opts *PluginConfigOptions) *PluginConfig {
+	config := &PluginConfig{
+		Plugin: "custom",
+		PluginConfig: PluginParams{
+			InvokeInterval:  opts.InvokeInterval,
+			Timeout:         opts.Timeout,
+			MaxOutputLength: MaxOutputLength,
+			Concurrency:     1,
+		},
+		Source:           "ai-accelerator-tool",
+		MetricsReporting: true,
+	}
+
+	addRule := func(condition, check string) {
+		config.Conditions = append(config.Conditions, Condition{
+			Type:    condition,
+			Reason:  strings.TrimSuffix(condition, "Unhealthy") + "IsHealthy",
+			Message: fmt.Sprintf("%s checks are healthy", check),
+		})
+		config.Rules = append(config.Rules, Rule{
+			Type:      "permanent",
+			Condition: condition,
+			Reason:    condition,
+			Path:      opts.Path,
+			Args:      opts.ruleArgs(check),
+			Timeout:   opts.Timeout,
+		})
+	}
+	if opts.PerCheck {
+		for _, check := range diagnose.AllDiagnoseTypes {
+			addRule(string(k8s.ProblemConditionType(check)), string(check))
+		}
+	} else {
+		for _, group := range CheckGroups {
+			addRule(group.Condition, group.Name)
+		}
+	}
+
+	return config
+}
+
+func truncate(s string) string {
+	return truncateTo(s, MaxOutputLength)
+}
+
+func truncateTo(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
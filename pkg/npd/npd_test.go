@@ -0,0 +1,135 @@
+package npd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+func TestCheckGroups(t *testing.T) {
+	covered := map[diagnose.DiagnoseType]int{}
+	for _, group := range CheckGroups {
+		for _, check := range group.Checks {
+			covered[check]++
+		}
+	}
+	for _, check := range diagnose.AllDiagnoseTypes {
+		assert.Equal(t, 1, covered[check], "check %s must be in exactly one group", check)
+	}
+	assert.Len(t, covered, len(diagnose.AllDiagnoseTypes))
+}
+
+func TestParseChecks(t *testing.T) {
+	got, err := ParseChecks(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, diagnose.AllDiagnoseTypes, got)
+
+	got, err = ParseChecks([]string{"memory,gpu_link_status", "gpu_vram_recoverable_errors"})
+	assert.NoError(t, err)
+	assert.Equal(t, []diagnose.DiagnoseType{
+		diagnose.DiagnoseGPUnrecoverableErrors,
+		diagnose.DiagnoseGPURecoverableErrors,
+		diagnose.DiagnoseGPULinkStatus,
+	}, got)
+
+	_, err = ParseChecks([]string{"gpu_fan_speed"})
+	assert.EqualError(t, err, `unknown check or check group "gpu_fan_speed"`)
+}
+
+func TestEvaluate(t *testing.T) {
+	results := map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+		diagnose.GPUUUIDOverall: {
+			{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+		},
+		"GPU-uuid-1": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(false), Message: "Link is not OK: link width is not ok, max: 16, current: 8"},
+			{Name: diagnose.DiagnoseGPUnrecoverableErrors, IsHealthy: utils.BoolPtr(true)},
+		},
+		"GPU-uuid-2": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(false), Message: "Link is not OK"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		checks     []diagnose.DiagnoseType
+		checkErr   error
+		wantStatus Status
+		wantMsg    string
+	}{
+		{
+			name:       "healthy",
+			checks:     []diagnose.DiagnoseType{diagnose.DiagnoseGPUDriverStatus, diagnose.DiagnoseGPUnrecoverableErrors},
+			wantStatus: StatusOK,
+			wantMsg:    "2 checks are healthy",
+		},
+		{
+			name:       "unhealthy",
+			checks:     []diagnose.DiagnoseType{diagnose.DiagnoseGPULinkStatus},
+			wantStatus: StatusNonOK,
+			wantMsg:    "gpu_link_status GPU-uuid-1: Link is not OK: link width is not ok, m... (+1 more)",
+		},
+		{
+			name:       "check did not run",
+			checks:     []diagnose.DiagnoseType{diagnose.DiagnoseRDMADeviceStatus},
+			wantStatus: StatusUnknown,
+			wantMsg:    "no selected check ran",
+		},
+		{
+			name:       "diagnose failed",
+			checks:     diagnose.AllDiagnoseTypes,
+			checkErr:   fmt.Errorf("GPU card count mismatch: got 1, expected 2"),
+			wantStatus: StatusUnknown,
+			wantMsg:    "diagnose failed: GPU card count mismatch: got 1, expected 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, msg := Evaluate(results, tt.checkErr, tt.checks)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantMsg, msg)
+			assert.LessOrEqual(t, len(msg), MaxOutputLength)
+		})
+	}
+}
+
+func TestNewPluginConfig(t *testing.T) {
+	config := NewPluginConfig(&PluginConfigOptions{
+		Path:           "/usr/local/bin/ai-accelerator-tool",
+		InvokeInterval: "5m",
+		Timeout:        "1m",
+	})
+	assert.Len(t, config.Rules, len(CheckGroups))
+	assert.Equal(t, "GPUDriverUnhealthy", config.Conditions[0].Type)
+	assert.Equal(t, "GPUDriverIsHealthy", config.Conditions[0].Reason)
+	assert.Equal(t, []string{"diagnose", "--npd", "--check=driver"}, config.Rules[0].Args)
+
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `"max_output_length":80`))
+
+	config = NewPluginConfig(&PluginConfigOptions{Path: "/usr/local/bin/ai-accelerator-tool", PerCheck: true})
+	assert.Len(t, config.Rules, len(diagnose.AllDiagnoseTypes))
+	assert.Equal(t, "GPULinkStatusUnhealthy", config.Rules[5].Condition)
+	assert.Equal(t, []string{"diagnose", "--npd", "--check=gpu_link_status"}, config.Rules[5].Args)
+
+	config = NewPluginConfig(&PluginConfigOptions{
+		Path:      "/usr/local/bin/ai-accelerator-tool",
+		CardCount: 8,
+		HostRoot:  "/host",
+		HostExec:  "nsenter",
+	})
+	for i, group := range CheckGroups {
+		assert.Equal(t, []string{"--host-root=/host", "--host-exec=nsenter", "diagnose", "--npd", "--check=" + group.Name, "--card-count=8"}, config.Rules[i].Args)
+	}
+
+	config = NewPluginConfig(&PluginConfigOptions{Path: "/usr/local/bin/ai-accelerator-tool", HostRoot: "/host"})
+	assert.Equal(t, []string{"--host-root=/host", "diagnose", "--npd", "--check=driver"}, config.Rules[0].Args)
+}
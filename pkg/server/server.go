@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	v1 "github.com/aibrix/ai-accelerator-tool/pkg/api/v1"
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/metrics"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns the HTTP API of the monitor:
+//
+//	GET  /healthz         liveness of the daemon, regardless of GPU health
+//	GET  /metrics         Prometheus metrics of the latest run
+//	GET  /v1/results      latest run as a v1.Report
+//	GET  /v1/gpus/{uuid}  latest results of a single GPU
+//	POST /v1/diagnose     run now, ?check=<name> may be repeated to filter
+//	                      the reported checks, all checks are run
+//
+// Runs started through the API are shared with the monitor's handlers, so
+// they run with ctx, the lifetime of the server, rather than the request.
+func NewHandler(ctx context.Context, m *monitor.Monitor) http.Handler {
+	s := &server{ctx: ctx, monitor: m}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.Handle("GET /metrics", metrics.NewHandler(metrics.NewCollector(m.Latest)))
+	mux.HandleFunc("GET /v1/results", s.results)
+	mux.HandleFunc("GET /v1/gpus/{uuid}", s.gpu)
+	mux.HandleFunc("POST /v1/diagnose", s.diagnose)
+
+	return mux
+}
+
+type server struct {
+	ctx     context.Context
+	monitor *monitor.Monitor
+}
+
+func (s *server) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *server) results(w http.ResponseWriter, _ *http.Request) {
+	run := s.monitor.Latest()
+	if run == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no diagnosis has finished yet"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, v1.NewReport(run, nil))
+}
+
+func (s *server) gpu(w http.ResponseWriter, r *http.Request) {
+	run := s.monitor.Latest()
+	if run == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no diagnosis has finished yet"))
+		return
+	}
+
+	uuid := r.PathValue("uuid")
+	gpu := v1.NewReport(run, nil).GPU(uuid)
+	if gpu == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("gpu %s not found", uuid))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, gpu)
+}
+
+func (s *server) diagnose(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCheckFilter(r.URL.Query()["check"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// A client disconnecting must not cancel the run, which is recorded as the
+	// latest run and reported by the monitor's handlers.
+	run, ok := s.monitor.TryRunOnce(s.ctx)
+	if !ok {
+		writeError(w, http.StatusConflict, fmt.Errorf("a diagnosis is already running"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, v1.NewReport(run, filter))
+}
+
+// parseCheckFilter returns a filter accepting the given checks, or nil if no
+// check is given.
+func parseCheckFilter(checks []string) (func(diagnose.DiagnoseType) bool, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	known := map[diagnose.DiagnoseType]bool{}
+	for _, check := range diagnose.AllDiagnoseTypes {
+		known[check] = true
+	}
+
+	selected := map[diagnose.DiagnoseType]bool{}
+	for _, value := range checks {
+		for _, check := range strings.Split(value, ",") {
+			if !known[diagnose.DiagnoseType(check)] {
+				return nil, fmt.Errorf("unknown check %q", check)
+			}
+			selected[diagnose.DiagnoseType(check)] = true
+		}
+	}
+
+	return func(check diagnose.DiagnoseType) bool {
+		return selected[check]
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.ErrorS(err, "Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
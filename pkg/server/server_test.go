@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/aibrix/ai-accelerator-tool/pkg/api/v1"
+	"github.com/aibrix/ai-accelerator-tool/pkg/diagnose"
+	"github.com/aibrix/ai-accelerator-tool/pkg/monitor"
+	"github.com/aibrix/ai-accelerator-tool/pkg/utils"
+)
+
+type fakeDiagnoser struct {
+	entered chan struct{}
+	block   chan struct{}
+}
+
+func (f *fakeDiagnoser) Check(ctx context.Context) (map[diagnose.GPUUID][]*diagnose.DiagnoseResult, error) {
+	if f.entered != nil {
+		f.entered <- struct{}{}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+
+	return map[diagnose.GPUUID][]*diagnose.DiagnoseResult{
+		diagnose.GPUUUIDOverall: {
+			{Name: diagnose.DiagnoseGPUDriverStatus, IsHealthy: utils.BoolPtr(true)},
+		},
+		"GPU-uuid-1": {
+			{Name: diagnose.DiagnoseGPULinkStatus, IsHealthy: utils.BoolPtr(true)},
+			{Name: diagnose.DiagnoseGPUnrecoverableErrors, IsHealthy: utils.BoolPtr(false)},
+		},
+	}, ctx.Err()
+}
+
+func (f *fakeDiagnoser) Print(context.Context, []*diagnose.DiagnoseResult) error {
+	return nil
+}
+
+func newTestHandler(t *testing.T, diagnoser diagnose.Diagnoser) (*monitor.Monitor, http.Handler) {
+	t.Helper()
+
+	m, err := monitor.NewMonitor(&monitor.Config{Diagnoser: diagnoser, Interval: time.Minute, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewMonitor() failed: %v", err)
+	}
+	return m, NewHandler(context.Background(), m)
+}
+
+func serve(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	m, handler := newTestHandler(t, &fakeDiagnoser{})
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		runFirst     bool
+		wantStatus   int
+		wantContains string
+	}{
+		{
+			name:         "healthz",
+			method:       http.MethodGet,
+			target:       "/healthz",
+			wantStatus:   http.StatusOK,
+			wantContains: "ok",
+		},
+		{
+			name:         "results before first run",
+			method:       http.MethodGet,
+			target:       "/v1/results",
+			wantStatus:   http.StatusServiceUnavailable,
+			wantContains: "no diagnosis has finished yet",
+		},
+		{
+			name:         "results",
+			method:       http.MethodGet,
+			target:       "/v1/results",
+			runFirst:     true,
+			wantStatus:   http.StatusOK,
+			wantContains: `"apiVersion":"v1"`,
+		},
+		{
+			name:         "gpu",
+			method:       http.MethodGet,
+			target:       "/v1/gpus/GPU-uuid-1",
+			runFirst:     true,
+			wantStatus:   http.StatusOK,
+			wantContains: `"uuid":"GPU-uuid-1"`,
+		},
+		{
+			name:         "unknown gpu",
+			method:       http.MethodGet,
+			target:       "/v1/gpus/GPU-uuid-9",
+			runFirst:     true,
+			wantStatus:   http.StatusNotFound,
+			wantContains: "gpu GPU-uuid-9 not found",
+		},
+		{
+			name:         "metrics",
+			method:       http.MethodGet,
+			target:       "/metrics",
+			runFirst:     true,
+			wantStatus:   http.StatusOK,
+			wantContains: "accelerator_check_healthy",
+		},
+		{
+			name:         "diagnose with unknown check",
+			method:       http.MethodPost,
+			target:       "/v1/diagnose?check=gpu_fan_speed",
+			wantStatus:   http.StatusBadRequest,
+			wantContains: `unknown check \"gpu_fan_speed\"`,
+		},
+		{
+			name:         "diagnose must be posted",
+			method:       http.MethodGet,
+			target:       "/v1/diagnose",
+			wantStatus:   http.StatusMethodNotAllowed,
+			wantContains: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.runFirst {
+				m.RunOnce(context.Background())
+			}
+
+			w := serve(handler, tt.method, tt.target)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantContains)
+		})
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	diagnoser := &fakeDiagnoser{}
+	m, handler := newTestHandler(t, diagnoser)
+
+	w := serve(handler, http.MethodPost, "/v1/diagnose?check=gpu_link_status,gpu_driver_status")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report v1.Report
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.Healthy)
+	assert.Len(t, report.Overall, 1)
+	assert.Equal(t, []v1.CheckResult{{Name: "gpu_link_status", Healthy: true}}, report.GPU("GPU-uuid-1").Checks)
+
+	// Overlapping runs are rejected.
+	diagnoser.entered = make(chan struct{}, 1)
+	diagnoser.block = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		serve(handler, http.MethodPost, "/v1/diagnose")
+		close(done)
+	}()
+	<-diagnoser.entered
+
+	w = serve(handler, http.MethodPost, "/v1/diagnose")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	close(diagnoser.block)
+	<-done
+
+	// A client disconnecting does not cancel the run.
+	diagnoser.entered = nil
+	diagnoser.block = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/diagnose", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, m.Latest().Err)
+}
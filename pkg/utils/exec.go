@@ -28,15 +28,8 @@ func realExecCmd(ctx context.Context, cmdName string, args []string) (string, er
 
 // realExecPipeCmd is the actual implementation that executes piped commands
 func realExecPipeCmd(ctx context.Context, cmds []string) (string, error) {
-	for _, cmd := range cmds {
-		if cmd == "" {
-			return "", ErrEmptyCommand
-		}
-
-		cmdName := strings.Split(cmd, " ")[0]
-		if !isSafeCommand(cmdName) {
-			return "", ErrUnsafeCommand
-		}
+	if err := checkPipeCmds(cmds); err != nil {
+		return "", err
 	}
 
 	cmdStr := strings.Join(cmds, "|")
@@ -49,6 +42,22 @@ func realExecPipeCmd(ctx context.Context, cmds []string) (string, error) {
 	return strings.TrimSpace(string(stdOutStderr)), nil
 }
 
+// checkPipeCmds makes sure that only safe commands are passed to the shell.
+func checkPipeCmds(cmds []string) error {
+	for _, cmd := range cmds {
+		if cmd == "" {
+			return ErrEmptyCommand
+		}
+
+		cmdName := strings.Split(cmd, " ")[0]
+		if !isSafeCommand(cmdName) {
+			return ErrUnsafeCommand
+		}
+	}
+
+	return nil
+}
+
 // SetExecCmd allows setting a mock implementation for testing
 func SetExecCmd(mock ExecCmdFunc) func() {
 	original := ExecCmd
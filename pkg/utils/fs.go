@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fsRoot is the directory that absolute host paths such as /sys or /proc are
+// resolved against.
+var fsRoot = "/"
+
+// HostPath returns the path of the given absolute host path under the current
+// file system root.
+func HostPath(path string) string {
+	return filepath.Join(fsRoot, path)
+}
+
+// TrimHostPath is the reverse of HostPath, it strips the file system root from
+// a resolved path.
+func TrimHostPath(path string) string {
+	if fsRoot == "/" {
+		return path
+	}
+	trimmed := strings.TrimPrefix(path, filepath.Clean(fsRoot))
+	if trimmed == "" {
+		return "/"
+	}
+	return trimmed
+}
+
+// ReadFile reads the named host file.
+func ReadFile(path string) ([]byte, error) {
+	return hostFS.ReadFile(path)
+}
+
+// ReadDir reads the named host directory.
+func ReadDir(path string) ([]os.DirEntry, error) {
+	return hostFS.ReadDir(path)
+}
+
+// Stat returns the FileInfo of the named host file, following symlinks.
+func Stat(path string) (os.FileInfo, error) {
+	return hostFS.Stat(path)
+}
+
+// EvalSymlinks returns the host path name after the evaluation of any symbolic
+// links.
+func EvalSymlinks(path string) (string, error) {
+	return hostFS.EvalSymlinks(path)
+}
+
+// fileSystem reads host files by their absolute host path.
+type fileSystem interface {
+	ReadFile(path string) ([]byte, error)
+	ReadDir(path string) ([]os.DirEntry, error)
+	Stat(path string) (os.FileInfo, error)
+	EvalSymlinks(path string) (string, error)
+}
+
+// hostFS is the implementation of the host file functions, which is replaced
+// while files are recorded or replayed.
+var hostFS fileSystem = rootFS{}
+
+func setFileSystem(fsys fileSystem) func() {
+	original := hostFS
+	hostFS = fsys
+	return func() {
+		hostFS = original
+	}
+}
+
+// rootFS reads the host files under the file system root.
+type rootFS struct{}
+
+func (rootFS) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(HostPath(path))
+}
+
+func (rootFS) ReadDir(path string) ([]os.DirEntry, error) {
+	return os.ReadDir(HostPath(path))
+}
+
+func (rootFS) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(HostPath(path))
+}
+
+func (rootFS) EvalSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(HostPath(path))
+	if err != nil {
+		return "", err
+	}
+	return TrimHostPath(resolved), nil
+}
+
+// SetFSRoot allows setting the file system root, e.g. a fake sysfs tree for testing.
+func SetFSRoot(root string) func() {
+	original := fsRoot
+	fsRoot = root
+	return func() {
+		fsRoot = original
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HostExecMode is how host binaries are executed when running in a container
+// with the host file system mounted.
+type HostExecMode string
+
+const (
+	// HostExecChroot runs host binaries with chroot into the host root, which
+	// requires the host file system to be mounted and CAP_SYS_CHROOT.
+	HostExecChroot HostExecMode = "chroot"
+	// HostExecNsenter runs host binaries in the namespaces of the host's init
+	// process, which requires hostPID and a privileged container.
+	HostExecNsenter HostExecMode = "nsenter"
+)
+
+// hostPATH is the executable path searched under the host root, the container's
+// PATH does not apply to the host file system.
+var hostPATH = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+
+// SetHostRoot makes all host file reads resolve under the given root, e.g.
+// /host, and executes all commands on the host with the given mode. It returns
+// a function restoring the previous behavior.
+func SetHostRoot(root string, mode HostExecMode) (func(), error) {
+	if !filepath.IsAbs(root) {
+		return nil, fmt.Errorf("host root must be an absolute path, got %q", root)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("stat host root failed: %s", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("host root %s is not a directory", root)
+	}
+	if mode != HostExecChroot && mode != HostExecNsenter {
+		return nil, fmt.Errorf("unknown host exec mode %q, must be %s or %s", mode, HostExecChroot, HostExecNsenter)
+	}
+
+	restoreFS := SetFSRoot(root)
+	execCmd := hostExecCmd(root, mode, ExecCmd)
+	restoreExec := SetExecCmd(execCmd)
+	restoreExecPipe := SetExecPipeCmd(hostExecPipeCmd(execCmd))
+
+	return func() {
+		restoreExecPipe()
+		restoreExec()
+		restoreFS()
+	}, nil
+}
+
+// hostExecCmd wraps the given exec function to run commands on the host.
+func hostExecCmd(root string, mode HostExecMode, execCmd ExecCmdFunc) ExecCmdFunc {
+	return func(ctx context.Context, cmdName string, args []string) (string, error) {
+		name, hostArgs := hostCommand(root, mode, cmdName, args)
+		return execCmd(ctx, name, hostArgs)
+	}
+}
+
+// hostExecPipeCmd runs the piped commands with a shell on the host, the shell
+// itself must come from the host as the commands are resolved by it.
+func hostExecPipeCmd(execCmd ExecCmdFunc) ExecPipeCmdFunc {
+	return func(ctx context.Context, cmds []string) (string, error) {
+		if err := checkPipeCmds(cmds); err != nil {
+			return "", err
+		}
+
+		res, err := execCmd(ctx, "sh", []string{"-c", strings.Join(cmds, "|")})
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(res), nil
+	}
+}
+
+// hostCommand returns the command and arguments running the given command on
+// the host.
+func hostCommand(root string, mode HostExecMode, cmdName string, args []string) (string, []string) {
+	if mode == HostExecNsenter {
+		hostArgs := []string{"--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--", cmdName}
+		return "nsenter", append(hostArgs, args...)
+	}
+
+	return "chroot", append([]string{root, cmdName}, args...)
+}
+
+// hostCommandExists checks if a command exists in the host's executable path.
+func hostCommandExists(cmd string) bool {
+	if strings.Contains(cmd, "/") {
+		return isExecutable(HostPath(cmd))
+	}
+
+	for _, dir := range hostPATH {
+		if isExecutable(HostPath(filepath.Join(dir, cmd))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return !info.IsDir() && info.Mode().Perm()&0111 != 0
+}
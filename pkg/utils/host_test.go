@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetHostRoot(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+
+	tests := []struct {
+		name    string
+		root    string
+		mode    HostExecMode
+		wantErr string
+	}{
+		{
+			name:    "relative root",
+			root:    "host",
+			mode:    HostExecChroot,
+			wantErr: `host root must be an absolute path, got "host"`,
+		},
+		{
+			name:    "root is a file",
+			root:    file,
+			mode:    HostExecChroot,
+			wantErr: "host root " + file + " is not a directory",
+		},
+		{
+			name:    "unknown mode",
+			root:    root,
+			mode:    "ssh",
+			wantErr: `unknown host exec mode "ssh", must be chroot or nsenter`,
+		},
+		{
+			name: "chroot",
+			root: root,
+			mode: HostExecChroot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore, err := SetHostRoot(tt.root, tt.mode)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Equal(t, "/", fsRoot)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(tt.root, "/sys"), HostPath("/sys"))
+
+			restore()
+			assert.Equal(t, "/sys", HostPath("/sys"))
+		})
+	}
+}
+
+func TestHostExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     HostExecMode
+		cmds     []string
+		wantCmd  string
+		wantPipe string
+	}{
+		{
+			name:     "chroot",
+			mode:     HostExecChroot,
+			cmds:     []string{"nvidia-smi -L", "wc -l"},
+			wantCmd:  "chroot /host nvidia-smi -L",
+			wantPipe: "chroot /host sh -c nvidia-smi -L|wc -l",
+		},
+		{
+			name:     "nsenter",
+			mode:     HostExecNsenter,
+			cmds:     []string{"nvidia-smi -L", "wc -l"},
+			wantCmd:  "nsenter --target 1 --mount --uts --ipc --net --pid -- nvidia-smi -L",
+			wantPipe: "nsenter --target 1 --mount --uts --ipc --net --pid -- sh -c nvidia-smi -L|wc -l",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var executed []string
+			execCmd := hostExecCmd("/host", tt.mode, func(_ context.Context, cmd string, args []string) (string, error) {
+				executed = append(executed, strings.Join(append([]string{cmd}, args...), " "))
+				return " 4\n", nil
+			})
+
+			_, err := execCmd(context.Background(), "nvidia-smi", []string{"-L"})
+			assert.NoError(t, err)
+
+			res, err := hostExecPipeCmd(execCmd)(context.Background(), tt.cmds)
+			assert.NoError(t, err)
+			assert.Equal(t, "4", res)
+
+			_, err = hostExecPipeCmd(execCmd)(context.Background(), []string{"rm -rf /"})
+			assert.ErrorIs(t, err, ErrUnsafeCommand)
+
+			assert.Equal(t, []string{tt.wantCmd, tt.wantPipe}, executed)
+		})
+	}
+}
+
+func TestHostCommandExists(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/nvidia-smi"), nil, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/nvidia-smi.txt"), nil, 0644))
+	defer SetFSRoot(root)()
+
+	assert.True(t, CommandExists("nvidia-smi"))
+	assert.True(t, CommandExists("/usr/bin/nvidia-smi"))
+	assert.False(t, CommandExists("nvidia-smi.txt"))
+	assert.False(t, CommandExists("nvidia-container-cli"))
+}
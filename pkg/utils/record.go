@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordFile is the file of a record bundle listing the executed commands, one
+// JSON encoded RecordedCommand per line.
+const RecordFile = "commands.jsonl"
+
+// RecordedCommand is a command executed, or looked up, during a recording.
+type RecordedCommand struct {
+	Time time.Time `json:"time"`
+	// Command and Args are set for a single command, Pipe for piped commands
+	// and Lookup for a command looked up in the executable path.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Pipe    []string `json:"pipe,omitempty"`
+	Lookup  string   `json:"lookup,omitempty"`
+	// Found is whether the looked up command exists.
+	Found  bool   `json:"found,omitempty"`
+	Output string `json:"output,omitempty"`
+	// ExitCode is the exit code of a command which exited, -1 if it could not
+	// be run or was killed.
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// key identifies the command in a replay.
+func (c *RecordedCommand) key() string {
+	switch {
+	case c.Lookup != "":
+		return "lookup " + c.Lookup
+	case c.Pipe != nil:
+		return "pipe " + strings.Join(c.Pipe, " | ")
+	}
+	return "exec " + strings.Join(append([]string{c.Command}, c.Args...), " ")
+}
+
+// result returns the output and error of the recorded command.
+func (c *RecordedCommand) result() (string, error) {
+	switch {
+	case c.Error == "":
+		return c.Output, nil
+	case c.ExitCode > 0:
+		return c.Output, &ExitError{Code: c.ExitCode, Message: c.Error}
+	}
+	return c.Output, errors.New(c.Error)
+}
+
+// ExitError is a replayed command which exited with a non-zero code.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode returns the exit code of the command which failed with the given
+// error, false if the command did not exit, e.g. because it was not found.
+func ExitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// StartRecording records every command executed through ExecCmd and
+// ExecPipeCmd, and looked up through CommandExists, with its output, exit
+// status and duration to the bundle in dir. Host files read through ReadFile,
+// ReadDir, Stat and EvalSymlinks are recorded too. It returns a function
+// restoring the previous behavior and closing the bundle.
+func StartRecording(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record dir: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, RecordFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create record file: %v", err)
+	}
+	filesFile, err := os.OpenFile(filepath.Join(dir, RecordedFilesFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create files record: %v", err)
+	}
+
+	r := &recorder{enc: json.NewEncoder(file), filesEnc: json.NewEncoder(filesFile)}
+	execCmd, execPipeCmd, commandExists := ExecCmd, ExecPipeCmd, commandExists
+
+	restoreExec := SetExecCmd(func(ctx context.Context, cmdName string, args []string) (string, error) {
+		start := time.Now()
+		res, err := execCmd(ctx, cmdName, args)
+		r.record(&RecordedCommand{Command: cmdName, Args: args}, start, res, err)
+		return res, err
+	})
+	restoreExecPipe := SetExecPipeCmd(func(ctx context.Context, cmds []string) (string, error) {
+		start := time.Now()
+		res, err := execPipeCmd(ctx, cmds)
+		r.record(&RecordedCommand{Pipe: cmds}, start, res, err)
+		return res, err
+	})
+	restoreLookup := setCommandExists(func(cmd string) bool {
+		found := commandExists(cmd)
+		r.record(&RecordedCommand{Lookup: cmd, Found: found}, time.Now(), "", nil)
+		return found
+	})
+	restoreFS := setFileSystem(recordingFS{fsys: hostFS, r: r})
+
+	return func() error {
+		restoreFS()
+		restoreLookup()
+		restoreExecPipe()
+		restoreExec()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		filesErr := filesFile.Close()
+		if r.err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write record file: %v", r.err)
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return filesErr
+	}, nil
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	filesEnc *json.Encoder
+	// err is the first write error, which is returned when the recording is
+	// stopped rather than failing the command.
+	err error
+}
+
+func (r *recorder) record(c *RecordedCommand, start time.Time, res string, err error) {
+	c.Time = start
+	c.Output = res
+	if c.Lookup == "" {
+		c.Duration = time.Since(start).String()
+	}
+	if err != nil {
+		c.Error = err.Error()
+		c.ExitCode = -1
+		if code, ok := ExitCode(err); ok {
+			c.ExitCode = code
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if encErr := r.enc.Encode(c); encErr != nil && r.err == nil {
+		r.err = encErr
+	}
+}
+
+func (r *recorder) recordFile(f *RecordedFile, err error) {
+	if err != nil {
+		f.Error = err.Error()
+		f.NotExist = os.IsNotExist(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if encErr := r.filesEnc.Encode(f); encErr != nil && r.err == nil {
+		r.err = encErr
+	}
+}
+
+// StartReplay serves the output of the commands and the host files recorded
+// to the bundle in dir instead of executing and reading them. Commands and
+// files read more than once are served in the recorded order, the last result
+// is repeated afterwards. Commands and files which were not recorded fail. It
+// returns a function restoring the previous behavior.
+func StartReplay(dir string) (func(), error) {
+	commands, err := LoadRecording(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := LoadRecordedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replayer{
+		commands: map[string][]*RecordedCommand{},
+		files:    map[string][]*RecordedFile{},
+		served:   map[string]int{},
+	}
+	for _, c := range commands {
+		r.commands[c.key()] = append(r.commands[c.key()], c)
+	}
+	for _, f := range files {
+		r.files[f.key()] = append(r.files[f.key()], f)
+	}
+
+	restoreExec := SetExecCmd(func(_ context.Context, cmdName string, args []string) (string, error) {
+		return r.replay(&RecordedCommand{Command: cmdName, Args: args})
+	})
+	restoreExecPipe := SetExecPipeCmd(func(_ context.Context, cmds []string) (string, error) {
+		return r.replay(&RecordedCommand{Pipe: cmds})
+	})
+	restoreLookup := setCommandExists(func(cmd string) bool {
+		c := r.next(&RecordedCommand{Lookup: cmd})
+		return c != nil && c.Found
+	})
+
+	restoreFS := setFileSystem(replayingFS{r: r})
+
+	return func() {
+		restoreFS()
+		restoreLookup()
+		restoreExecPipe()
+		restoreExec()
+	}, nil
+}
+
+// LoadRecording returns the commands recorded to the bundle in dir.
+func LoadRecording(dir string) ([]*RecordedCommand, error) {
+	return loadRecords[RecordedCommand](filepath.Join(dir, RecordFile), "record file")
+}
+
+// LoadRecordedFiles returns the host files recorded to the bundle in dir.
+func LoadRecordedFiles(dir string) ([]*RecordedFile, error) {
+	return loadRecords[RecordedFile](filepath.Join(dir, RecordedFilesFile), "files record")
+}
+
+// loadRecords returns the JSON encoded records of the file, one per line.
+func loadRecords[T any](path, name string) ([]*T, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+
+	var records []*T
+	scanner := bufio.NewScanner(file)
+	// Outputs of commands such as nvidia-smi -q may be long.
+	scanner.Buffer(nil, 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		record := new(T)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("invalid %s line %d: %v", name, n, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	return records, nil
+}
+
+type replayer struct {
+	mu       sync.Mutex
+	commands map[string][]*RecordedCommand
+	files    map[string][]*RecordedFile
+	// served counts how often every command and file was served.
+	served map[string]int
+}
+
+func (r *replayer) next(c *RecordedCommand) *RecordedCommand {
+	return nextRecord(r, r.commands, c.key())
+}
+
+func (r *replayer) nextFile(key string) *RecordedFile {
+	return nextRecord(r, r.files, key)
+}
+
+// nextRecord returns the next record of the key to serve, nil if none was
+// recorded. The keys of commands and files do not overlap.
+func nextRecord[T any](r *replayer, records map[string][]*T, key string) *T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recorded := records[key]
+	if len(recorded) == 0 {
+		return nil
+	}
+	i := min(r.served[key], len(recorded)-1)
+	r.served[key]++
+	return recorded[i]
+}
+
+func (r *replayer) replay(c *RecordedCommand) (string, error) {
+	recorded := r.next(c)
+	if recorded == nil {
+		return "", fmt.Errorf("command not recorded: %s", strings.TrimPrefix(c.key(), "exec "))
+	}
+	return recorded.result()
+}
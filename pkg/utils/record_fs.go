@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// RecordedFilesFile is the file of a record bundle listing the host files read,
+// one JSON encoded RecordedFile per line.
+const RecordedFilesFile = "files.jsonl"
+
+// File operations of a RecordedFile.
+const (
+	FileOpRead         = "read"
+	FileOpReadDir      = "readdir"
+	FileOpStat         = "stat"
+	FileOpEvalSymlinks = "evalsymlinks"
+)
+
+// RecordedFile is a host file read, listed or looked up during a recording.
+type RecordedFile struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// Content is the content of a read file.
+	Content []byte `json:"content,omitempty"`
+	// Entries are the entries of a read directory.
+	Entries []*RecordedFileInfo `json:"entries,omitempty"`
+	// Info is the FileInfo of a stat.
+	Info *RecordedFileInfo `json:"info,omitempty"`
+	// Target is the path a symlink evaluates to.
+	Target string `json:"target,omitempty"`
+	// NotExist is whether the file does not exist, Error is set for any error.
+	NotExist bool   `json:"notExist,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// key identifies the file operation in a replay.
+func (f *RecordedFile) key() string {
+	return f.Op + " " + f.Path
+}
+
+// err returns the error of the recorded file operation.
+func (f *RecordedFile) err() error {
+	switch {
+	case f.Error == "":
+		return nil
+	case f.NotExist:
+		return &fs.PathError{Op: f.Op, Path: f.Path, Err: fs.ErrNotExist}
+	}
+	return &fs.PathError{Op: f.Op, Path: f.Path, Err: errors.New(f.Error)}
+}
+
+// RecordedFileInfo is the FileInfo of a recorded file or directory entry. Only
+// the type bits of the mode are recorded for directory entries.
+type RecordedFileInfo struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+}
+
+func newRecordedFileInfo(info os.FileInfo) *RecordedFileInfo {
+	return &RecordedFileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// fileInfo serves a RecordedFileInfo as os.FileInfo and os.DirEntry.
+type fileInfo struct {
+	info *RecordedFileInfo
+}
+
+func (i fileInfo) Name() string               { return i.info.Name }
+func (i fileInfo) Size() int64                { return i.info.Size }
+func (i fileInfo) Mode() os.FileMode          { return i.info.Mode }
+func (i fileInfo) ModTime() time.Time         { return i.info.ModTime }
+func (i fileInfo) IsDir() bool                { return i.info.Mode.IsDir() }
+func (i fileInfo) Sys() any                   { return nil }
+func (i fileInfo) Type() os.FileMode          { return i.info.Mode.Type() }
+func (i fileInfo) Info() (os.FileInfo, error) { return i, nil }
+
+// recordingFS reads the host files through fsys and records them.
+type recordingFS struct {
+	fsys fileSystem
+	r    *recorder
+}
+
+func (f recordingFS) ReadFile(path string) ([]byte, error) {
+	content, err := f.fsys.ReadFile(path)
+	f.r.recordFile(&RecordedFile{Op: FileOpRead, Path: path, Content: content}, err)
+	return content, err
+}
+
+func (f recordingFS) ReadDir(path string) ([]os.DirEntry, error) {
+	entries, err := f.fsys.ReadDir(path)
+	recorded := &RecordedFile{Op: FileOpReadDir, Path: path}
+	for _, entry := range entries {
+		recorded.Entries = append(recorded.Entries, &RecordedFileInfo{Name: entry.Name(), Mode: entry.Type()})
+	}
+	f.r.recordFile(recorded, err)
+	return entries, err
+}
+
+func (f recordingFS) Stat(path string) (os.FileInfo, error) {
+	info, err := f.fsys.Stat(path)
+	recorded := &RecordedFile{Op: FileOpStat, Path: path}
+	if err == nil {
+		recorded.Info = newRecordedFileInfo(info)
+	}
+	f.r.recordFile(recorded, err)
+	return info, err
+}
+
+func (f recordingFS) EvalSymlinks(path string) (string, error) {
+	target, err := f.fsys.EvalSymlinks(path)
+	f.r.recordFile(&RecordedFile{Op: FileOpEvalSymlinks, Path: path, Target: target}, err)
+	return target, err
+}
+
+// replayingFS serves the recorded host files.
+type replayingFS struct {
+	r *replayer
+}
+
+func (f replayingFS) next(op, path string) (*RecordedFile, error) {
+	recorded := f.r.nextFile(op + " " + path)
+	if recorded == nil {
+		return nil, &fs.PathError{Op: op, Path: path, Err: errors.New("file not recorded")}
+	}
+	return recorded, recorded.err()
+}
+
+func (f replayingFS) ReadFile(path string) ([]byte, error) {
+	recorded, err := f.next(FileOpRead, path)
+	if err != nil {
+		return nil, err
+	}
+	return recorded.Content, nil
+}
+
+func (f replayingFS) ReadDir(path string) ([]os.DirEntry, error) {
+	recorded, err := f.next(FileOpReadDir, path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]os.DirEntry, 0, len(recorded.Entries))
+	for _, entry := range recorded.Entries {
+		entries = append(entries, fileInfo{info: entry})
+	}
+	return entries, nil
+}
+
+func (f replayingFS) Stat(path string) (os.FileInfo, error) {
+	recorded, err := f.next(FileOpStat, path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info: recorded.Info}, nil
+}
+
+func (f replayingFS) EvalSymlinks(path string) (string, error) {
+	recorded, err := f.next(FileOpEvalSymlinks, path)
+	if err != nil {
+		return "", err
+	}
+	return recorded.Target, nil
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	calls := map[string]int{}
+	defer SetExecCmd(func(_ context.Context, cmdName string, args []string) (string, error) {
+		calls[cmdName]++
+		switch cmdName {
+		case "nvidia-smi":
+			if calls[cmdName] > 1 {
+				return "GPU 0: A100\nGPU 1: A100\n", nil
+			}
+			return "GPU 0: A100\n", nil
+		case "lspci":
+			return "lspci: error\n", exitErr
+		}
+		return "", errors.New("exec: not found")
+	})()
+	defer SetExecPipeCmd(func(_ context.Context, cmds []string) (string, error) {
+		return "0x0000000100001000, Double Bit ECC", nil
+	})()
+	defer setCommandExists(func(cmd string) bool {
+		return cmd == "crictl"
+	})()
+
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "bundle")
+	stop, err := StartRecording(dir)
+	assert.NoError(t, err)
+	ExecCmd(ctx, "nvidia-smi", []string{"-L"})
+	ExecCmd(ctx, "nvidia-smi", []string{"-L"})
+	ExecCmd(ctx, "lspci", []string{"-v"})
+	ExecCmd(ctx, "crictl", []string{"info"})
+	ExecPipeCmd(ctx, []string{"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader", "grep -i 'Double'"})
+	CommandExists("crictl")
+	CommandExists("docker")
+	assert.NoError(t, stop())
+
+	commands, err := LoadRecording(dir)
+	assert.NoError(t, err)
+	assert.Len(t, commands, 7)
+	assert.Equal(t, "lspci", commands[2].Command)
+	assert.Equal(t, []string{"-v"}, commands[2].Args)
+	assert.Equal(t, 3, commands[2].ExitCode)
+	assert.Equal(t, "exit status 3", commands[2].Error)
+	assert.NotEmpty(t, commands[2].Duration)
+	assert.Equal(t, -1, commands[3].ExitCode)
+
+	// Nothing is executed while replaying.
+	calls = map[string]int{}
+	defer SetExecCmd(nil)()
+	defer SetExecPipeCmd(nil)()
+	defer setCommandExists(nil)()
+
+	restore, err := StartReplay(dir)
+	assert.NoError(t, err)
+	defer restore()
+
+	tests := []struct {
+		name         string
+		run          func() (string, error)
+		want         string
+		wantErr      string
+		wantExitCode int
+	}{
+		{
+			name: "first output",
+			run:  func() (string, error) { return ExecCmd(ctx, "nvidia-smi", []string{"-L"}) },
+			want: "GPU 0: A100\n",
+		},
+		{
+			name: "outputs in recorded order",
+			run:  func() (string, error) { return ExecCmd(ctx, "nvidia-smi", []string{"-L"}) },
+			want: "GPU 0: A100\nGPU 1: A100\n",
+		},
+		{
+			name: "last output repeated",
+			run:  func() (string, error) { return ExecCmd(ctx, "nvidia-smi", []string{"-L"}) },
+			want: "GPU 0: A100\nGPU 1: A100\n",
+		},
+		{
+			name:         "exit code",
+			run:          func() (string, error) { return ExecCmd(ctx, "lspci", []string{"-v"}) },
+			want:         "lspci: error\n",
+			wantErr:      "exit status 3",
+			wantExitCode: 3,
+		},
+		{
+			name:    "command not run",
+			run:     func() (string, error) { return ExecCmd(ctx, "crictl", []string{"info"}) },
+			wantErr: "exec: not found",
+		},
+		{
+			name: "piped commands",
+			run: func() (string, error) {
+				return ExecPipeCmd(ctx, []string{"nvidia-smi -i 0 --query-retired-pages=retired_pages.address,retired_pages.cause --format=csv,noheader", "grep -i 'Double'"})
+			},
+			want: "0x0000000100001000, Double Bit ECC",
+		},
+		{
+			name:    "not recorded",
+			run:     func() (string, error) { return ExecCmd(ctx, "nvidia-smi", []string{"-q"}) },
+			wantErr: "command not recorded: nvidia-smi -q",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run()
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			code, ok := ExitCode(err)
+			assert.Equal(t, tt.wantExitCode != 0, ok)
+			assert.Equal(t, tt.wantExitCode, code)
+		})
+	}
+
+	assert.True(t, CommandExists("crictl"))
+	assert.False(t, CommandExists("docker"))
+	assert.False(t, CommandExists("nvidia-ctk"), "lookups which were not recorded fail")
+	assert.Empty(t, calls)
+}
+
+func TestRecordReplayFiles(t *testing.T) {
+	root := t.TempDir()
+	devDir := filepath.Join(root, "sys/devices/pci0000:00/0000:3b:00.0")
+	assert.NoError(t, os.MkdirAll(devDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(devDir, "aer_dev_fatal"), []byte("TOTAL_ERR_FATAL 2\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "sys/bus/pci/devices"), 0755))
+	assert.NoError(t, os.Symlink("../../../devices/pci0000:00/0000:3b:00.0", filepath.Join(root, "sys/bus/pci/devices/0000:3b:00.0")))
+
+	dir := filepath.Join(t.TempDir(), "bundle")
+	restoreRoot := SetFSRoot(root)
+	stop, err := StartRecording(dir)
+	assert.NoError(t, err)
+	content, err := ReadFile("/sys/devices/pci0000:00/0000:3b:00.0/aer_dev_fatal")
+	assert.NoError(t, err)
+	entries, err := ReadDir("/sys/bus/pci/devices")
+	assert.NoError(t, err)
+	info, err := Stat("/sys/bus/pci/devices/0000:3b:00.0")
+	assert.NoError(t, err)
+	target, err := EvalSymlinks("/sys/bus/pci/devices/0000:3b:00.0")
+	assert.NoError(t, err)
+	_, err = ReadFile("/proc/driver/nvidia/gpus")
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, stop())
+	restoreRoot()
+
+	files, err := LoadRecordedFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 5)
+
+	// Files are served from the bundle, not from the replaying machine.
+	defer SetFSRoot(t.TempDir())()
+	restore, err := StartReplay(dir)
+	assert.NoError(t, err)
+	defer restore()
+
+	got, err := ReadFile("/sys/devices/pci0000:00/0000:3b:00.0/aer_dev_fatal")
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+	gotEntries, err := ReadDir("/sys/bus/pci/devices")
+	assert.NoError(t, err)
+	if assert.Len(t, gotEntries, len(entries)) {
+		assert.Equal(t, entries[0].Name(), gotEntries[0].Name())
+		assert.Equal(t, entries[0].Type(), gotEntries[0].Type())
+	}
+	gotInfo, err := Stat("/sys/bus/pci/devices/0000:3b:00.0")
+	assert.NoError(t, err)
+	assert.True(t, gotInfo.IsDir())
+	assert.Equal(t, info.Mode(), gotInfo.Mode())
+	gotTarget, err := EvalSymlinks("/sys/bus/pci/devices/0000:3b:00.0")
+	assert.NoError(t, err)
+	assert.Equal(t, target, gotTarget)
+	_, err = ReadFile("/proc/driver/nvidia/gpus")
+	assert.True(t, os.IsNotExist(err))
+	_, err = ReadFile("/proc/modules")
+	assert.EqualError(t, err, "read /proc/modules: file not recorded")
+}
+
+func TestLoadRecording(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string
+		wantLen int
+		wantErr string
+	}{
+		{
+			name:    "missing bundle",
+			wantErr: "failed to open record file",
+		},
+		{
+			name:    "invalid line",
+			content: stringPtr("{\"command\":\"lspci\",\"exitCode\":0}\n\n{\n"),
+			wantErr: "invalid record file line 3",
+		},
+		{
+			name:    "valid",
+			content: stringPtr("{\"command\":\"lspci\",\"exitCode\":0}\n{\"lookup\":\"crictl\",\"found\":true,\"exitCode\":0}\n"),
+			wantLen: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.content != nil {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, RecordFile), []byte(*tt.content), 0644))
+			}
+			commands, err := LoadRecording(dir)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, commands, tt.wantLen)
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -33,7 +33,7 @@ func CheckEnv(ctx context.Context) (*Env, error) {
 }
 
 func isSafeCommand(cmd string) bool {
-	safeCommands := []string{"lspci", "nvidia-smi", "wc", "ls", "grep", "echo", "cp"}
+	safeCommands := []string{"lspci", "nvidia-smi", "nvidia-container-cli", "wc", "ls", "grep", "echo", "cp"}
 	for _, safeCmd := range safeCommands {
 		if cmd == safeCmd {
 			return true
@@ -43,8 +43,29 @@ func isSafeCommand(cmd string) bool {
 	return false
 }
 
-// CommandExists checks if a command exists in the system's executable path.
+// CommandExists checks if a command exists in the system's executable path, or
+// the host's if a host root is set.
 func CommandExists(cmd string) bool {
+	return commandExists(cmd)
+}
+
+// commandExists is the implementation of CommandExists, which is replaced while
+// commands are recorded or replayed.
+var commandExists = realCommandExists
+
+func setCommandExists(lookup func(string) bool) func() {
+	original := commandExists
+	commandExists = lookup
+	return func() {
+		commandExists = original
+	}
+}
+
+func realCommandExists(cmd string) bool {
+	if fsRoot != "/" {
+		return hostCommandExists(cmd)
+	}
+
 	_, err := exec.LookPath(cmd)
 
 	return err == nil
@@ -61,9 +82,11 @@ func checkNVIDIA(ctx context.Context) (*Env, error) {
 	}
 
 	args = []string{"--query-gpu=name", "--format=csv,noheader"}
+	// The GPUs are NVIDIA even if nvidia-smi fails, the diagnosis of the driver
+	// tells why.
 	gpuType, err := ExecCmd(ctx, "nvidia-smi", args)
 	if err != nil {
-		return nil, err
+		return &Env{Vendor: NvidiaVendor}, nil
 	}
 
 	return &Env{
@@ -15,6 +15,8 @@ func TestCheckEnv(t *testing.T) {
 	tests := []struct {
 		name     string
 		mockCmds map[string]string
+		// failCmds fail with a non-zero exit code and the given output.
+		failCmds map[string]string
 		want     *Env
 		wantErr  bool
 	}{
@@ -30,6 +32,29 @@ func TestCheckEnv(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "nvidia-smi fails",
+			mockCmds: map[string]string{
+				"lspci -v -d 10de:": "NVIDIA Corporation [L20]",
+			},
+			want: &Env{
+				Vendor: NvidiaVendor,
+			},
+			wantErr: false,
+		},
+		{
+			name: "nvidia-smi cannot communicate with the driver",
+			mockCmds: map[string]string{
+				"lspci -v -d 10de:": "NVIDIA Corporation [L20]",
+			},
+			failCmds: map[string]string{
+				"nvidia-smi --query-gpu=name --format=csv,noheader": "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver",
+			},
+			want: &Env{
+				Vendor: NvidiaVendor,
+			},
+			wantErr: false,
+		},
 		{
 			name: "no nvidia gpu",
 			mockCmds: map[string]string{
@@ -43,7 +68,13 @@ func TestCheckEnv(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &MockExecCmd{Commands: tt.mockCmds}
-			cleanup := SetExecCmd(mock.Exec)
+			failing := &MockExecCmd{Commands: tt.failCmds, Err: &ExitError{Code: 9, Message: "exit status 9"}}
+			cleanup := SetExecCmd(func(ctx context.Context, cmd string, args []string) (string, error) {
+				if output, err := failing.Exec(ctx, cmd, args); err != nil && output != "" {
+					return output, err
+				}
+				return mock.Exec(ctx, cmd, args)
+			})
 			defer cleanup()
 
 			got, err := CheckEnv(context.Background())